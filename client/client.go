@@ -30,6 +30,7 @@ package client
 
 import (
 	"context"
+	"io"
 
 	commonpb "go.temporal.io/api/common/v1"
 	enumspb "go.temporal.io/api/enums/v1"
@@ -55,6 +56,17 @@ const (
 	QueryTypeOpenSessions string = internal.QueryTypeOpenSessions
 )
 
+const (
+	// HistoryFileFormatJSON is a single proto JSON encoded History document, as downloaded from the CLI or UI.
+	HistoryFileFormatJSON = internal.HistoryFileFormatJSON
+
+	// HistoryFileFormatNDJSON is a stream of proto JSON encoded history events, one event per line.
+	HistoryFileFormatNDJSON = internal.HistoryFileFormatNDJSON
+
+	// HistoryFileFormatBinary is a binary protobuf encoded History.
+	HistoryFileFormatBinary = internal.HistoryFileFormatBinary
+)
+
 type (
 	// Options are optional parameters for Client creation.
 	Options = internal.ClientOptions
@@ -68,6 +80,20 @@ type (
 	// HistoryEventIterator is a iterator which can return history events.
 	HistoryEventIterator = internal.HistoryEventIterator
 
+	// HistoryFileFormat is the encoding of a workflow history file written by ExportWorkflowHistory.
+	HistoryFileFormat = internal.HistoryFileFormat
+
+	// WorkflowExecutionIterator is a iterator which can return workflow executions from the visibility list APIs.
+	WorkflowExecutionIterator = internal.WorkflowExecutionIterator
+
+	// WorkflowExecutionEntry is a workflow execution returned by WorkflowExecutionIterator with decoded memo and
+	// search attributes.
+	WorkflowExecutionEntry = internal.WorkflowExecutionEntry
+
+	// VisibilityQuery builds a visibility query for ListWorkflow, ScanWorkflow and CountWorkflow.
+	// The query can be validated against the search attributes returned by Client.GetSearchAttributes.
+	VisibilityQuery = internal.VisibilityQuery
+
 	// WorkflowRun represents a started non child workflow.
 	WorkflowRun = internal.WorkflowRun
 
@@ -255,6 +281,7 @@ type (
 		//  - "(WorkflowID = 'wid1' or (WorkflowType = 'type2' and WorkflowID = 'wid2'))".
 		//  - "CloseTime between '2019-08-27T15:04:05+00:00' and '2019-08-28T15:04:05+00:00'".
 		//  - to list only open workflow use "CloseTime = missing"
+		// Use NewVisibilityQuery to build queries with correctly quoted and formatted values.
 		// Retrieved workflow executions are sorted by StartTime in descending order when list open workflow,
 		// and sorted by CloseTime in descending order for other queries.
 		// The errors it can return:
@@ -282,6 +309,37 @@ type (
 		//  - InternalServiceError
 		ScanWorkflow(ctx context.Context, request *workflowservice.ScanWorkflowExecutionsRequest) (*workflowservice.ScanWorkflowExecutionsResponse, error)
 
+		// ListClosedWorkflowIterator is like ListClosedWorkflow but returns an iterator which transparently fetches
+		// next pages. Memo and search attributes of the returned executions are decoded through the client's DataConverter.
+		// The iteration stops with an error once ctx is done.
+		// Example:-
+		//	iter := ListClosedWorkflowIterator(ctx, request)
+		//	for iter.HasNext() {
+		//		entry, err := iter.Next()
+		//		if err != nil {
+		//			return err
+		//		}
+		//		var owner string
+		//		err = entry.Memo["owner"].Get(&owner)
+		//	}
+		ListClosedWorkflowIterator(ctx context.Context, request *workflowservice.ListClosedWorkflowExecutionsRequest) WorkflowExecutionIterator
+
+		// ListOpenWorkflowIterator is like ListOpenWorkflow but returns an iterator which transparently fetches
+		// next pages (see ListClosedWorkflowIterator).
+		ListOpenWorkflowIterator(ctx context.Context, request *workflowservice.ListOpenWorkflowExecutionsRequest) WorkflowExecutionIterator
+
+		// ListWorkflowIterator is like ListWorkflow but returns an iterator which transparently fetches
+		// next pages (see ListClosedWorkflowIterator).
+		ListWorkflowIterator(ctx context.Context, request *workflowservice.ListWorkflowExecutionsRequest) WorkflowExecutionIterator
+
+		// ListArchivedWorkflowIterator is like ListArchivedWorkflow but returns an iterator which transparently fetches
+		// next pages (see ListClosedWorkflowIterator).
+		ListArchivedWorkflowIterator(ctx context.Context, request *workflowservice.ListArchivedWorkflowExecutionsRequest) WorkflowExecutionIterator
+
+		// ScanWorkflowIterator is like ScanWorkflow but returns an iterator which transparently fetches
+		// next pages (see ListClosedWorkflowIterator).
+		ScanWorkflowIterator(ctx context.Context, request *workflowservice.ScanWorkflowExecutionsRequest) WorkflowExecutionIterator
+
 		// CountWorkflow gets number of workflow executions based on query. This API only works with ElasticSearch,
 		// and will return BadRequestError when using Cassandra or MySQL. The query is basically the SQL WHERE clause
 		// (see ListWorkflow for query examples).
@@ -392,6 +450,33 @@ func NewNamespaceClient(options Options) (NamespaceClient, error) {
 	return internal.NewNamespaceClient(options)
 }
 
+// NewVisibilityQuery creates an empty visibility query. Conditions added to the query are combined with AND.
+// Example:-
+//	query, err := client.NewVisibilityQuery().
+//		Equal("WorkflowType", "OrderWorkflow").
+//		In("CustomKeywordField", "a", "b").
+//		GreaterThan("StartTime", time.Now().Add(-time.Hour)).
+//		BuildValidated(ctx, c)
+func NewVisibilityQuery() *VisibilityQuery {
+	return internal.NewVisibilityQuery()
+}
+
+// ExportWorkflowHistory writes the full history of the given workflow execution to the writer in the given format.
+// Events are written as they are received from the server, without loading the whole history into memory. Replaying
+// a HistoryFileFormatJSON file still decodes the whole document at once, so prefer HistoryFileFormatNDJSON or
+// HistoryFileFormatBinary for large histories.
+func ExportWorkflowHistory(ctx context.Context, c Client, workflowID string, runID string, writer io.Writer, format HistoryFileFormat) error {
+	return internal.ExportWorkflowHistory(ctx, c, workflowID, runID, writer, format)
+}
+
+// ExportWorkflowHistoryToFile writes the full history of the given workflow execution to a file that can be replayed
+// with worker.WorkflowReplayer. The format is chosen by the file name extension: .ndjson and .jsonl for one json
+// encoded event per line, .pb and .binpb for binary protobuf, and json otherwise. The file is gzip compressed if the
+// name ends with .gz.
+func ExportWorkflowHistoryToFile(ctx context.Context, c Client, workflowID string, runID string, fileName string) error {
+	return internal.ExportWorkflowHistoryToFile(ctx, c, workflowID, runID, fileName)
+}
+
 // make sure if new methods are added to internal.Client they are also added to public Client.
 var _ Client = internal.Client(nil)
 var _ internal.Client = Client(nil)
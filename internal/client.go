@@ -262,6 +262,37 @@ type (
 		//  - InternalServiceError
 		ScanWorkflow(ctx context.Context, request *workflowservice.ScanWorkflowExecutionsRequest) (*workflowservice.ScanWorkflowExecutionsResponse, error)
 
+		// ListClosedWorkflowIterator is like ListClosedWorkflow but returns an iterator which transparently fetches
+		// next pages. Memo and search attributes of the returned executions are decoded through the client's DataConverter.
+		// The iteration stops with an error once ctx is done.
+		// Example:-
+		//	iter := ListClosedWorkflowIterator(ctx, request)
+		//	for iter.HasNext() {
+		//		entry, err := iter.Next()
+		//		if err != nil {
+		//			return err
+		//		}
+		//		var owner string
+		//		err = entry.Memo["owner"].Get(&owner)
+		//	}
+		ListClosedWorkflowIterator(ctx context.Context, request *workflowservice.ListClosedWorkflowExecutionsRequest) WorkflowExecutionIterator
+
+		// ListOpenWorkflowIterator is like ListOpenWorkflow but returns an iterator which transparently fetches
+		// next pages (see ListClosedWorkflowIterator).
+		ListOpenWorkflowIterator(ctx context.Context, request *workflowservice.ListOpenWorkflowExecutionsRequest) WorkflowExecutionIterator
+
+		// ListWorkflowIterator is like ListWorkflow but returns an iterator which transparently fetches
+		// next pages (see ListClosedWorkflowIterator).
+		ListWorkflowIterator(ctx context.Context, request *workflowservice.ListWorkflowExecutionsRequest) WorkflowExecutionIterator
+
+		// ListArchivedWorkflowIterator is like ListArchivedWorkflow but returns an iterator which transparently fetches
+		// next pages (see ListClosedWorkflowIterator).
+		ListArchivedWorkflowIterator(ctx context.Context, request *workflowservice.ListArchivedWorkflowExecutionsRequest) WorkflowExecutionIterator
+
+		// ScanWorkflowIterator is like ScanWorkflow but returns an iterator which transparently fetches
+		// next pages (see ListClosedWorkflowIterator).
+		ScanWorkflowIterator(ctx context.Context, request *workflowservice.ScanWorkflowExecutionsRequest) WorkflowExecutionIterator
+
 		// CountWorkflow gets number of workflow executions based on query. This API only works with ElasticSearch,
 		// and will return BadRequestError when using Cassandra or MySQL. The query is basically the SQL WHERE clause
 		// (see ListWorkflow for query examples).
@@ -534,6 +565,11 @@ type (
 		// supported when Temporal server is using ElasticSearch). The key and value type must be registered on Temporal server side.
 		// Use GetSearchAttributes API to get valid key and corresponding value type.
 		SearchAttributes map[string]interface{}
+
+		// TypedSearchAttributes - Optional typed search attributes created with typed search attribute keys,
+		// e.g. NewSearchAttributeKeyKeyword("CustomKeywordField").ValueSet("value"). They are combined with
+		// SearchAttributes, a key must not be set in both.
+		TypedSearchAttributes []SearchAttributeUpdate
 	}
 
 	// RetryPolicy defines the retry policy.
@@ -0,0 +1,157 @@
+// The MIT License
+//
+// Copyright (c) 2020 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Command replay replays a batch of workflow histories against the workflow code compiled into it and prints a
+// pass/fail report. Histories are read from the history files of a directory or loaded from a Temporal service with
+// a list workflow query. It exits with a non-zero status if any replay fails.
+//
+// The SDK replay test workflows are registered by default. To check your own workflows copy this command and
+// register them in the workflows list.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"go.temporal.io/api/workflowservice/v1"
+	"google.golang.org/grpc"
+
+	"go.temporal.io/sdk/client"
+	ilog "go.temporal.io/sdk/internal/log"
+	"go.temporal.io/sdk/log"
+	"go.temporal.io/sdk/test/replaytests"
+	"go.temporal.io/sdk/worker"
+)
+
+var workflows = []interface{}{
+	replaytests.Workflow1,
+	replaytests.Workflow2,
+}
+
+type result struct {
+	Source        string `json:"source"`
+	WorkflowID    string `json:"workflowId,omitempty"`
+	RunID         string `json:"runId,omitempty"`
+	WorkflowType  string `json:"workflowType"`
+	Passed        bool   `json:"passed"`
+	FailedEventID int64  `json:"failedEventId,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+func main() {
+	dir := flag.String("dir", "", "directory with history files to replay")
+	query := flag.String("query", "", "list workflow query selecting executions to replay from the service")
+	address := flag.String("address", client.DefaultHostPort, "host:port of the Temporal frontend service, used with -query")
+	namespace := flag.String("namespace", client.DefaultNamespace, "namespace of the executions, used with -query")
+	concurrency := flag.Int("concurrency", 10, "maximum number of histories replayed concurrently")
+	jsonOutput := flag.Bool("json", false, "print the report as json")
+	verbose := flag.Bool("verbose", false, "print worker logs of the replays")
+	flag.Parse()
+
+	var logger log.Logger = ilog.NewNopLogger()
+	if *verbose {
+		logger = ilog.NewDefaultLogger()
+	}
+
+	// Stop listing executions on interrupt.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	report, err := replay(ctx, logger, *dir, *query, *address, *namespace, worker.ReplayBatchOptions{MaxConcurrentReplays: *concurrency})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if err := printReport(report, *jsonOutput); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if len(report.Failed()) > 0 {
+		os.Exit(1)
+	}
+}
+
+func replay(ctx context.Context, logger log.Logger, dir, query, address, namespace string, options worker.ReplayBatchOptions) (*worker.ReplayReport, error) {
+	replayer := worker.NewWorkflowReplayer()
+	for _, w := range workflows {
+		replayer.RegisterWorkflow(w)
+	}
+
+	switch {
+	case dir != "" && query != "":
+		return nil, fmt.Errorf("only one of -dir and -query can be set")
+	case dir != "":
+		return replayer.ReplayWorkflowHistoriesFromDirectory(logger, dir, options)
+	case query != "":
+		conn, err := grpc.Dial(address, grpc.WithInsecure())
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = conn.Close() }()
+
+		service := workflowservice.NewWorkflowServiceClient(conn)
+		return replayer.ReplayWorkflowExecutionsFromQuery(ctx, service, logger, namespace, query, options)
+	default:
+		return nil, fmt.Errorf("one of -dir and -query must be set")
+	}
+}
+
+func printReport(report *worker.ReplayReport, jsonOutput bool) error {
+	results := make([]result, 0, len(report.Results))
+	for _, r := range report.Results {
+		res := result{
+			Source:        r.Source,
+			WorkflowID:    r.Execution.ID,
+			RunID:         r.Execution.RunID,
+			WorkflowType:  r.WorkflowType,
+			Passed:        r.Error == nil,
+			FailedEventID: r.FailedEventID,
+		}
+		if r.Error != nil {
+			res.Error = r.Error.Error()
+		}
+		results = append(results, res)
+	}
+
+	if jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(results)
+	}
+
+	for _, res := range results {
+		if res.Passed {
+			fmt.Printf("PASS %s (%s)\n", res.Source, res.WorkflowType)
+		} else {
+			fmt.Printf("FAIL %s (%s) at event %d: %s\n", res.Source, res.WorkflowType, res.FailedEventID, res.Error)
+		}
+	}
+	fmt.Printf("%d passed, %d failed\n", len(report.Passed()), len(report.Failed()))
+	return nil
+}
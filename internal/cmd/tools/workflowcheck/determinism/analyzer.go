@@ -0,0 +1,431 @@
+// The MIT License
+//
+// Copyright (c) 2020 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package determinism implements analyzer which reports code that is not deterministic in workflow functions.
+package determinism
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// Analyzer finds workflow functions registered with RegisterWorkflow or started with ExecuteChildWorkflow and
+// reports the code reachable from them that is not deterministic.
+var Analyzer = &analysis.Analyzer{
+	Name:      "workflowcheck",
+	Doc:       "reports code that is not deterministic in Temporal workflow functions",
+	Run:       run,
+	FactTypes: []analysis.Fact{new(nonDeterministicFact)},
+}
+
+const sdkPackagePrefix = "go.temporal.io/sdk"
+
+type (
+	// nonDeterministicFact is exported for functions which are not deterministic, so calls to them from other
+	// packages are reported.
+	nonDeterministicFact struct {
+		What        string
+		Replacement string
+	}
+
+	// issue is a code which is not deterministic.
+	issue struct {
+		pos         token.Pos
+		what        string
+		replacement string
+	}
+
+	// funcInfo holds results of the analysis of a function body.
+	funcInfo struct {
+		issues  []issue
+		callees []*types.Func // functions of the same package called by the function
+	}
+
+	checker struct {
+		pass  *analysis.Pass
+		decls map[*types.Func]*ast.FuncDecl
+		infos map[ast.Node]*funcInfo
+	}
+)
+
+var (
+	// forbiddenFuncs maps functions which must not be called from workflow code to their replacements.
+	forbiddenFuncs = map[string]string{
+		"time.Now":                          "workflow.Now",
+		"time.Since":                        "workflow.Now",
+		"time.Until":                        "workflow.Now",
+		"time.Sleep":                        "workflow.Sleep",
+		"time.After":                        "workflow.NewTimer",
+		"time.AfterFunc":                    "workflow.NewTimer",
+		"time.NewTimer":                     "workflow.NewTimer",
+		"time.Tick":                         "workflow.NewTimer",
+		"time.NewTicker":                    "workflow.NewTimer",
+		"crypto/rand.Read":                  "workflow.NewRandom",
+		"crypto/rand.Int":                   "workflow.NewRandom",
+		"github.com/google/uuid.New":        "workflow.NewUUID",
+		"github.com/google/uuid.NewString":  "workflow.NewUUID",
+		"github.com/google/uuid.NewRandom":  "workflow.NewUUID",
+		"github.com/pborman/uuid.New":       "workflow.NewUUID",
+		"github.com/pborman/uuid.NewRandom": "workflow.NewUUID",
+	}
+
+	// forbiddenPackages maps packages which functions and methods must not be called from workflow code to the
+	// replacement of all of them.
+	forbiddenPackages = map[string]string{
+		"os":        "an activity",
+		"io/ioutil": "an activity",
+		"net":       "an activity",
+		"net/http":  "an activity",
+	}
+
+	// deterministicRandFuncs are math/rand functions which create seeded generators, all other package level
+	// functions use global generator.
+	deterministicRandFuncs = map[string]bool{
+		"New":       true,
+		"NewSource": true,
+		"NewZipf":   true,
+	}
+
+	// syncTypes maps sync package types which block workflow goroutine to their replacements.
+	syncTypes = map[string]string{
+		"Mutex":     "workflow.Mutex",
+		"RWMutex":   "workflow.Mutex",
+		"WaitGroup": "workflow.WaitGroup",
+		"Cond":      "workflow.Await",
+	}
+
+	// sideEffectFuncs are SDK functions which arguments are allowed to be not deterministic.
+	sideEffectFuncs = map[string]bool{
+		"SideEffect":        true,
+		"MutableSideEffect": true,
+	}
+)
+
+// AFact implements analysis.Fact.
+func (*nonDeterministicFact) AFact() {}
+
+func (f *nonDeterministicFact) String() string {
+	return fmt.Sprintf("nonDeterministic(%s)", f.What)
+}
+
+func (i issue) message() string {
+	return fmt.Sprintf("%s is not deterministic in workflow code, use %s instead", i.what, i.replacement)
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	if strings.HasPrefix(pass.Pkg.Path(), sdkPackagePrefix) || isStandardPackage(pass) {
+		// SDK implements deterministic primitives on top of goroutines and standard library is covered by the
+		// rules, so the facts are not needed for them.
+		return nil, nil
+	}
+	c := &checker{
+		pass:  pass,
+		decls: make(map[*types.Func]*ast.FuncDecl),
+		infos: make(map[ast.Node]*funcInfo),
+	}
+	for _, file := range pass.Files {
+		for _, decl := range file.Decls {
+			if funcDecl, ok := decl.(*ast.FuncDecl); ok && funcDecl.Body != nil {
+				if fn, ok := pass.TypesInfo.Defs[funcDecl.Name].(*types.Func); ok {
+					c.decls[fn] = funcDecl
+				}
+			}
+		}
+	}
+	c.exportFacts()
+	c.reportWorkflows()
+	return nil, nil
+}
+
+func isStandardPackage(pass *analysis.Pass) bool {
+	if len(pass.Files) == 0 {
+		return false
+	}
+	goRoot := filepath.Join(build.Default.GOROOT, "src") + string(filepath.Separator)
+	return strings.HasPrefix(pass.Fset.File(pass.Files[0].Pos()).Name(), goRoot)
+}
+
+// exportFacts exports nonDeterministicFact for every function of the package which is not deterministic.
+func (c *checker) exportFacts() {
+	causes := make(map[*types.Func]*issue)
+	visiting := make(map[*types.Func]bool)
+	var cause func(fn *types.Func) *issue
+	cause = func(fn *types.Func) *issue {
+		if i, ok := causes[fn]; ok || visiting[fn] {
+			return i
+		}
+		visiting[fn] = true
+		info := c.analyze(c.decls[fn])
+		var result *issue
+		if len(info.issues) > 0 {
+			result = &info.issues[0]
+		}
+		for _, callee := range info.callees {
+			if result != nil {
+				break
+			}
+			result = cause(callee)
+		}
+		causes[fn] = result
+		return result
+	}
+	for fn := range c.decls {
+		if i := cause(fn); i != nil {
+			c.pass.ExportObjectFact(fn, &nonDeterministicFact{What: i.what, Replacement: i.replacement})
+		}
+	}
+}
+
+// reportWorkflows reports issues of the code reachable from the workflow functions of the package.
+func (c *checker) reportWorkflows() {
+	reported := make(map[token.Pos]bool)
+	visited := make(map[ast.Node]bool)
+	var visit func(node ast.Node)
+	visit = func(node ast.Node) {
+		if visited[node] {
+			return
+		}
+		visited[node] = true
+		info := c.analyze(node)
+		for _, i := range info.issues {
+			if !reported[i.pos] {
+				reported[i.pos] = true
+				c.pass.Reportf(i.pos, "%s", i.message())
+			}
+		}
+		for _, callee := range info.callees {
+			visit(c.decls[callee])
+		}
+	}
+
+	for _, file := range c.pass.Files {
+		ast.Inspect(file, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			workflow := c.workflowArg(call)
+			if workflow == nil {
+				return true
+			}
+			switch w := unparen(workflow).(type) {
+			case *ast.FuncLit:
+				visit(w)
+			default:
+				fn := c.funcOf(w)
+				if fn == nil {
+					return true
+				}
+				if decl, ok := c.decls[fn]; ok {
+					visit(decl)
+				} else if fact := new(nonDeterministicFact); c.pass.ImportObjectFact(fn, fact) {
+					c.pass.Reportf(w.Pos(), "workflow %s calls %s which is not deterministic in workflow code, use %s instead",
+						fn.FullName(), fact.What, fact.Replacement)
+				}
+			}
+			return true
+		})
+	}
+}
+
+// workflowArg returns workflow function argument of RegisterWorkflow, RegisterWorkflowWithOptions or
+// ExecuteChildWorkflow call.
+func (c *checker) workflowArg(call *ast.CallExpr) ast.Expr {
+	fn := c.funcOf(call.Fun)
+	if fn == nil || fn.Pkg() == nil || !strings.HasPrefix(fn.Pkg().Path(), sdkPackagePrefix) {
+		return nil
+	}
+	argIndex := -1
+	switch fn.Name() {
+	case "RegisterWorkflow", "RegisterWorkflowWithOptions":
+		argIndex = 0
+	case "ExecuteChildWorkflow":
+		argIndex = 1
+	}
+	if argIndex < 0 || argIndex >= len(call.Args) {
+		return nil
+	}
+	return call.Args[argIndex]
+}
+
+// funcOf returns function or method referenced by expr, nil if expr is not a function name.
+func (c *checker) funcOf(expr ast.Expr) *types.Func {
+	var ident *ast.Ident
+	switch e := unparen(expr).(type) {
+	case *ast.Ident:
+		ident = e
+	case *ast.SelectorExpr:
+		ident = e.Sel
+	default:
+		return nil
+	}
+	fn, _ := c.pass.TypesInfo.Uses[ident].(*types.Func)
+	return fn
+}
+
+// analyze finds issues in the body of a function declaration or literal and functions of the package it calls.
+func (c *checker) analyze(node ast.Node) *funcInfo {
+	if info, ok := c.infos[node]; ok {
+		return info
+	}
+	info := &funcInfo{}
+	c.infos[node] = info
+	var body *ast.BlockStmt
+	switch n := node.(type) {
+	case *ast.FuncDecl:
+		body = n.Body
+	case *ast.FuncLit:
+		body = n.Body
+	}
+	if body == nil {
+		return info
+	}
+	add := func(pos token.Pos, what, replacement string) {
+		info.issues = append(info.issues, issue{pos: pos, what: what, replacement: replacement})
+	}
+
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.GoStmt:
+			add(n.Pos(), "go statement", "workflow.Go")
+		case *ast.SendStmt:
+			add(n.Pos(), "channel send", "workflow.Channel")
+		case *ast.UnaryExpr:
+			if n.Op == token.ARROW {
+				add(n.Pos(), "channel receive", "workflow.Channel")
+			}
+		case *ast.SelectStmt:
+			add(n.Pos(), "select statement", "workflow.Selector")
+		case *ast.RangeStmt:
+			switch c.pass.TypesInfo.TypeOf(n.X).Underlying().(type) {
+			case *types.Map:
+				add(n.Pos(), "range over map", "iteration over sorted keys")
+			case *types.Chan:
+				add(n.Pos(), "range over channel", "workflow.Channel")
+			}
+		case *ast.AssignStmt:
+			if n.Tok != token.DEFINE {
+				for _, lhs := range n.Lhs {
+					c.checkGlobalAssignment(lhs, add)
+				}
+			}
+		case *ast.IncDecStmt:
+			c.checkGlobalAssignment(n.X, add)
+		case *ast.CallExpr:
+			return c.checkCall(n, info, add)
+		}
+		return true
+	})
+	return info
+}
+
+func (c *checker) checkGlobalAssignment(lhs ast.Expr, add func(pos token.Pos, what, replacement string)) {
+	var ident *ast.Ident
+	switch e := unparen(lhs).(type) {
+	case *ast.Ident:
+		ident = e
+	case *ast.SelectorExpr:
+		ident = e.Sel
+	default:
+		return
+	}
+	v, ok := c.pass.TypesInfo.Uses[ident].(*types.Var)
+	if ok && v.Pkg() != nil && v.Parent() == v.Pkg().Scope() {
+		add(lhs.Pos(), fmt.Sprintf("modification of global variable %s", v.Name()), "workflow state")
+	}
+}
+
+// checkCall records issue if call is not deterministic, returns false if arguments of the call must not be checked.
+func (c *checker) checkCall(call *ast.CallExpr, info *funcInfo, add func(pos token.Pos, what, replacement string)) bool {
+	if tv, ok := c.pass.TypesInfo.Types[call.Fun]; ok && tv.IsBuiltin() {
+		if id, ok := unparen(call.Fun).(*ast.Ident); ok && id.Name == "make" && len(call.Args) > 0 {
+			if _, ok := c.pass.TypesInfo.TypeOf(call.Args[0]).Underlying().(*types.Chan); ok {
+				add(call.Pos(), "native channel", "workflow.NewChannel")
+			}
+		}
+		return true
+	}
+
+	fn := c.funcOf(call.Fun)
+	if fn == nil || fn.Pkg() == nil {
+		return true
+	}
+	pkgPath := fn.Pkg().Path()
+	sig := fn.Type().(*types.Signature)
+	name := fmt.Sprintf("%s.%s", fn.Pkg().Name(), fn.Name())
+	if recv := sig.Recv(); recv != nil {
+		name = fmt.Sprintf("%s.%s", types.TypeString(recv.Type(), types.RelativeTo(c.pass.Pkg)), fn.Name())
+	}
+
+	switch {
+	case strings.HasPrefix(pkgPath, sdkPackagePrefix):
+		// values computed by side effects are recorded into history
+		return !sideEffectFuncs[fn.Name()]
+	case pkgPath == c.pass.Pkg.Path():
+		if _, ok := c.decls[fn]; ok {
+			info.callees = append(info.callees, fn)
+		}
+	case forbiddenFuncs[pkgPath+"."+fn.Name()] != "" && sig.Recv() == nil:
+		add(call.Pos(), name, forbiddenFuncs[pkgPath+"."+fn.Name()])
+	case forbiddenPackages[pkgPath] != "":
+		add(call.Pos(), name, forbiddenPackages[pkgPath])
+	case pkgPath == "math/rand" && sig.Recv() == nil && !deterministicRandFuncs[fn.Name()]:
+		add(call.Pos(), name, "workflow.NewRandom")
+	case pkgPath == "sync" && sig.Recv() != nil:
+		if named, ok := derefNamed(sig.Recv().Type()); ok && syncTypes[named.Obj().Name()] != "" {
+			add(call.Pos(), name, syncTypes[named.Obj().Name()])
+		}
+	default:
+		fact := new(nonDeterministicFact)
+		if c.pass.ImportObjectFact(fn, fact) {
+			add(call.Pos(), fmt.Sprintf("call to %s (%s)", fn.FullName(), fact.What), fact.Replacement)
+		}
+	}
+	return true
+}
+
+func derefNamed(t types.Type) (*types.Named, bool) {
+	if ptr, ok := t.(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+	named, ok := t.(*types.Named)
+	return named, ok
+}
+
+func unparen(expr ast.Expr) ast.Expr {
+	for {
+		paren, ok := expr.(*ast.ParenExpr)
+		if !ok {
+			return expr
+		}
+		expr = paren.X
+	}
+}
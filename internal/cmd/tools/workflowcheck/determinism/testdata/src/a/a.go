@@ -0,0 +1,89 @@
+// The MIT License
+//
+// Copyright (c) 2020 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package a
+
+import (
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"b"
+
+	"go.temporal.io/sdk/worker"
+	"go.temporal.io/sdk/workflow"
+)
+
+var counter int
+
+func Register(w worker.Worker) { // want Register:"nonDeterministic\\(os.Getenv\\)"
+	w.RegisterWorkflow(Workflow)
+	w.RegisterWorkflow(b.Workflow) // want `workflow b.Workflow calls time.Sleep which is not deterministic in workflow code, use workflow.Sleep instead`
+	w.RegisterWorkflow(func(ctx workflow.Context) error {
+		_ = os.Getenv("HOME") // want `os.Getenv is not deterministic in workflow code, use an activity instead`
+		return nil
+	})
+	NotWorkflow()
+}
+
+func Workflow(ctx workflow.Context) error { // want Workflow:"nonDeterministic\\(time.Now\\)"
+	_ = time.Now() // want `time.Now is not deterministic in workflow code, use workflow.Now instead`
+	_ = b.Add(1, 2)
+	_ = b.Timestamp() // want `call to b.Timestamp \(time.Now\) is not deterministic in workflow code, use workflow.Now instead`
+	helper()
+	workflow.ExecuteChildWorkflow(ctx, Child)
+	workflow.SideEffect(ctx, func(ctx workflow.Context) interface{} {
+		return rand.Int()
+	})
+	workflow.Go(ctx, func(ctx workflow.Context) {
+		counter++ // want `modification of global variable counter is not deterministic in workflow code, use workflow state instead`
+	})
+	_ = rand.New(rand.NewSource(1)).Int()
+	return nil
+}
+
+func helper() { // want helper:"nonDeterministic\\(native channel\\)"
+	ch := make(chan int) // want `native channel is not deterministic in workflow code, use workflow.NewChannel instead`
+	go func() {          // want `go statement is not deterministic in workflow code, use workflow.Go instead`
+		ch <- 1 // want `channel send is not deterministic in workflow code, use workflow.Channel instead`
+	}()
+	<-ch                         // want `channel receive is not deterministic in workflow code, use workflow.Channel instead`
+	for range map[string]int{} { // want `range over map is not deterministic in workflow code, use iteration over sorted keys instead`
+	}
+	var mu sync.Mutex
+	mu.Lock()   // want `sync.Mutex.Lock is not deterministic in workflow code, use workflow.Mutex instead`
+	mu.Unlock() // want `sync.Mutex.Unlock is not deterministic in workflow code, use workflow.Mutex instead`
+	helper()
+}
+
+func Child(ctx workflow.Context) error { // want Child:"nonDeterministic\\(rand.Intn\\)"
+	_ = rand.Intn(10) // want `rand.Intn is not deterministic in workflow code, use workflow.NewRandom instead`
+	return nil
+}
+
+func NotWorkflow() { // want NotWorkflow:"nonDeterministic\\(time.Now\\)"
+	_ = time.Now()
+	go func() {}()
+}
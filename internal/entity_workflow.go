@@ -0,0 +1,176 @@
+// The MIT License
+//
+// Copyright (c) 2020 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package internal
+
+import (
+	"errors"
+
+	commonpb "go.temporal.io/api/common/v1"
+
+	"go.temporal.io/sdk/converter"
+)
+
+type (
+	// EntityWorkflowOptions configures entity workflow run by RunEntityWorkflow.
+	EntityWorkflowOptions struct {
+		// SignalNames lists the signals processed by the entity.
+		// Required, no default.
+		SignalNames []string
+
+		// MaxSignalsPerRun is the number of processed signals after which the workflow continues as new.
+		// Optional, no limit by default.
+		MaxSignalsPerRun int
+
+		// MaxHistoryLength is the number of history events after which the workflow continues as new.
+		// Optional, no limit by default.
+		MaxHistoryLength int
+
+		// MaxHistorySize is the approximate history size in bytes after which the workflow continues as new.
+		// Optional, no limit by default.
+		MaxHistorySize int
+	}
+
+	// EntitySignalHandler processes a signal received by entity workflow. Handler updates the entity state
+	// in place. It can block, for example to execute activities. Returning an error fails the workflow.
+	EntitySignalHandler func(ctx Context, signalName string, arg converter.EncodedValue) error
+
+	entitySignal struct {
+		name string
+		arg  converter.EncodedValue
+	}
+)
+
+var errEntitySignalNamesNotSet = errors.New("entity workflow has no signal names")
+
+// RunEntityWorkflow runs a loop which processes the signals listed in options with handler until the
+// workflow is canceled or history has to be truncated, which happens when one of the limits in options
+// is reached or WorkflowInfo.GetContinueAsNewSuggested returns true. In the latter case all signals already delivered to
+// the workflow are processed first and then the workflow continues as new with state as its only argument,
+// so the entity workflow function has to accept it, for example:
+//   func AccountWorkflow(ctx workflow.Context, state *AccountState) error {
+//	   if state == nil {
+//		   state = &AccountState{}
+//	   }
+//	   return workflow.RunEntityWorkflow(ctx, options, state, func(ctx workflow.Context, signalName string, arg converter.EncodedValue) error {
+//		   var amount int
+//		   if err := arg.Get(&amount); err != nil {
+//			   return err
+//		   }
+//		   state.Balance += amount
+//		   return nil
+//	   })
+//   }
+// Signals are processed one at a time, handler of the next signal is not started until the previous one returns.
+// Signals with the same name are processed in the order they are received, but the order of signals with different
+// names is not preserved: signals delivered to the workflow in the same workflow task are processed in the order of
+// options.SignalNames.
+func RunEntityWorkflow(ctx Context, options EntityWorkflowOptions, state interface{}, handler EntitySignalHandler) error {
+	if len(options.SignalNames) == 0 {
+		return errEntitySignalNamesNotSet
+	}
+
+	var pending []entitySignal
+	selector := NewSelector(ctx)
+	drainSelector := NewSelector(ctx)
+	for _, signalName := range options.SignalNames {
+		name := signalName
+		ch := getWorkflowEnvOptions(ctx).getSignalChannel(ctx, name)
+		receive := func(c ReceiveChannel, more bool) {
+			if arg, ok := receiveEntitySignal(c); ok {
+				pending = append(pending, entitySignal{name: name, arg: arg})
+			}
+		}
+		selector.AddReceive(ch, receive)
+		drainSelector.AddReceive(ch, receive)
+	}
+	canceled := false
+	selector.AddReceive(ctx.Done(), func(c ReceiveChannel, more bool) {
+		canceled = true
+	})
+	drained := false
+	drainSelector.AddDefault(func() {
+		drained = true
+	})
+
+	processed := 0
+	processPending := func() error {
+		for len(pending) > 0 {
+			signal := pending[0]
+			pending = pending[1:]
+			if err := handler(ctx, signal.name, signal.arg); err != nil {
+				return err
+			}
+			processed++
+		}
+		return nil
+	}
+
+	for !shouldEntityContinueAsNew(ctx, options, processed) {
+		selector.Select(ctx)
+		if canceled {
+			return ctx.Err()
+		}
+		if err := processPending(); err != nil {
+			return err
+		}
+	}
+
+	// Signals could be delivered while previous ones are processed, keep draining until none is left.
+	for {
+		drained = false
+		drainSelector.Select(ctx)
+		if drained {
+			break
+		}
+		if err := processPending(); err != nil {
+			return err
+		}
+	}
+	return NewContinueAsNewError(ctx, GetWorkflowInfo(ctx).WorkflowType.Name, state)
+}
+
+func receiveEntitySignal(c ReceiveChannel) (converter.EncodedValue, bool) {
+	ch := c.(*channelImpl)
+	v, ok, _ := ch.receiveAsyncImpl(nil)
+	if !ok {
+		return nil, false
+	}
+	payloads, _ := v.(*commonpb.Payloads)
+	return newEncodedValue(payloads, ch.dataConverter), true
+}
+
+func shouldEntityContinueAsNew(ctx Context, options EntityWorkflowOptions, processed int) bool {
+	if options.MaxSignalsPerRun > 0 && processed >= options.MaxSignalsPerRun {
+		return true
+	}
+	info := GetWorkflowInfo(ctx)
+	if options.MaxHistoryLength > 0 && info.GetCurrentHistoryLength() >= options.MaxHistoryLength {
+		return true
+	}
+	if options.MaxHistorySize > 0 && info.GetCurrentHistorySize() >= options.MaxHistorySize {
+		return true
+	}
+	return info.GetContinueAsNewSuggested()
+}
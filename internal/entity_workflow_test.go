@@ -0,0 +1,149 @@
+// The MIT License
+//
+// Copyright (c) 2020 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package internal
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"go.temporal.io/sdk/converter"
+)
+
+type entityTestState struct {
+	Total   int
+	Signals []string
+}
+
+func entityTestWorkflow(options EntityWorkflowOptions) func(ctx Context, state *entityTestState) error {
+	return func(ctx Context, state *entityTestState) error {
+		if state == nil {
+			state = &entityTestState{}
+		}
+		return RunEntityWorkflow(ctx, options, state, func(ctx Context, signalName string, arg converter.EncodedValue) error {
+			var value int
+			if err := arg.Get(&value); err != nil {
+				return err
+			}
+			if value < 0 {
+				return errors.New("negative value")
+			}
+			// blocking handler lets more signals to be delivered during draining
+			if err := Sleep(ctx, time.Second); err != nil {
+				return err
+			}
+			state.Total += value
+			state.Signals = append(state.Signals, signalName)
+			return nil
+		})
+	}
+}
+
+func TestEntityWorkflow_ContinueAsNewAfterDraining(t *testing.T) {
+	var s WorkflowTestSuite
+	env := s.NewTestWorkflowEnvironment()
+	wf := entityTestWorkflow(EntityWorkflowOptions{SignalNames: []string{"add", "add-twice"}, MaxSignalsPerRun: 2})
+	env.RegisterWorkflowWithOptions(wf, RegisterWorkflowOptions{Name: "entity"})
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("add", 1)
+		env.SignalWorkflow("add-twice", 2)
+	}, time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("add", 3)
+	}, time.Minute+time.Second)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("add", 4)
+	}, time.Minute+2*time.Second)
+	env.ExecuteWorkflow("entity", nil)
+
+	require.True(t, env.IsWorkflowCompleted())
+	var continueAsNewErr *ContinueAsNewError
+	require.True(t, errors.As(env.GetWorkflowError(), &continueAsNewErr))
+	require.Equal(t, "entity", continueAsNewErr.WorkflowType.Name)
+	var state *entityTestState
+	require.NoError(t, converter.GetDefaultDataConverter().FromPayloads(continueAsNewErr.Input, &state))
+	require.Equal(t, 10, state.Total)
+	require.Equal(t, []string{"add", "add-twice", "add", "add"}, state.Signals)
+}
+
+func TestEntityWorkflow_ContinueAsNewSuggested(t *testing.T) {
+	var s WorkflowTestSuite
+	env := s.NewTestWorkflowEnvironment()
+	wf := entityTestWorkflow(EntityWorkflowOptions{SignalNames: []string{"add"}})
+	env.RegisterWorkflowWithOptions(wf, RegisterWorkflowOptions{Name: "entity"})
+	env.SetContinueAsNewSuggested(true)
+	env.ExecuteWorkflow("entity", &entityTestState{Total: 5})
+
+	require.True(t, env.IsWorkflowCompleted())
+	var continueAsNewErr *ContinueAsNewError
+	require.True(t, errors.As(env.GetWorkflowError(), &continueAsNewErr))
+	var state *entityTestState
+	require.NoError(t, converter.GetDefaultDataConverter().FromPayloads(continueAsNewErr.Input, &state))
+	require.Equal(t, 5, state.Total)
+}
+
+func TestEntityWorkflow_HandlerError(t *testing.T) {
+	var s WorkflowTestSuite
+	env := s.NewTestWorkflowEnvironment()
+	wf := entityTestWorkflow(EntityWorkflowOptions{SignalNames: []string{"add"}})
+	env.RegisterWorkflowWithOptions(wf, RegisterWorkflowOptions{Name: "entity"})
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("add", -1)
+	}, time.Minute)
+	env.ExecuteWorkflow("entity", nil)
+
+	require.True(t, env.IsWorkflowCompleted())
+	var applicationErr *ApplicationError
+	require.True(t, errors.As(env.GetWorkflowError(), &applicationErr))
+	require.Equal(t, "negative value", applicationErr.Error())
+}
+
+func TestEntityWorkflow_Canceled(t *testing.T) {
+	var s WorkflowTestSuite
+	env := s.NewTestWorkflowEnvironment()
+	wf := entityTestWorkflow(EntityWorkflowOptions{SignalNames: []string{"add"}})
+	env.RegisterWorkflowWithOptions(wf, RegisterWorkflowOptions{Name: "entity"})
+	env.RegisterDelayedCallback(func() {
+		env.CancelWorkflow()
+	}, time.Minute)
+	env.ExecuteWorkflow("entity", nil)
+
+	require.True(t, env.IsWorkflowCompleted())
+	var canceledErr *CanceledError
+	require.True(t, errors.As(env.GetWorkflowError(), &canceledErr))
+}
+
+func TestEntityWorkflow_NoSignalNames(t *testing.T) {
+	var s WorkflowTestSuite
+	env := s.NewTestWorkflowEnvironment()
+	wf := entityTestWorkflow(EntityWorkflowOptions{})
+	env.RegisterWorkflowWithOptions(wf, RegisterWorkflowOptions{Name: "entity"})
+	env.ExecuteWorkflow("entity", nil)
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.Error(t, env.GetWorkflowError())
+}
@@ -31,9 +31,11 @@ import (
 	"strings"
 	"time"
 
+	commandpb "go.temporal.io/api/command/v1"
 	commonpb "go.temporal.io/api/common/v1"
 	enumspb "go.temporal.io/api/enums/v1"
 	failurepb "go.temporal.io/api/failure/v1"
+	historypb "go.temporal.io/api/history/v1"
 
 	"go.temporal.io/sdk/converter"
 )
@@ -174,11 +176,53 @@ type (
 		WorkflowExecutionTimeout time.Duration
 		WorkflowRunTimeout       time.Duration
 		WorkflowTaskTimeout      time.Duration
+		// Memo and SearchAttributes of the new run, if nil the values of the current run are used.
+		Memo             *commonpb.Memo
+		SearchAttributes *commonpb.SearchAttributes
+		// RetryPolicy of the new run, if nil the new run doesn't have retry policy.
+		RetryPolicy *RetryPolicy
+	}
+
+	// ContinueAsNewErrorOptions specifies options of the new run created by NewContinueAsNewErrorWithOptions.
+	// Zero values keep the options of the current run.
+	ContinueAsNewErrorOptions struct {
+		// TaskQueue of the new run.
+		TaskQueue string
+
+		// WorkflowRunTimeout of the new run.
+		WorkflowRunTimeout time.Duration
+
+		// WorkflowTaskTimeout of the new run.
+		WorkflowTaskTimeout time.Duration
+
+		// Memo of the new run. If set, it replaces memo of the current run.
+		Memo map[string]interface{}
+
+		// SearchAttributes of the new run. If SearchAttributes or TypedSearchAttributes is set,
+		// they replace search attributes of the current run.
+		SearchAttributes map[string]interface{}
+
+		// TypedSearchAttributes of the new run, see SearchAttributes.
+		TypedSearchAttributes []SearchAttributeUpdate
+
+		// RetryPolicy of the new run. Retry policy of the current run is not carried over, the new run has no retry
+		// policy if it is not set.
+		RetryPolicy *RetryPolicy
 	}
 
 	// UnknownExternalWorkflowExecutionError can be returned when external workflow doesn't exist
 	UnknownExternalWorkflowExecutionError struct{}
 
+	// NonDeterminismError is returned when workflow code replayed against its history produces commands that don't
+	// match the history events. Usually this means that the workflow code was changed in a non backwards compatible
+	// way without versioning (see workflow.GetVersion).
+	NonDeterminismError struct {
+		msg          string
+		historyEvent *historypb.HistoryEvent
+		command      *commandpb.Command
+		stackTrace   string
+	}
+
 	// ServerError can be returned from server.
 	ServerError struct {
 		temporalError
@@ -430,6 +474,46 @@ func NewContinueAsNewError(ctx Context, wfn interface{}, args ...interface{}) er
 	}
 }
 
+// NewContinueAsNewErrorWithOptions creates ContinueAsNewError instance like NewContinueAsNewError,
+// with options of the new run overridden by the options argument. If memo or search attributes in options cannot be
+// encoded, the returned error is not a ContinueAsNewError.
+//  options - options of the new run, zero values keep the options of the current run or the ones set on ctx
+//	  (except for RetryPolicy, see ContinueAsNewErrorOptions).
+//  wfn - workflow function. for new execution it can be different from the currently running.
+//  args - arguments for the new workflow.
+//
+func NewContinueAsNewErrorWithOptions(ctx Context, options ContinueAsNewErrorOptions, wfn interface{}, args ...interface{}) error {
+	contErr := NewContinueAsNewError(ctx, wfn, args...).(*ContinueAsNewError)
+
+	if options.TaskQueue != "" {
+		contErr.TaskQueueName = options.TaskQueue
+	}
+	if options.WorkflowRunTimeout != 0 {
+		contErr.WorkflowRunTimeout = options.WorkflowRunTimeout
+	}
+	if options.WorkflowTaskTimeout != 0 {
+		contErr.WorkflowTaskTimeout = options.WorkflowTaskTimeout
+	}
+	if options.Memo != nil {
+		memo, err := getWorkflowMemo(options.Memo, getDataConverterFromWorkflowContext(ctx))
+		if err != nil {
+			return fmt.Errorf("invalid memo of the new run: %w", err)
+		}
+		contErr.Memo = memo
+	}
+	if options.SearchAttributes != nil || options.TypedSearchAttributes != nil {
+		searchAttributes, err := mergeTypedSearchAttributes(options.SearchAttributes, options.TypedSearchAttributes)
+		if err == nil {
+			contErr.SearchAttributes, err = serializeSearchAttributes(searchAttributes)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid search attributes of the new run: %w", err)
+		}
+	}
+	contErr.RetryPolicy = options.RetryPolicy
+	return contErr
+}
+
 // NewActivityNotRegisteredError creates a new ActivityNotRegisteredError.
 func NewActivityNotRegisteredError(activityType string, supportedTypes []string) error {
 	return &ActivityNotRegisteredError{activityType: activityType, supportedTypes: supportedTypes}
@@ -570,6 +654,45 @@ func (e *workflowPanicError) StackTrace() string {
 	return e.stackTrace
 }
 
+func newNonDeterminismError(message string, historyEvent *historypb.HistoryEvent, command *commandpb.Command) *NonDeterminismError {
+	msg := message
+	if historyEvent != nil {
+		msg += ", history event: " + historyEventSummary(historyEvent)
+	}
+	if command != nil {
+		msg += ", replay command: " + commandSummary(command)
+	}
+	return &NonDeterminismError{msg: msg, historyEvent: historyEvent, command: command}
+}
+
+// Error from error interface
+func (e *NonDeterminismError) Error() string {
+	return e.msg
+}
+
+// EventID returns ID of the history event that didn't match the workflow code, or 0 if the workflow code
+// produced a command that is not in the history.
+func (e *NonDeterminismError) EventID() int64 {
+	return e.historyEvent.GetEventId()
+}
+
+// HistoryEvent returns the history event that didn't match the workflow code. It is nil if the workflow code
+// produced a command that is not in the history.
+func (e *NonDeterminismError) HistoryEvent() *historypb.HistoryEvent {
+	return e.historyEvent
+}
+
+// Command returns the command produced by the workflow code that didn't match the history. It is nil if the
+// workflow code didn't produce a command for the history event.
+func (e *NonDeterminismError) Command() *commandpb.Command {
+	return e.command
+}
+
+// StackTrace returns stack trace of all workflow coroutines at the moment the non-determinism was detected.
+func (e *NonDeterminismError) StackTrace() string {
+	return e.stackTrace
+}
+
 // Error from error interface
 func (e *ContinueAsNewError) Error() string {
 	return e.message()
@@ -28,6 +28,7 @@ import (
 	"errors"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -38,6 +39,7 @@ import (
 	historypb "go.temporal.io/api/history/v1"
 
 	"go.temporal.io/sdk/converter"
+	iconverter "go.temporal.io/sdk/internal/converter"
 	ilog "go.temporal.io/sdk/internal/log"
 )
 
@@ -550,6 +552,50 @@ func Test_ContinueAsNewError(t *testing.T) {
 	require.Equal(t, header, continueAsNewErr.Header)
 }
 
+func Test_ContinueAsNewErrorWithOptions(t *testing.T) {
+	continueAsNewWfName := "continueAsNewWorkflowFn"
+	retryPolicy := &RetryPolicy{MaximumAttempts: 3}
+	continueAsNewWorkflowFn := func(ctx Context) error {
+		return NewContinueAsNewErrorWithOptions(ctx, ContinueAsNewErrorOptions{
+			TaskQueue:             "new-task-queue",
+			WorkflowRunTimeout:    time.Hour,
+			Memo:                  map[string]interface{}{"Description": "next run"},
+			TypedSearchAttributes: []SearchAttributeUpdate{NewSearchAttributeKeyInt64("CustomIntField").ValueSet(2)},
+			RetryPolicy:           retryPolicy,
+		}, continueAsNewWfName)
+	}
+
+	dc := iconverter.NewTestDataConverter()
+	s := &WorkflowTestSuite{}
+	wfEnv := s.NewTestWorkflowEnvironment()
+	wfEnv.SetDataConverter(dc)
+	wfEnv.RegisterWorkflowWithOptions(continueAsNewWorkflowFn, RegisterWorkflowOptions{
+		Name: continueAsNewWfName,
+	})
+	require.NoError(t, wfEnv.SetSearchAttributesOnStart(map[string]interface{}{"CustomKeywordField": "current"}))
+	wfEnv.ExecuteWorkflow(continueAsNewWorkflowFn)
+	err := wfEnv.GetWorkflowError()
+
+	require.Error(t, err)
+	var continueAsNewErr *ContinueAsNewError
+	require.True(t, errors.As(err, &continueAsNewErr))
+	require.Equal(t, continueAsNewWfName, continueAsNewErr.WorkflowType.Name)
+	require.Equal(t, "new-task-queue", continueAsNewErr.TaskQueueName)
+	require.Equal(t, time.Hour, continueAsNewErr.WorkflowRunTimeout)
+	require.Equal(t, retryPolicy, continueAsNewErr.RetryPolicy)
+
+	// memo is encoded with the data converter of the workflow
+	var description string
+	require.NoError(t, dc.FromPayload(continueAsNewErr.Memo.Fields["Description"], &description))
+	require.Equal(t, "next run", description)
+	require.Error(t, converter.GetDefaultDataConverter().FromPayload(continueAsNewErr.Memo.Fields["Description"], &description))
+	searchAttributes := NewSearchAttributesFromProto(continueAsNewErr.SearchAttributes)
+	require.Equal(t, 1, searchAttributes.Size())
+	intValue, ok := searchAttributes.GetInt64(NewSearchAttributeKeyInt64("CustomIntField"))
+	require.True(t, ok)
+	require.Equal(t, int64(2), intValue)
+}
+
 type coolError struct{}
 
 func (e coolError) Error() string {
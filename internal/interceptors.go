@@ -78,11 +78,13 @@ type WorkflowOutboundCallsInterceptor interface {
 	RequestCancelExternalWorkflow(ctx Context, workflowID, runID string) Future
 	SignalExternalWorkflow(ctx Context, workflowID, runID, signalName string, arg interface{}) Future
 	UpsertSearchAttributes(ctx Context, attributes map[string]interface{}) error
+	UpsertMemo(ctx Context, memo map[string]interface{}) error
 	GetSignalChannel(ctx Context, signalName string) ReceiveChannel
 	SideEffect(ctx Context, f func(ctx Context) interface{}) converter.EncodedValue
 	MutableSideEffect(ctx Context, id string, f func(ctx Context) interface{}, equals func(a, b interface{}) bool) converter.EncodedValue
 	GetVersion(ctx Context, changeID string, minSupported, maxSupported Version) Version
 	SetQueryHandler(ctx Context, queryType string, handler interface{}) error
+	SetSignalHandler(ctx Context, signalName string, handler interface{}) error
 	IsReplaying(ctx Context) bool
 	HasLastCompletionResult(ctx Context) bool
 	GetLastCompletionResult(ctx Context, d ...interface{}) error
@@ -179,6 +181,11 @@ func (t *WorkflowOutboundCallsInterceptorBase) UpsertSearchAttributes(ctx Contex
 	return t.Next.UpsertSearchAttributes(ctx, attributes)
 }
 
+// UpsertMemo forwards to t.Next
+func (t *WorkflowOutboundCallsInterceptorBase) UpsertMemo(ctx Context, memo map[string]interface{}) error {
+	return t.Next.UpsertMemo(ctx, memo)
+}
+
 // GetSignalChannel forwards to t.Next
 func (t *WorkflowOutboundCallsInterceptorBase) GetSignalChannel(ctx Context, signalName string) ReceiveChannel {
 	return t.Next.GetSignalChannel(ctx, signalName)
@@ -204,6 +211,11 @@ func (t *WorkflowOutboundCallsInterceptorBase) SetQueryHandler(ctx Context, quer
 	return t.Next.SetQueryHandler(ctx, queryType, handler)
 }
 
+// SetSignalHandler forwards to t.Next
+func (t *WorkflowOutboundCallsInterceptorBase) SetSignalHandler(ctx Context, signalName string, handler interface{}) error {
+	return t.Next.SetSignalHandler(ctx, signalName, handler)
+}
+
 // IsReplaying forwards to t.Next
 func (t *WorkflowOutboundCallsInterceptorBase) IsReplaying(ctx Context) bool {
 	return t.Next.IsReplaying(ctx)
@@ -34,6 +34,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
 
 	"go.temporal.io/sdk/converter"
 )
@@ -61,6 +62,19 @@ func requireNoExecuteErr(t *testing.T, err error) {
 	}
 }
 
+func createNewDebugDispatcher(f func(ctx Context)) dispatcher {
+	env := new(WorkflowUnitTest).NewTestWorkflowEnvironment()
+	env.SetWorkerOptions(WorkerOptions{EnableCoroutineDebugMode: true})
+	interceptor, err := newWorkflowInterceptors(env.impl, env.impl.GetRegistry().getInterceptors())
+	if err != nil {
+		panic(err)
+	}
+	ctx := newWorkflowContext(env.impl, interceptor.outboundInterceptor, interceptor)
+	result, _ := newDispatcher(ctx, interceptor, f)
+	result.interceptor = interceptor
+	return result
+}
+
 func TestDispatcher(t *testing.T) {
 	value := "foo"
 	d := createNewDispatcher(func(ctx Context) { value = "bar" })
@@ -820,6 +834,290 @@ func TestAwaitWithTimeoutCancellation(t *testing.T) {
 	require.True(t, ok)
 }
 
+func TestMutex(t *testing.T) {
+	var history []string
+	var mutex Mutex
+	d := createNewDispatcher(func(ctx Context) {
+		mutex = NewMutex(ctx)
+		ch := NewChannel(ctx)
+		for i := 1; i <= 3; i++ {
+			ii := i
+			Go(ctx, func(ctx Context) {
+				require.NoError(t, mutex.Lock(ctx))
+				history = append(history, fmt.Sprintf("lock-%v", ii))
+				ch.Receive(ctx, nil)
+				history = append(history, fmt.Sprintf("unlock-%v", ii))
+				mutex.Unlock()
+			})
+		}
+		ch.Send(ctx, nil)
+		require.False(t, mutex.TryLock(ctx))
+		ch.Send(ctx, nil)
+		ch.Send(ctx, nil)
+		_ = Await(ctx, func() bool { return len(history) == 6 })
+		require.False(t, mutex.IsLocked())
+		require.True(t, mutex.TryLock(ctx))
+		mutex.Unlock()
+	})
+	defer d.Close()
+	requireNoExecuteErr(t, d.ExecuteUntilAllBlocked(defaultDeadlockDetectionTimeout))
+	require.True(t, d.IsDone())
+	require.Equal(t, []string{"lock-1", "unlock-1", "lock-2", "unlock-2", "lock-3", "unlock-3"}, history)
+	require.Panics(t, mutex.Unlock)
+}
+
+func TestSemaphore(t *testing.T) {
+	var history []string
+	d := createNewDispatcher(func(ctx Context) {
+		sem := NewSemaphore(ctx, 2)
+		require.Error(t, sem.Acquire(ctx, 3))
+		ch := NewChannel(ctx)
+		for i := 1; i <= 3; i++ {
+			ii := i
+			Go(ctx, func(ctx Context) {
+				require.NoError(t, sem.Acquire(ctx, 1))
+				history = append(history, fmt.Sprintf("acquire-%v", ii))
+				ch.Receive(ctx, nil)
+				sem.Release(1)
+			})
+		}
+		// waiters are served in order, request for 2 permits blocks following request for 1 permit
+		Go(ctx, func(ctx Context) {
+			require.NoError(t, sem.Acquire(ctx, 2))
+			history = append(history, "acquire-two")
+			sem.Release(2)
+		})
+		ch.Send(ctx, nil)
+		require.False(t, sem.TryAcquire(ctx, 1))
+		ch.Send(ctx, nil)
+		ch.Send(ctx, nil)
+		_ = Await(ctx, func() bool { return len(history) == 4 })
+		require.True(t, sem.TryAcquire(ctx, 2))
+		require.Panics(t, func() { sem.Release(3) })
+	})
+	defer d.Close()
+	requireNoExecuteErr(t, d.ExecuteUntilAllBlocked(defaultDeadlockDetectionTimeout))
+	require.True(t, d.IsDone())
+	require.Equal(t, []string{"acquire-1", "acquire-2", "acquire-3", "acquire-two"}, history)
+}
+
+func TestSemaphoreInvalidPermits(t *testing.T) {
+	d := createNewDispatcher(func(ctx Context) {
+		sem := NewSemaphore(ctx, 2)
+		require.Error(t, sem.Acquire(ctx, 0))
+		require.Error(t, sem.Acquire(ctx, -1))
+		require.Error(t, sem.Acquire(ctx, 3))
+		require.False(t, sem.TryAcquire(ctx, 0))
+		require.False(t, sem.TryAcquire(ctx, -1))
+		require.False(t, sem.TryAcquire(ctx, 3))
+		require.NoError(t, sem.Acquire(ctx, 1))
+		require.Panics(t, func() { sem.Release(0) })
+		require.Panics(t, func() { sem.Release(-1) })
+		// permits are not corrupted by invalid calls
+		require.True(t, sem.TryAcquire(ctx, 1))
+		require.False(t, sem.TryAcquire(ctx, 1))
+		sem.Release(2)
+		require.True(t, sem.TryAcquire(ctx, 2))
+	})
+	defer d.Close()
+	requireNoExecuteErr(t, d.ExecuteUntilAllBlocked(defaultDeadlockDetectionTimeout))
+	require.True(t, d.IsDone())
+}
+
+func TestSemaphoreCancellation(t *testing.T) {
+	var acquireErr error
+	acquiredAfterCancel := false
+	d := createNewDispatcher(func(ctx Context) {
+		sem := NewSemaphore(ctx, 1)
+		require.NoError(t, sem.Acquire(ctx, 1))
+		waiting := false
+		childCtx, cancel := WithCancel(ctx)
+		Go(childCtx, func(ctx Context) {
+			waiting = true
+			acquireErr = sem.Acquire(ctx, 1)
+		})
+		_ = Await(ctx, func() bool { return waiting })
+		cancel()
+		_ = Await(ctx, func() bool { return acquireErr != nil })
+		sem.Release(1)
+		// canceled waiter doesn't hold permits
+		acquiredAfterCancel = sem.TryAcquire(ctx, 1)
+	})
+	defer d.Close()
+	requireNoExecuteErr(t, d.ExecuteUntilAllBlocked(defaultDeadlockDetectionTimeout))
+	require.True(t, d.IsDone())
+	var canceledErr *CanceledError
+	require.True(t, errors.As(acquireErr, &canceledErr))
+	require.True(t, acquiredAfterCancel)
+}
+
+func TestErrGroup(t *testing.T) {
+	var history []string
+	var waitErr error
+	d := createNewDispatcher(func(ctx Context) {
+		group := NewErrGroup(ctx)
+		ch := NewChannel(ctx)
+		group.Go(func(ctx Context) error {
+			history = append(history, "first-start")
+			ch.Receive(ctx, nil)
+			history = append(history, "first-failed")
+			return errors.New("first")
+		})
+		group.Go(func(ctx Context) error {
+			history = append(history, "second-start")
+			// blocks until canceled by the failure of the first function
+			ctx.Done().Receive(ctx, nil)
+			history = append(history, "second-canceled")
+			return ctx.Err()
+		})
+		_ = Await(ctx, func() bool { return len(history) == 2 })
+		ch.Send(ctx, nil)
+		waitErr = group.Wait(ctx)
+	})
+	defer d.Close()
+	requireNoExecuteErr(t, d.ExecuteUntilAllBlocked(defaultDeadlockDetectionTimeout))
+	require.True(t, d.IsDone(), d.StackTrace())
+	require.EqualError(t, waitErr, "first")
+	require.Equal(t, []string{"first-start", "second-start", "first-failed", "second-canceled"}, history)
+}
+
+func TestErrGroupLimit(t *testing.T) {
+	var history []string
+	var waitErr error
+	d := createNewDispatcher(func(ctx Context) {
+		group := NewErrGroup(ctx)
+		group.SetLimit(2)
+		ch := NewChannel(ctx)
+		running, maxRunning := 0, 0
+		for i := 1; i <= 4; i++ {
+			ii := i
+			group.Go(func(ctx Context) error {
+				running++
+				if running > maxRunning {
+					maxRunning = running
+				}
+				history = append(history, fmt.Sprintf("start-%v", ii))
+				ch.Receive(ctx, nil)
+				running--
+				return nil
+			})
+		}
+		for i := 0; i < 4; i++ {
+			ch.Send(ctx, nil)
+		}
+		waitErr = group.Wait(ctx)
+		require.Equal(t, 2, maxRunning)
+	})
+	defer d.Close()
+	requireNoExecuteErr(t, d.ExecuteUntilAllBlocked(defaultDeadlockDetectionTimeout))
+	require.True(t, d.IsDone(), d.StackTrace())
+	require.NoError(t, waitErr)
+	require.Equal(t, []string{"start-1", "start-2", "start-3", "start-4"}, history)
+}
+
+func TestDispatcherDebugMode(t *testing.T) {
+	var history []string
+	d := createNewDebugDispatcher(func(ctx Context) {
+		c := NewChannel(ctx)
+		Go(ctx, func(ctx Context) {
+			c.Send(ctx, "child")
+		})
+		var v string
+		c.Receive(ctx, &v)
+		history = append(history, v)
+		_ = Sleep(ctx, 0)
+		history = append(history, "root")
+	})
+	defer d.Close()
+	requireNoExecuteErr(t, d.ExecuteUntilAllBlocked(defaultDeadlockDetectionTimeout))
+	require.True(t, d.IsDone())
+	require.Equal(t, []string{"child", "root"}, history)
+}
+
+func TestDispatcherDebugModeNativeGoroutine(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+	d := createNewDebugDispatcher(func(ctx Context) {
+		go func() {
+			<-done
+		}()
+		_ = Await(ctx, func() bool { return false })
+	})
+	defer d.Close()
+	err := d.ExecuteUntilAllBlocked(defaultDeadlockDetectionTimeout)
+	require.Error(t, err)
+	require.IsType(t, (*workflowPanicError)(nil), err)
+	require.Contains(t, err.Error(), `workflow coroutine "root" started native goroutine`)
+	require.Contains(t, err.(*workflowPanicError).StackTrace(), "TestDispatcherDebugModeNativeGoroutine")
+}
+
+func TestDispatcherDebugModeNativeGoroutineOfClosedCoroutine(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+	d := createNewDebugDispatcher(func(ctx Context) {
+		Go(ctx, func(ctx Context) {
+			go func() {
+				<-done
+			}()
+		})
+		_ = Await(ctx, func() bool { return false })
+	})
+	defer d.Close()
+	err := d.ExecuteUntilAllBlocked(defaultDeadlockDetectionTimeout)
+	require.Error(t, err)
+	require.IsType(t, (*workflowPanicError)(nil), err)
+	require.Contains(t, err.Error(), `workflow coroutine "2" started native goroutine`)
+	require.Contains(t, err.(*workflowPanicError).StackTrace(), "TestDispatcherDebugModeNativeGoroutineOfClosedCoroutine")
+}
+
+func TestDispatcherDebugModeNativeBlocking(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+	d := createNewDebugDispatcher(func(ctx Context) {
+		Go(ctx, func(ctx Context) {
+			<-done
+		})
+		_ = Await(ctx, func() bool { return false })
+	})
+	defer d.Close()
+	err := d.ExecuteUntilAllBlocked(defaultDeadlockDetectionTimeout)
+	require.Error(t, err)
+	require.IsType(t, (*workflowPanicError)(nil), err)
+	require.Contains(t, err.Error(), `workflow coroutine "2" is blocked on chan receive outside of dispatcher control`)
+	require.Contains(t, err.(*workflowPanicError).StackTrace(), "TestDispatcherDebugModeNativeBlocking")
+}
+
+func TestDispatcherDebugModeNativeBlockingExit(t *testing.T) {
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	var resumed, panicked atomic.Bool
+	d := createNewDebugDispatcher(func(ctx Context) {
+		Go(ctx, func(ctx Context) {
+			defer close(exited)
+			defer func() {
+				panicked.Store(recover() != nil)
+			}()
+			<-done
+			// the goroutine exits when it calls the SDK after the dispatcher detached it
+			_ = Sleep(ctx, time.Minute)
+			resumed.Store(true)
+		})
+		_ = Await(ctx, func() bool { return false })
+	})
+	defer d.Close()
+	err := d.ExecuteUntilAllBlocked(defaultDeadlockDetectionTimeout)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `workflow coroutine "2" is blocked on chan receive outside of dispatcher control`)
+	close(done)
+	select {
+	case <-exited:
+	case <-time.After(time.Second):
+		require.Fail(t, "detached coroutine didn't exit")
+	}
+	require.False(t, resumed.Load())
+	require.False(t, panicked.Load())
+}
+
 func TestFutureSetValue(t *testing.T) {
 	var history []string
 	var f Future
@@ -190,6 +190,7 @@ const (
 	versionMarkerName           = "Version"
 	localActivityMarkerName     = "LocalActivity"
 	mutableSideEffectMarkerName = "MutableSideEffect"
+	upsertMemoMarkerName        = "UpsertMemo"
 
 	sideEffectMarkerIDName      = "side-effect-id"
 	sideEffectMarkerDataName    = "data"
@@ -197,6 +198,7 @@ const (
 	versionMarkerDataName       = "version"
 	localActivityMarkerDataName = "data"
 	localActivityResultName     = "result"
+	upsertMemoMarkerDataName    = "data"
 )
 
 func (d commandState) String() string {
@@ -1031,6 +1033,25 @@ func (h *commandsHelper) recordMutableSideEffectMarker(mutableSideEffectID strin
 	return command
 }
 
+func (h *commandsHelper) recordUpsertMemoMarker(upsertID string, memo *commonpb.Memo, dc converter.DataConverter) commandStateMachine {
+	markerID := fmt.Sprintf("%v_%v", upsertMemoMarkerName, upsertID)
+
+	memoPayload, err := dc.ToPayloads(memo)
+	if err != nil {
+		panic(err)
+	}
+
+	attributes := &commandpb.RecordMarkerCommandAttributes{
+		MarkerName: upsertMemoMarkerName,
+		Details: map[string]*commonpb.Payloads{
+			upsertMemoMarkerDataName: memoPayload,
+		},
+	}
+	command := h.newMarkerCommandStateMachine(markerID, attributes)
+	h.addCommand(command)
+	return command
+}
+
 func (h *commandsHelper) startChildWorkflowExecution(attributes *commandpb.StartChildWorkflowExecutionCommandAttributes) commandStateMachine {
 	command := h.newChildWorkflowCommandStateMachine(attributes)
 	h.addCommand(command)
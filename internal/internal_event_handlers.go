@@ -116,6 +116,11 @@ type (
 
 		sideEffectCounterID int64
 
+		// Seed of the random generators created by workflow code. It is recorded as a side effect marker when
+		// workflow code needs it the first time, and recorded again after reset.
+		randomSeed         int64
+		randomSeedRecorded bool
+
 		currentReplayTime time.Time // Indicates current replay time of the command.
 		currentLocalTime  time.Time // Local time when currentReplayTime was updated.
 
@@ -134,6 +139,7 @@ type (
 		contextPropagators       []ContextPropagator
 		tracer                   opentracing.Tracer
 		deadlockDetectionTimeout time.Duration
+		coroutineDebugMode       bool
 	}
 
 	localActivityTask struct {
@@ -180,6 +186,7 @@ func newWorkflowExecutionEventHandler(
 	contextPropagators []ContextPropagator,
 	tracer opentracing.Tracer,
 	deadlockDetectionTimeout time.Duration,
+	coroutineDebugMode bool,
 ) workflowExecutionEventHandler {
 	context := &workflowEnvironmentImpl{
 		workflowInfo:             workflowInfo,
@@ -197,6 +204,7 @@ func newWorkflowExecutionEventHandler(
 		contextPropagators:       contextPropagators,
 		tracer:                   tracer,
 		deadlockDetectionTimeout: deadlockDetectionTimeout,
+		coroutineDebugMode:       coroutineDebugMode,
 	}
 	context.logger = ilog.NewReplayLogger(
 		log.With(logger,
@@ -332,6 +340,50 @@ func (wc *workflowEnvironmentImpl) UpsertSearchAttributes(attributes map[string]
 	return nil
 }
 
+func (wc *workflowEnvironmentImpl) GetRandomSeed() int64 {
+	if !wc.randomSeedRecorded {
+		wc.randomSeed = newRecordedRandomSeed(wc.SideEffect, wc.GetDataConverter())
+		wc.randomSeedRecorded = true
+	}
+	return wc.randomSeed
+}
+
+func (wc *workflowEnvironmentImpl) UpsertMemo(memo map[string]interface{}) error {
+	// This has to be used in WorkflowEnvironment implementations instead of in Workflow for testsuite mock purpose.
+	memoProto, err := validateAndSerializeMemo(memo, wc.dataConverter)
+	if err != nil {
+		return err
+	}
+
+	wc.commandsHelper.recordUpsertMemoMarker(wc.GenerateSequenceID(), memoProto, wc.dataConverter)
+	wc.workflowInfo.Memo = mergeMemo(wc.workflowInfo.Memo, memoProto) // this is for getInfo correctness
+	return nil
+}
+
+func validateAndSerializeMemo(memo map[string]interface{}, dc converter.DataConverter) (*commonpb.Memo, error) {
+	if len(memo) == 0 {
+		return nil, errMemoNotSet
+	}
+	return getWorkflowMemo(memo, dc)
+}
+
+func mergeMemo(current, upsert *commonpb.Memo) *commonpb.Memo {
+	if current == nil || len(current.Fields) == 0 {
+		if upsert == nil || len(upsert.Fields) == 0 {
+			return nil
+		}
+		current = &commonpb.Memo{
+			Fields: make(map[string]*commonpb.Payload),
+		}
+	}
+
+	fields := current.Fields
+	for k, v := range upsert.GetFields() {
+		fields[k] = v
+	}
+	return current
+}
+
 func (wc *workflowEnvironmentImpl) updateWorkflowInfoWithSearchAttributes(attributes *commonpb.SearchAttributes) {
 	wc.workflowInfo.SearchAttributes = mergeSearchAttributes(wc.workflowInfo.SearchAttributes, attributes)
 }
@@ -763,6 +815,10 @@ func (wc *workflowEnvironmentImpl) GetRegistry() *registry {
 	return wc.registry
 }
 
+func (wc *workflowEnvironmentImpl) IsCoroutineDebugModeEnabled() bool {
+	return wc.coroutineDebugMode
+}
+
 func (weh *workflowExecutionEventHandlerImpl) ProcessEvent(
 	event *historypb.HistoryEvent,
 	isReplay bool,
@@ -774,6 +830,16 @@ func (weh *workflowExecutionEventHandlerImpl) ProcessEvent(
 	defer func() {
 		if p := recover(); p != nil {
 			weh.metricsScope.Counter(metrics.WorkflowTaskExecutionFailureCounter).Inc(1)
+			// illegal command state transition while replaying history means that workflow code doesn't produce
+			// the commands recorded in the history
+			if illegalState, ok := p.(stateMachineIllegalStatePanic); ok && isReplay {
+				ndErr := newNonDeterminismError("nondeterministic workflow: "+illegalState.message, event, nil)
+				if weh.workflowDefinition != nil {
+					ndErr.stackTrace = weh.StackTrace()
+				}
+				weh.Complete(nil, ndErr)
+				return
+			}
 			topLine := fmt.Sprintf("process event for %s [panic]:", weh.workflowInfo.TaskQueueName)
 			st := getStackTraceRaw(topLine, 7, 0)
 			weh.Complete(nil, newWorkflowPanicError(p, st))
@@ -809,7 +875,11 @@ func (weh *workflowExecutionEventHandlerImpl) ProcessEvent(
 	case enumspb.EVENT_TYPE_WORKFLOW_TASK_TIMED_OUT:
 		// No Operation
 	case enumspb.EVENT_TYPE_WORKFLOW_TASK_FAILED:
-		// No Operation
+		// Only the workflow task failed by reset is delivered here, see history.nextCommandEvents.
+		if isResetWorkflowTaskFailedEvent(event) {
+			// the reset run records a new seed
+			weh.randomSeedRecorded = false
+		}
 	case enumspb.EVENT_TYPE_WORKFLOW_TASK_COMPLETED:
 		// No Operation
 	case enumspb.EVENT_TYPE_ACTIVITY_TASK_SCHEDULED:
@@ -1130,6 +1200,11 @@ func (weh *workflowExecutionEventHandlerImpl) handleMarkerRecorded(
 					weh.mutableSideEffect[sideEffectID] = sideEffectData
 				}
 			}
+		case upsertMemoMarkerName:
+			// Memo is applied to workflow info when workflow code calls UpsertMemo, marker only records it in history.
+			if _, ok := attributes.GetDetails()[upsertMemoMarkerDataName]; !ok {
+				err = fmt.Errorf("key %q: %w", upsertMemoMarkerDataName, ErrMissingMarkerDataKey)
+			}
 		default:
 			err = ErrUnknownMarkerName
 		}
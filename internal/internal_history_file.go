@@ -0,0 +1,345 @@
+// The MIT License
+//
+// Copyright (c) 2020 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/gogo/protobuf/jsonpb"
+	"github.com/gogo/protobuf/proto"
+	enumspb "go.temporal.io/api/enums/v1"
+	historypb "go.temporal.io/api/history/v1"
+)
+
+// HistoryFileFormat is the encoding of a workflow history file.
+type HistoryFileFormat int
+
+const (
+	// HistoryFileFormatJSON is a single proto JSON encoded History document, as downloaded from the CLI or UI.
+	// Used for files with any extension not listed below.
+	HistoryFileFormatJSON HistoryFileFormat = iota
+	// HistoryFileFormatNDJSON is a stream of proto JSON encoded history events, one event per line.
+	// Used for files with .ndjson and .jsonl extensions.
+	HistoryFileFormatNDJSON
+	// HistoryFileFormatBinary is a binary protobuf encoded History.
+	// Used for files with .pb and .binpb extensions.
+	HistoryFileFormatBinary
+)
+
+const (
+	gzipFileExtension = ".gz"
+
+	// historyEventsFieldKey is the protobuf key of the History.events field: field number 1, length delimited.
+	historyEventsFieldKey = 1<<3 | 2
+
+	// maxBinaryHistoryEventSize limits the size of an event read from a binary history file. Events larger than the
+	// default gRPC message limit can't be received from the server, so a larger size means a corrupted file.
+	maxBinaryHistoryEventSize = defaultMaxPayloadSize
+)
+
+type (
+	// historyEventReader reads history events one by one from a history file. It returns io.EOF after the last event.
+	historyEventReader interface {
+		Read() (*historypb.HistoryEvent, error)
+	}
+
+	jsonHistoryEventReader struct {
+		events []*historypb.HistoryEvent
+	}
+
+	ndjsonHistoryEventReader struct {
+		reader *bufio.Reader
+	}
+
+	binaryHistoryEventReader struct {
+		reader *bufio.Reader
+	}
+
+	// historyEventWriter writes history events one by one in the given format. Close must be called after the last
+	// event to complete the document. It doesn't close the underlying writer.
+	historyEventWriter struct {
+		writer    *bufio.Writer
+		format    HistoryFileFormat
+		marshaler jsonpb.Marshaler
+		count     int
+	}
+)
+
+// ExportWorkflowHistory writes the full history of the given workflow execution, loaded with Client.GetWorkflowHistory,
+// to the writer in the given format. Events are written as they are received, without loading the whole history
+// into memory. Replaying a HistoryFileFormatJSON file still decodes the whole document at once, so prefer
+// HistoryFileFormatNDJSON or HistoryFileFormatBinary for large histories.
+func ExportWorkflowHistory(ctx context.Context, client Client, workflowID string, runID string, writer io.Writer, format HistoryFileFormat) error {
+	iter := client.GetWorkflowHistory(ctx, workflowID, runID, false, enumspb.HISTORY_EVENT_FILTER_TYPE_ALL_EVENT)
+	historyWriter := newHistoryEventWriter(writer, format)
+	for iter.HasNext() {
+		event, err := iter.Next()
+		if err != nil {
+			return err
+		}
+		if err := historyWriter.Write(event); err != nil {
+			return err
+		}
+	}
+	return historyWriter.Close()
+}
+
+// ExportWorkflowHistoryToFile writes the full history of the given workflow execution to a file that can be replayed
+// with WorkflowReplayer. The format is chosen by the file name extension, see HistoryFileFormat, and the file is
+// gzip compressed if the name ends with .gz.
+func ExportWorkflowHistoryToFile(ctx context.Context, client Client, workflowID string, runID string, fileName string) (err error) {
+	format, compressed := historyFileFormat(fileName)
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	if !compressed {
+		return ExportWorkflowHistory(ctx, client, workflowID, runID, file, format)
+	}
+
+	gzipWriter := gzip.NewWriter(file)
+	if err := ExportWorkflowHistory(ctx, client, workflowID, runID, gzipWriter, format); err != nil {
+		return err
+	}
+	return gzipWriter.Close()
+}
+
+// historyFileFormat returns the format of the history file and whether it is gzip compressed based on its name.
+func historyFileFormat(fileName string) (HistoryFileFormat, bool) {
+	name := strings.ToLower(fileName)
+	compressed := strings.HasSuffix(name, gzipFileExtension)
+	name = strings.TrimSuffix(name, gzipFileExtension)
+	switch {
+	case strings.HasSuffix(name, ".ndjson"), strings.HasSuffix(name, ".jsonl"):
+		return HistoryFileFormatNDJSON, compressed
+	case strings.HasSuffix(name, ".pb"), strings.HasSuffix(name, ".binpb"):
+		return HistoryFileFormatBinary, compressed
+	default:
+		return HistoryFileFormatJSON, compressed
+	}
+}
+
+// isHistoryFileName returns true if the file name has one of the history file extensions.
+func isHistoryFileName(fileName string) bool {
+	name := strings.TrimSuffix(strings.ToLower(fileName), gzipFileExtension)
+	for _, ext := range []string{".json", ".ndjson", ".jsonl", ".pb", ".binpb"} {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// extractHistoryFromFile reads the history file in the format chosen by its name up to lastEventID(inclusive).
+func extractHistoryFromFile(fileName string, lastEventID int64) (*historypb.History, error) {
+	format, compressed := historyFileFormat(fileName)
+	return extractHistoryFromFileWithFormat(fileName, format, compressed, lastEventID)
+}
+
+// extractHistoryFromJSONFile reads the uncompressed proto JSON history file up to lastEventID(inclusive) regardless
+// of its name.
+func extractHistoryFromJSONFile(fileName string, lastEventID int64) (*historypb.History, error) {
+	return extractHistoryFromFileWithFormat(fileName, HistoryFileFormatJSON, false, lastEventID)
+}
+
+func extractHistoryFromFileWithFormat(fileName string, format HistoryFileFormat, compressed bool, lastEventID int64) (*historypb.History, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+
+	var reader io.Reader = file
+	if compressed {
+		gzipReader, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = gzipReader.Close() }()
+		reader = gzipReader
+	}
+
+	eventReader, err := newHistoryEventReader(reader, format)
+	if err != nil {
+		return nil, err
+	}
+
+	// Caller is potentially asking for subset of history instead of all history events
+	history := &historypb.History{}
+	for {
+		event, err := eventReader.Read()
+		if err == io.EOF {
+			return history, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		history.Events = append(history.Events, event)
+		if lastEventID > 0 && event.GetEventId() == lastEventID {
+			return history, nil
+		}
+	}
+}
+
+func newHistoryEventReader(reader io.Reader, format HistoryFileFormat) (historyEventReader, error) {
+	switch format {
+	case HistoryFileFormatNDJSON:
+		return &ndjsonHistoryEventReader{reader: bufio.NewReader(reader)}, nil
+	case HistoryFileFormatBinary:
+		return &binaryHistoryEventReader{reader: bufio.NewReader(reader)}, nil
+	default:
+		var history historypb.History
+		if err := jsonpb.Unmarshal(reader, &history); err != nil {
+			return nil, err
+		}
+		return &jsonHistoryEventReader{events: history.Events}, nil
+	}
+}
+
+func (r *jsonHistoryEventReader) Read() (*historypb.HistoryEvent, error) {
+	if len(r.events) == 0 {
+		return nil, io.EOF
+	}
+	event := r.events[0]
+	r.events = r.events[1:]
+	return event, nil
+}
+
+func (r *ndjsonHistoryEventReader) Read() (*historypb.HistoryEvent, error) {
+	for {
+		line, err := r.reader.ReadBytes('\n')
+		if err != nil && (err != io.EOF || len(line) == 0) {
+			return nil, err
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		event := &historypb.HistoryEvent{}
+		if err := jsonpb.Unmarshal(bytes.NewReader(line), event); err != nil {
+			return nil, err
+		}
+		return event, nil
+	}
+}
+
+func (r *binaryHistoryEventReader) Read() (*historypb.HistoryEvent, error) {
+	key, err := binary.ReadUvarint(r.reader)
+	if err != nil {
+		return nil, err
+	}
+	if key != historyEventsFieldKey {
+		return nil, fmt.Errorf("unexpected protobuf key %d in binary history", key)
+	}
+	size, err := binary.ReadUvarint(r.reader)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if size > maxBinaryHistoryEventSize {
+		return nil, fmt.Errorf("binary history event size %d exceeds the limit of %d bytes", size, maxBinaryHistoryEventSize)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r.reader, data); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	event := &historypb.HistoryEvent{}
+	if err := proto.Unmarshal(data, event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func newHistoryEventWriter(writer io.Writer, format HistoryFileFormat) *historyEventWriter {
+	return &historyEventWriter{writer: bufio.NewWriter(writer), format: format}
+}
+
+func (w *historyEventWriter) Write(event *historypb.HistoryEvent) error {
+	defer func() { w.count++ }()
+	switch w.format {
+	case HistoryFileFormatNDJSON:
+		if err := w.marshaler.Marshal(w.writer, event); err != nil {
+			return err
+		}
+		return w.writer.WriteByte('\n')
+	case HistoryFileFormatBinary:
+		data, err := proto.Marshal(event)
+		if err != nil {
+			return err
+		}
+		var header [2 * binary.MaxVarintLen64]byte
+		n := binary.PutUvarint(header[:], historyEventsFieldKey)
+		n += binary.PutUvarint(header[n:], uint64(len(data)))
+		if _, err := w.writer.Write(header[:n]); err != nil {
+			return err
+		}
+		_, err = w.writer.Write(data)
+		return err
+	default:
+		separator := ","
+		if w.count == 0 {
+			separator = `{"events":[`
+		}
+		if _, err := w.writer.WriteString(separator); err != nil {
+			return err
+		}
+		return w.marshaler.Marshal(w.writer, event)
+	}
+}
+
+func (w *historyEventWriter) Close() error {
+	if w.format == HistoryFileFormatJSON {
+		trailer := "]}"
+		if w.count == 0 {
+			trailer = `{"events":[]}`
+		}
+		if _, err := w.writer.WriteString(trailer); err != nil {
+			return err
+		}
+	}
+	return w.writer.Flush()
+}
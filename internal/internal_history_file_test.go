@@ -0,0 +1,169 @@
+// The MIT License
+//
+// Copyright (c) 2020 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package internal
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	historypb "go.temporal.io/api/history/v1"
+	"go.temporal.io/api/workflowservice/v1"
+	"go.temporal.io/api/workflowservicemock/v1"
+)
+
+func writeTestHistoryFile(t *testing.T, fileName string, history *historypb.History) {
+	format, compressed := historyFileFormat(fileName)
+	file, err := os.Create(fileName)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, file.Close()) }()
+
+	var writer io.Writer = file
+	if compressed {
+		gzipWriter := gzip.NewWriter(file)
+		defer func() { require.NoError(t, gzipWriter.Close()) }()
+		writer = gzipWriter
+	}
+	historyWriter := newHistoryEventWriter(writer, format)
+	for _, event := range history.Events {
+		require.NoError(t, historyWriter.Write(event))
+	}
+	require.NoError(t, historyWriter.Close())
+}
+
+func TestHistoryFileFormats(t *testing.T) {
+	history, err := extractHistoryFromFile(filepath.Join("..", "test", "replaytests", "workflow1.json"), 0)
+	require.NoError(t, err)
+	require.True(t, len(history.Events) > 5)
+
+	dir := t.TempDir()
+	for _, name := range []string{"h.json", "h.json.gz", "h.ndjson", "h.jsonl.gz", "h.pb", "h.binpb.gz"} {
+		t.Run(name, func(t *testing.T) {
+			fileName := filepath.Join(dir, name)
+			writeTestHistoryFile(t, fileName, history)
+			require.True(t, isHistoryFileName(fileName))
+
+			result, err := extractHistoryFromFile(fileName, 0)
+			require.NoError(t, err)
+			require.True(t, proto.Equal(history, result))
+
+			result, err = extractHistoryFromFile(fileName, 3)
+			require.NoError(t, err)
+			require.True(t, proto.Equal(&historypb.History{Events: history.Events[:3]}, result))
+		})
+	}
+}
+
+func TestHistoryFileFormat_JSONOnly(t *testing.T) {
+	history, err := extractHistoryFromFile(filepath.Join("..", "test", "replaytests", "workflow1.json"), 0)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	// JSON content is read regardless of the file name
+	jsonFileName := filepath.Join(dir, "h.pb")
+	writeTestHistoryFile(t, filepath.Join(dir, "h.json"), history)
+	require.NoError(t, os.Rename(filepath.Join(dir, "h.json"), jsonFileName))
+	result, err := extractHistoryFromJSONFile(jsonFileName, 0)
+	require.NoError(t, err)
+	require.True(t, proto.Equal(history, result))
+
+	compressedFileName := filepath.Join(dir, "h.json.gz")
+	writeTestHistoryFile(t, compressedFileName, history)
+	_, err = extractHistoryFromJSONFile(compressedFileName, 0)
+	require.Error(t, err)
+}
+
+func TestHistoryFileFormat_Empty(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"h.json", "h.ndjson", "h.pb"} {
+		fileName := filepath.Join(dir, name)
+		writeTestHistoryFile(t, fileName, &historypb.History{})
+
+		result, err := extractHistoryFromFile(fileName, 0)
+		require.NoError(t, err, name)
+		require.Empty(t, result.Events, name)
+	}
+}
+
+func TestHistoryFileFormat_Truncated(t *testing.T) {
+	history := &historypb.History{Events: []*historypb.HistoryEvent{
+		createTestEventWorkflowTaskScheduled(2, &historypb.WorkflowTaskScheduledEventAttributes{}),
+	}}
+	fileName := filepath.Join(t.TempDir(), "h.pb")
+	writeTestHistoryFile(t, fileName, history)
+
+	data, err := os.ReadFile(fileName)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(fileName, data[:len(data)-1], 0644))
+
+	_, err = extractHistoryFromFile(fileName, 0)
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+}
+
+func TestHistoryFileFormat_EventTooLarge(t *testing.T) {
+	var header [2 * binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(header[:], historyEventsFieldKey)
+	n += binary.PutUvarint(header[n:], maxBinaryHistoryEventSize+1)
+	fileName := filepath.Join(t.TempDir(), "h.pb")
+	require.NoError(t, os.WriteFile(fileName, header[:n], 0644))
+
+	_, err := extractHistoryFromFile(fileName, 0)
+	require.EqualError(t, err, fmt.Sprintf("binary history event size %d exceeds the limit of %d bytes",
+		maxBinaryHistoryEventSize+1, maxBinaryHistoryEventSize))
+}
+
+func TestExportWorkflowHistoryToFile(t *testing.T) {
+	history, err := extractHistoryFromFile(filepath.Join("..", "test", "replaytests", "workflow1.json"), 0)
+	require.NoError(t, err)
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	service := workflowservicemock.NewMockWorkflowServiceClient(mockCtrl)
+	service.EXPECT().GetWorkflowExecutionHistory(gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(&workflowservice.GetWorkflowExecutionHistoryResponse{
+			History:       &historypb.History{Events: history.Events[:3]},
+			NextPageToken: []byte("token"),
+		}, nil)
+	service.EXPECT().GetWorkflowExecutionHistory(gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(&workflowservice.GetWorkflowExecutionHistoryResponse{
+			History: &historypb.History{Events: history.Events[3:]},
+		}, nil)
+	client := &WorkflowClient{workflowService: service, namespace: DefaultNamespace}
+
+	fileName := filepath.Join(t.TempDir(), "history.ndjson.gz")
+	require.NoError(t, ExportWorkflowHistoryToFile(context.Background(), client, "wid", "rid", fileName))
+
+	result, err := extractHistoryFromFile(fileName, 0)
+	require.NoError(t, err)
+	require.True(t, proto.Equal(history, result))
+}
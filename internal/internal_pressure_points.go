@@ -25,7 +25,9 @@
 package internal
 
 import (
+	"encoding/binary"
 	"errors"
+	"hash/fnv"
 	"math/rand"
 	"strconv"
 	"time"
@@ -35,7 +37,8 @@ import (
 	"go.temporal.io/sdk/log"
 )
 
-// ** This is for internal stress testing framework **
+// Pressure points inject faults at well known points of workflow execution. They are used by the internal stress
+// testing framework through the worker, and by the chaos mode of TestWorkflowEnvironment (see SetChaosOptions).
 
 // PressurePoints
 const (
@@ -43,8 +46,14 @@ const (
 	pressurePointTypeWorkflowTaskCompleted       = "workflow-task-complete"
 	pressurePointTypeActivityTaskScheduleTimeout = "activity-task-schedule-timeout"
 	pressurePointTypeActivityTaskStartTimeout    = "activity-task-start-timeout"
+	pressurePointTypeActivityFailure             = "activity-failure"
+	pressurePointTypeActivityHeartbeatTimeout    = "activity-heartbeat-timeout"
+	pressurePointTypeActivityDelay               = "activity-delay"
+	pressurePointTypeSignalDuplicate             = "signal-duplicate"
+	pressurePointTypeWorkflowEviction            = "workflow-eviction"
 	pressurePointConfigProbability               = "probability"
 	pressurePointConfigSleep                     = "sleep"
+	pressurePointConfigMaxDelay                  = "max-delay"
 	workerOptionsConfig                          = "worker-options"
 	workerOptionsConfigConcurrentPollRoutineSize = "ConcurrentPollRoutineSize"
 )
@@ -57,6 +66,8 @@ type (
 	pressurePointMgrImpl struct {
 		config map[string]map[string]string
 		logger log.Logger
+		// seed makes pressure points deterministic, see fire().
+		seed *int64
 	}
 )
 
@@ -65,12 +76,17 @@ func newWorkflowWorkerWithPressurePoints(service workflowservice.WorkflowService
 	return newWorkflowWorker(service, params, &pressurePointMgrImpl{config: pressurePoints, logger: params.Logger}, registry)
 }
 
+// newSeededPressurePointMgr returns pressure points that fire deterministically for the given seed.
+func newSeededPressurePointMgr(pressurePoints map[string]map[string]string, seed int64, logger log.Logger) *pressurePointMgrImpl {
+	return &pressurePointMgrImpl{config: pressurePoints, logger: logger, seed: &seed}
+}
+
 func (p *pressurePointMgrImpl) Execute(pressurePointName string) error {
 	if config, ok := p.config[pressurePointName]; ok {
 		// If probability is configured.
 		if value, ok2 := config[pressurePointConfigProbability]; ok2 {
-			if probability, err := strconv.Atoi(value); err == nil {
-				if rand.Int31n(100) < int32(probability) {
+			if probability, err := strconv.ParseFloat(value, 64); err == nil {
+				if rand.Float64()*100 < probability {
 					// Drop the task.
 					p.logger.Debug("pressurePointMgrImpl.Execute drop task.",
 						"PressurePointName", pressurePointName,
@@ -93,3 +109,46 @@ func (p *pressurePointMgrImpl) Execute(pressurePointName string) error {
 	}
 	return nil
 }
+
+// fire returns true if the pressure point fires for the given key, based on its configured probability (in percent).
+// When the pressure points are seeded, the outcome only depends on the seed, the pressure point and the key, so that
+// the same faults are injected on every execution no matter how goroutines are scheduled.
+func (p *pressurePointMgrImpl) fire(pressurePointName, key string) bool {
+	config, ok := p.config[pressurePointName]
+	if !ok {
+		return false
+	}
+	probability, err := strconv.ParseFloat(config[pressurePointConfigProbability], 64)
+	if err != nil || probability <= 0 {
+		return false
+	}
+	if p.random(pressurePointName, key).Float64()*100 >= probability {
+		return false
+	}
+	p.logger.Debug("pressurePointMgrImpl.fire.",
+		"PressurePointName", pressurePointName,
+		"Key", key,
+		"probability", probability)
+	return true
+}
+
+// delay returns a random duration up to the max delay configured for the pressure point.
+func (p *pressurePointMgrImpl) delay(pressurePointName, key string) time.Duration {
+	maxDelay, err := time.ParseDuration(p.config[pressurePointName][pressurePointConfigMaxDelay])
+	if err != nil || maxDelay <= 0 {
+		return 0
+	}
+	return time.Duration(p.random(pressurePointName+"/"+pressurePointConfigMaxDelay, key).Int63n(int64(maxDelay))) + 1
+}
+
+func (p *pressurePointMgrImpl) random(pressurePointName, key string) *rand.Rand {
+	if p.seed == nil {
+		return rand.New(rand.NewSource(rand.Int63()))
+	}
+	h := fnv.New64a()
+	_ = binary.Write(h, binary.LittleEndian, *p.seed)
+	_, _ = h.Write([]byte(pressurePointName))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(key))
+	return rand.New(rand.NewSource(int64(h.Sum64())))
+}
@@ -0,0 +1,320 @@
+// The MIT License
+//
+// Copyright (c) 2020 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/golang/mock/gomock"
+	historypb "go.temporal.io/api/history/v1"
+	workflowpb "go.temporal.io/api/workflow/v1"
+	"go.temporal.io/api/workflowservice/v1"
+	"go.temporal.io/api/workflowservicemock/v1"
+
+	ilog "go.temporal.io/sdk/internal/log"
+	"go.temporal.io/sdk/log"
+)
+
+const defaultMaxConcurrentReplays = 10
+
+type (
+	// ReplayBatchOptions are options for replaying a batch of workflow histories.
+	ReplayBatchOptions struct {
+		// Optional: Maximum number of histories replayed concurrently.
+		// default: 10
+		MaxConcurrentReplays int
+	}
+
+	// ReplayResult is the outcome of replaying a single workflow history.
+	ReplayResult struct {
+		// Source is the file name or "<workflowID>/<runID>" the history was loaded from.
+		Source string
+
+		// Execution is the replayed workflow execution. Empty for histories loaded from files.
+		Execution WorkflowExecution
+
+		// WorkflowType is the workflow type from the WorkflowExecutionStarted event.
+		WorkflowType string
+
+		// FailedEventID is the ID of the history event that didn't match the workflow code or, for other failures,
+		// the ID of the last event of the workflow task being replayed when the replay failed. Zero if the replay
+		// passed or failed before the first workflow task was replayed.
+		FailedEventID int64
+
+		// Error is the replay error, nil if the replay passed.
+		Error error
+	}
+
+	// ReplayReport is the result of replaying a batch of workflow histories.
+	ReplayReport struct {
+		// Results contains one entry per replayed history, in the order the histories were listed.
+		Results []*ReplayResult
+	}
+
+	// replayEventTracker is appended to the workflow interceptor chain during batch replay to find out the last
+	// event of the workflow task being replayed.
+	replayEventTracker struct {
+		info *WorkflowInfo
+	}
+)
+
+// ReplayWorkflowHistoriesFromDirectory replays every history file in the given directory concurrently and returns a
+// report with the outcome of each replay. Files with extensions of any HistoryFileFormat, optionally gzip compressed,
+// are replayed.
+// The logger is an optional parameter. Defaults to the noop logger.
+func (aw *WorkflowReplayer) ReplayWorkflowHistoriesFromDirectory(logger log.Logger, dirName string, options ReplayBatchOptions) (*ReplayReport, error) {
+	if logger == nil {
+		logger = ilog.NewDefaultLogger()
+	}
+
+	entries, err := os.ReadDir(dirName)
+	if err != nil {
+		return nil, err
+	}
+	var fileNames []string
+	for _, entry := range entries {
+		if !entry.IsDir() && isHistoryFileName(entry.Name()) {
+			fileNames = append(fileNames, filepath.Join(dirName, entry.Name()))
+		}
+	}
+
+	next := 0
+	return aw.replayBatch(context.Background(), options, func() (func() *ReplayResult, bool, error) {
+		if next >= len(fileNames) {
+			return nil, false, nil
+		}
+		fileName := fileNames[next]
+		next++
+
+		return func() *ReplayResult {
+			history, err := extractHistoryFromFile(fileName, 0)
+			if err != nil {
+				return &ReplayResult{Source: fileName, Error: err}
+			}
+
+			controller := gomock.NewController(ilog.NewTestReporter(logger))
+			service := workflowservicemock.NewMockWorkflowServiceClient(controller)
+
+			return aw.replayHistory(logger, service, ReplayNamespace, fileName, history)
+		}, true, nil
+	})
+}
+
+// ReplayWorkflowExecutionsFromQuery replays every workflow execution returned by the given list workflow query
+// concurrently, loading histories from Temporal service, and returns a report with the outcome of each replay.
+// Executions are replayed as the query result pages are fetched. Listing stops when ctx is done, in which case
+// the replays in progress are awaited and the context error is returned.
+// The logger is an optional parameter. Defaults to the noop logger.
+func (aw *WorkflowReplayer) ReplayWorkflowExecutionsFromQuery(ctx context.Context, service workflowservice.WorkflowServiceClient, logger log.Logger, namespace string, query string, options ReplayBatchOptions) (*ReplayReport, error) {
+	if logger == nil {
+		logger = ilog.NewDefaultLogger()
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	paginate := func(ctx context.Context, nextToken []byte) ([]*workflowpb.WorkflowExecutionInfo, []byte, error) {
+		response, err := service.ListWorkflowExecutions(ctx, &workflowservice.ListWorkflowExecutionsRequest{
+			Namespace:     namespace,
+			Query:         query,
+			NextPageToken: nextToken,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		return response.GetExecutions(), response.GetNextPageToken(), nil
+	}
+	iter := newWorkflowExecutionIterator(ctx, aw.dataConverter, nil, paginate)
+
+	return aw.replayBatch(ctx, options, func() (func() *ReplayResult, bool, error) {
+		if !iter.HasNext() {
+			return nil, false, nil
+		}
+		entry, err := iter.Next()
+		if err != nil {
+			return nil, false, err
+		}
+
+		return func() *ReplayResult {
+			execution := WorkflowExecution{
+				ID:    entry.Info.GetExecution().GetWorkflowId(),
+				RunID: entry.Info.GetExecution().GetRunId(),
+			}
+			source := execution.ID + "/" + execution.RunID
+
+			history, err := getWorkflowExecutionHistory(ctx, service, namespace, execution)
+			if err != nil {
+				return &ReplayResult{
+					Source:       source,
+					Execution:    execution,
+					WorkflowType: entry.Info.GetType().GetName(),
+					Error:        err,
+				}
+			}
+
+			result := aw.replayHistory(logger, service, namespace, source, history)
+			result.Execution = execution
+			return result
+		}, true, nil
+	})
+}
+
+// replayBatch runs the replays returned by next on a pool of workers until next reports there are no more replays
+// or fails. Results are reported in the order next returned the replays.
+func (aw *WorkflowReplayer) replayBatch(
+	ctx context.Context,
+	options ReplayBatchOptions,
+	next func() (replay func() *ReplayResult, ok bool, err error),
+) (*ReplayReport, error) {
+	concurrency := options.MaxConcurrentReplays
+	if concurrency <= 0 {
+		concurrency = defaultMaxConcurrentReplays
+	}
+
+	type replayJob struct {
+		index  int
+		replay func() *ReplayResult
+	}
+
+	report := &ReplayReport{}
+	var lock sync.Mutex
+	jobs := make(chan replayJob)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				if ctx.Err() != nil {
+					// Don't start new replays once the batch is canceled.
+					continue
+				}
+				result := job.replay()
+				lock.Lock()
+				report.Results[job.index] = result
+				lock.Unlock()
+			}
+		}()
+	}
+
+	var err error
+	for index := 0; ; index++ {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		replay, ok, nextErr := next()
+		if nextErr != nil {
+			err = nextErr
+			break
+		}
+		if !ok {
+			break
+		}
+		lock.Lock()
+		report.Results = append(report.Results, nil)
+		lock.Unlock()
+		jobs <- replayJob{index: index, replay: replay}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func (aw *WorkflowReplayer) replayHistory(logger log.Logger, service workflowservice.WorkflowServiceClient, namespace string, source string, history *historypb.History) *ReplayResult {
+	result := &ReplayResult{Source: source}
+	if events := history.GetEvents(); len(events) > 0 {
+		result.WorkflowType = events[0].GetWorkflowExecutionStartedEventAttributes().GetWorkflowType().GetName()
+	}
+
+	tracker := &replayEventTracker{}
+	if err := aw.replayWorkflowHistory(logger, service, namespace, history, tracker); err != nil {
+		result.FailedEventID = tracker.lastEventID()
+		var ndErr *NonDeterminismError
+		if errors.As(err, &ndErr) && ndErr.EventID() != 0 {
+			result.FailedEventID = ndErr.EventID()
+		}
+		result.Error = err
+	}
+	return result
+}
+
+// Passed returns results of the replays that passed.
+func (r *ReplayReport) Passed() []*ReplayResult {
+	var passed []*ReplayResult
+	for _, result := range r.Results {
+		if result.Error == nil {
+			passed = append(passed, result)
+		}
+	}
+	return passed
+}
+
+// Failed returns results of the replays that failed.
+func (r *ReplayReport) Failed() []*ReplayResult {
+	var failed []*ReplayResult
+	for _, result := range r.Results {
+		if result.Error != nil {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+// Err returns an error describing every failed replay, or nil if all replays passed.
+func (r *ReplayReport) Err() error {
+	failed := r.Failed()
+	if len(failed) == 0 {
+		return nil
+	}
+
+	messages := make([]string, 0, len(failed))
+	for _, result := range failed {
+		messages = append(messages, fmt.Sprintf("%s (workflow type: %s, event ID: %d): %v",
+			result.Source, result.WorkflowType, result.FailedEventID, result.Error))
+	}
+	return fmt.Errorf("%d of %d workflow replays failed: %s", len(failed), len(r.Results), strings.Join(messages, "; "))
+}
+
+func (t *replayEventTracker) InterceptWorkflow(info *WorkflowInfo, next WorkflowInboundCallsInterceptor) WorkflowInboundCallsInterceptor {
+	t.info = info
+	return next
+}
+
+func (t *replayEventTracker) lastEventID() int64 {
+	if t.info == nil {
+		return 0
+	}
+	return int64(t.info.GetCurrentHistoryLength())
+}
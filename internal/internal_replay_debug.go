@@ -0,0 +1,116 @@
+// The MIT License
+//
+// Copyright (c) 2020 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package internal
+
+import (
+	"errors"
+
+	commandpb "go.temporal.io/api/command/v1"
+	historypb "go.temporal.io/api/history/v1"
+
+	"go.temporal.io/sdk/converter"
+)
+
+type (
+	// ReplayDebugCallbacks are invoked by WorkflowReplayer while it replays a workflow history. They run on the replay
+	// goroutine while all workflow coroutines are blocked, so the workflow state doesn't change during a callback.
+	// All callbacks are optional.
+	ReplayDebugCallbacks struct {
+		// BeforeWorkflowTask is called before events of a workflow task are applied. The events end with the
+		// WorkflowTaskStarted event of the task and are preceded by the events that happened since the previous task.
+		BeforeWorkflowTask func(state ReplayDebugState, events []*historypb.HistoryEvent)
+
+		// AfterWorkflowTask is called after all events of a workflow task are applied and the workflow code produced
+		// the commands of the task. It is also called when the workflow completes in the middle of a task.
+		AfterWorkflowTask func(state ReplayDebugState)
+
+		// BeforeHistoryEvent is called before a history event is applied to the workflow.
+		BeforeHistoryEvent func(state ReplayDebugState, event *historypb.HistoryEvent)
+
+		// AfterHistoryEvent is called after a history event is applied to the workflow and the workflow code has
+		// run until all coroutines are blocked.
+		AfterHistoryEvent func(state ReplayDebugState, event *historypb.HistoryEvent)
+	}
+
+	// ReplayDebugState gives access to the replayed workflow at the point a ReplayDebugCallbacks callback is invoked.
+	ReplayDebugState interface {
+		// WorkflowInfo returns information about the replayed workflow execution.
+		WorkflowInfo() *WorkflowInfo
+
+		// Commands returns the commands produced by the workflow code that are not yet matched to history events,
+		// in the order they were produced. The command closing the workflow execution is not included as it is
+		// only produced when the last workflow task completes.
+		Commands() []*commandpb.Command
+
+		// StackTrace returns stack traces of all workflow coroutines, the same as the __stack_trace query.
+		// It is empty before the workflow is started.
+		StackTrace() string
+
+		// Query invokes the workflow query handler and returns its result.
+		// It returns an error before the workflow is started.
+		Query(queryType string, args ...interface{}) (converter.EncodedValue, error)
+	}
+
+	replayDebugState struct {
+		eventHandler *workflowExecutionEventHandlerImpl
+	}
+)
+
+func (s *replayDebugState) WorkflowInfo() *WorkflowInfo {
+	return s.eventHandler.WorkflowInfo()
+}
+
+func (s *replayDebugState) Commands() []*commandpb.Command {
+	var commands []*commandpb.Command
+	for curr := s.eventHandler.commandsHelper.orderedCommands.Front(); curr != nil; curr = curr.Next() {
+		if command := curr.Value.(commandStateMachine).getCommand(); command != nil {
+			commands = append(commands, command)
+		}
+	}
+	return commands
+}
+
+func (s *replayDebugState) StackTrace() string {
+	if s.eventHandler.workflowDefinition == nil {
+		return ""
+	}
+	return s.eventHandler.StackTrace()
+}
+
+func (s *replayDebugState) Query(queryType string, args ...interface{}) (converter.EncodedValue, error) {
+	if s.eventHandler.workflowDefinition == nil {
+		return nil, errors.New("workflow is not started")
+	}
+	dataConverter := s.eventHandler.GetDataConverter()
+	input, err := encodeArgs(dataConverter, args)
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.eventHandler.ProcessQuery(queryType, input)
+	if err != nil {
+		return nil, err
+	}
+	return newEncodedValue(result, dataConverter), nil
+}
@@ -53,7 +53,6 @@ import (
 	"go.temporal.io/sdk/converter"
 	"go.temporal.io/sdk/internal/common"
 	"go.temporal.io/sdk/internal/common/metrics"
-	"go.temporal.io/sdk/internal/common/util"
 	"go.temporal.io/sdk/log"
 )
 
@@ -135,6 +134,11 @@ type (
 		tracer                   opentracing.Tracer
 		cache                    *WorkerCache
 		deadlockDetectionTimeout time.Duration
+		replayDebugCallbacks     *ReplayDebugCallbacks
+		coroutineDebugMode       bool
+
+		continueAsNewSuggestedHistoryLength int
+		continueAsNewSuggestedHistorySize   int
 	}
 
 	activityProvider func(name string) activity
@@ -166,6 +170,12 @@ type (
 		lastEventID    int64 // last expected eventID, zero indicates read until end of stream
 		next           []*historypb.HistoryEvent
 		binaryChecksum string
+		// approximate size of the events read since the last batch returned by NextCommandEvents.
+		pendingSize int
+		// last event ID and approximate size of the events of the last batch returned by NextCommandEvents,
+		// including events that are not returned in the batch.
+		batchLastEventID int64
+		batchSize        int
 	}
 
 	workflowTaskHeartbeatError struct {
@@ -271,6 +281,8 @@ func (eh *history) NextCommandEvents() (result []*historypb.HistoryEvent, marker
 
 	result = eh.next
 	checksum := eh.binaryChecksum
+	eh.batchLastEventID = eh.nextEventID - 1
+	eh.batchSize, eh.pendingSize = eh.pendingSize, 0
 	if len(result) > 0 {
 		eh.next, markers, err = eh.nextCommandEvents()
 	}
@@ -337,6 +349,7 @@ OrderEvents:
 		}
 
 		eh.nextEventID++
+		eh.pendingSize += event.Size()
 
 		switch event.GetEventType() {
 		case enumspb.EVENT_TYPE_WORKFLOW_TASK_STARTED:
@@ -351,9 +364,13 @@ OrderEvents:
 				nextEvents = append(nextEvents, event)
 				break OrderEvents
 			}
+		case enumspb.EVENT_TYPE_WORKFLOW_TASK_FAILED:
+			if isResetWorkflowTaskFailedEvent(event) {
+				// workflow needs new run ID from the event to reseed random generators
+				nextEvents = append(nextEvents, event)
+			}
 		case enumspb.EVENT_TYPE_WORKFLOW_TASK_SCHEDULED,
-			enumspb.EVENT_TYPE_WORKFLOW_TASK_TIMED_OUT,
-			enumspb.EVENT_TYPE_WORKFLOW_TASK_FAILED:
+			enumspb.EVENT_TYPE_WORKFLOW_TASK_TIMED_OUT:
 			// Skip
 		default:
 			if isPreloadMarkerEvent(event) {
@@ -399,6 +416,11 @@ func newWorkflowTaskHandler(params workerExecutionParameters, ppMgr pressurePoin
 		tracer:                   params.Tracer,
 		cache:                    params.cache,
 		deadlockDetectionTimeout: params.DeadlockDetectionTimeout,
+		replayDebugCallbacks:     params.ReplayDebugCallbacks,
+		coroutineDebugMode:       params.EnableCoroutineDebugMode,
+
+		continueAsNewSuggestedHistoryLength: params.ContinueAsNewSuggestedHistoryLength,
+		continueAsNewSuggestedHistorySize:   params.ContinueAsNewSuggestedHistorySize,
 	}
 }
 
@@ -512,6 +534,10 @@ func (w *workflowExecutionContextImpl) clearState() {
 
 func (w *workflowExecutionContextImpl) createEventHandler() {
 	w.clearState()
+	// history is replayed from the beginning by the new event handler
+	w.workflowInfo.currentHistoryLength = 0
+	w.workflowInfo.currentHistorySize = 0
+	w.workflowInfo.continueAsNewSuggested = false
 	eventHandler := newWorkflowExecutionEventHandler(
 		w.workflowInfo,
 		w.completeWorkflow,
@@ -523,6 +549,7 @@ func (w *workflowExecutionContextImpl) createEventHandler() {
 		w.wth.contextPropagators,
 		w.wth.tracer,
 		w.wth.deadlockDetectionTimeout,
+		w.wth.coroutineDebugMode,
 	)
 
 	w.eventHandler = &eventHandler
@@ -582,6 +609,7 @@ func (wth *workflowTaskHandlerImpl) createWorkflowContext(task *workflowservice.
 		ParentWorkflowExecution:  parentWorkflowExecution,
 		Memo:                     attributes.Memo,
 		SearchAttributes:         attributes.SearchAttributes,
+		dataConverter:            wth.dataConverter,
 	}
 
 	return newWorkflowExecutionContext(workflowInfo, wth), nil
@@ -823,6 +851,7 @@ func (w *workflowExecutionContextImpl) ProcessWorkflowTask(workflowTask *workflo
 	replayStopWatchStopped := false
 
 	// Process events
+	debugTaskOpen := false
 ProcessEvents:
 	for {
 		reorderedEvents, markers, binaryChecksum, err := reorderedHistory.NextCommandEvents()
@@ -838,11 +867,18 @@ ProcessEvents:
 		} else {
 			w.workflowInfo.BinaryChecksum = binaryChecksum
 		}
+		w.updateHistoryStats(reorderedHistory.batchLastEventID, reorderedHistory.batchSize)
+		if callbacks := w.wth.replayDebugCallbacks; callbacks != nil {
+			debugTaskOpen = true
+			if callbacks.BeforeWorkflowTask != nil {
+				callbacks.BeforeWorkflowTask(&replayDebugState{eventHandler: eventHandler}, reorderedEvents)
+			}
+		}
 		// Markers are from the events that are produced from the current workflow task.
 		for _, m := range markers {
 			if m.GetMarkerRecordedEventAttributes().GetMarkerName() != localActivityMarkerName {
 				// local activity marker needs to be applied after workflow task started event
-				err := eventHandler.ProcessEvent(m, true, false)
+				err := w.processEvent(eventHandler, m, true, false)
 				if err != nil {
 					return nil, err
 				}
@@ -875,7 +911,7 @@ ProcessEvents:
 				return nil, err
 			}
 
-			err = eventHandler.ProcessEvent(event, isInReplay, isLast)
+			err = w.processEvent(eventHandler, event, isInReplay, isLast)
 			if err != nil {
 				return nil, err
 			}
@@ -887,7 +923,7 @@ ProcessEvents:
 		// now apply local activity markers
 		for _, m := range markers {
 			if m.GetMarkerRecordedEventAttributes().GetMarkerName() == localActivityMarkerName {
-				err := eventHandler.ProcessEvent(m, true, false)
+				err := w.processEvent(eventHandler, m, true, false)
 				if err != nil {
 					return nil, err
 				}
@@ -896,6 +932,10 @@ ProcessEvents:
 				}
 			}
 		}
+		if debugTaskOpen {
+			debugTaskOpen = false
+			w.afterDebugWorkflowTask(eventHandler)
+		}
 		isReplay := len(reorderedEvents) > 0 && reorderedHistory.IsReplayEvent(reorderedEvents[len(reorderedEvents)-1])
 		if isReplay {
 			eventCommands := eventHandler.commandsHelper.getCommands(true)
@@ -905,6 +945,10 @@ ProcessEvents:
 		}
 	}
 
+	if debugTaskOpen {
+		// workflow completed in the middle of the workflow task
+		w.afterDebugWorkflowTask(eventHandler)
+	}
 	if !replayStopWatchStopped {
 		replayStopWatch.Stop()
 	}
@@ -920,6 +964,9 @@ ProcessEvents:
 	if !skipReplayCheck && !w.isWorkflowCompleted {
 		// check if commands from reply matches to the history events
 		if err := matchReplayWithHistory(replayCommands, respondEvents); err != nil {
+			if ndErr, ok := err.(*NonDeterminismError); ok {
+				ndErr.stackTrace = eventHandler.StackTrace()
+			}
 			workflowError = err
 		}
 	}
@@ -927,6 +974,38 @@ ProcessEvents:
 	return w.applyWorkflowPanicPolicy(workflowTask, workflowError)
 }
 
+// processEvent applies the history event to the workflow and invokes replay debug callbacks around it.
+func (w *workflowExecutionContextImpl) processEvent(eventHandler *workflowExecutionEventHandlerImpl, event *historypb.HistoryEvent, isReplay bool, isLast bool) error {
+	callbacks := w.wth.replayDebugCallbacks
+	if callbacks != nil && callbacks.BeforeHistoryEvent != nil {
+		callbacks.BeforeHistoryEvent(&replayDebugState{eventHandler: eventHandler}, event)
+	}
+	if err := eventHandler.ProcessEvent(event, isReplay, isLast); err != nil {
+		return err
+	}
+	if callbacks != nil && callbacks.AfterHistoryEvent != nil {
+		callbacks.AfterHistoryEvent(&replayDebugState{eventHandler: eventHandler}, event)
+	}
+	return nil
+}
+
+func (w *workflowExecutionContextImpl) afterDebugWorkflowTask(eventHandler *workflowExecutionEventHandlerImpl) {
+	if callbacks := w.wth.replayDebugCallbacks; callbacks.AfterWorkflowTask != nil {
+		callbacks.AfterWorkflowTask(&replayDebugState{eventHandler: eventHandler})
+	}
+}
+
+// updateHistoryStats tracks history length and size exposed to workflow through WorkflowInfo. It is called for every
+// batch of events in history order, before any event of the batch (including markers) is applied, so values observed
+// by workflow code are the same during replay.
+func (w *workflowExecutionContextImpl) updateHistoryStats(lastEventID int64, size int) {
+	info := w.workflowInfo
+	info.currentHistoryLength = int(lastEventID)
+	info.currentHistorySize += size
+	info.continueAsNewSuggested = info.currentHistoryLength >= w.wth.continueAsNewSuggestedHistoryLength ||
+		info.currentHistorySize >= w.wth.continueAsNewSuggestedHistorySize
+}
+
 func (w *workflowExecutionContextImpl) ProcessLocalActivityResult(workflowTask *workflowTask, lar *localActivityResult) (interface{}, error) {
 	if lar.err != nil && w.retryLocalActivity(lar) {
 		return nil, nil // nothing to do here as we are retrying...
@@ -939,8 +1018,11 @@ func (w *workflowExecutionContextImpl) applyWorkflowPanicPolicy(workflowTask *wo
 	task := workflowTask.task
 
 	if workflowError == nil && w.err != nil {
-		if panicErr, ok := w.err.(*workflowPanicError); ok {
-			workflowError = panicErr
+		switch err := w.err.(type) {
+		case *workflowPanicError:
+			workflowError = err
+		case *NonDeterminismError:
+			workflowError = err
 		}
 	}
 
@@ -1131,6 +1213,11 @@ func (w *workflowExecutionContextImpl) ResetIfStale(task *workflowservice.PollWo
 	return nil
 }
 
+func isResetWorkflowTaskFailedEvent(e *historypb.HistoryEvent) bool {
+	return e.GetEventType() == enumspb.EVENT_TYPE_WORKFLOW_TASK_FAILED &&
+		e.GetWorkflowTaskFailedEventAttributes().GetCause() == enumspb.WORKFLOW_TASK_FAILED_CAUSE_RESET_WORKFLOW
+}
+
 func skipDeterministicCheckForCommand(d *commandpb.Command) bool {
 	if d.GetCommandType() == enumspb.COMMAND_TYPE_RECORD_MARKER {
 		markerName := d.GetRecordMarkerCommandAttributes().GetMarkerName()
@@ -1195,16 +1282,15 @@ matchLoop:
 		}
 
 		if d == nil {
-			return fmt.Errorf("nondeterministic workflow: missing replay command for %s", util.HistoryEventToString(e))
+			return newNonDeterminismError("nondeterministic workflow: missing replay command", e, nil)
 		}
 
 		if e == nil {
-			return fmt.Errorf("nondeterministic workflow: extra replay command for %s", util.CommandToString(d))
+			return newNonDeterminismError("nondeterministic workflow: extra replay command", nil, d)
 		}
 
 		if !isCommandMatchEvent(d, e, false) {
-			return fmt.Errorf("nondeterministic workflow: history event is %s, replay command is %s",
-				util.HistoryEventToString(e), util.CommandToString(d))
+			return newNonDeterminismError("nondeterministic workflow: history event doesn't match replay command", e, d)
 		}
 
 		di++
@@ -1213,6 +1299,64 @@ matchLoop:
 	return nil
 }
 
+// historyEventSummary returns event type, ID and the attributes identifying the command that produced the event.
+func historyEventSummary(e *historypb.HistoryEvent) string {
+	var details string
+	switch e.GetEventType() {
+	case enumspb.EVENT_TYPE_ACTIVITY_TASK_SCHEDULED:
+		attr := e.GetActivityTaskScheduledEventAttributes()
+		details = fmt.Sprintf(", ActivityType: %s, ActivityId: %s", attr.GetActivityType().GetName(), attr.GetActivityId())
+	case enumspb.EVENT_TYPE_ACTIVITY_TASK_CANCEL_REQUESTED:
+		details = fmt.Sprintf(", ScheduledEventId: %d", e.GetActivityTaskCancelRequestedEventAttributes().GetScheduledEventId())
+	case enumspb.EVENT_TYPE_TIMER_STARTED:
+		details = fmt.Sprintf(", TimerId: %s", e.GetTimerStartedEventAttributes().GetTimerId())
+	case enumspb.EVENT_TYPE_TIMER_CANCELED:
+		details = fmt.Sprintf(", TimerId: %s", e.GetTimerCanceledEventAttributes().GetTimerId())
+	case enumspb.EVENT_TYPE_START_CHILD_WORKFLOW_EXECUTION_INITIATED:
+		attr := e.GetStartChildWorkflowExecutionInitiatedEventAttributes()
+		details = fmt.Sprintf(", WorkflowType: %s, WorkflowId: %s", attr.GetWorkflowType().GetName(), attr.GetWorkflowId())
+	case enumspb.EVENT_TYPE_MARKER_RECORDED:
+		details = fmt.Sprintf(", MarkerName: %s", e.GetMarkerRecordedEventAttributes().GetMarkerName())
+	case enumspb.EVENT_TYPE_SIGNAL_EXTERNAL_WORKFLOW_EXECUTION_INITIATED:
+		attr := e.GetSignalExternalWorkflowExecutionInitiatedEventAttributes()
+		details = fmt.Sprintf(", SignalName: %s, WorkflowId: %s", attr.GetSignalName(), attr.GetWorkflowExecution().GetWorkflowId())
+	case enumspb.EVENT_TYPE_REQUEST_CANCEL_EXTERNAL_WORKFLOW_EXECUTION_INITIATED:
+		attr := e.GetRequestCancelExternalWorkflowExecutionInitiatedEventAttributes()
+		details = fmt.Sprintf(", WorkflowId: %s", attr.GetWorkflowExecution().GetWorkflowId())
+	}
+	return fmt.Sprintf("%s (EventId: %d%s)", e.GetEventType(), e.GetEventId(), details)
+}
+
+// commandSummary returns command type and the attributes identifying the command.
+func commandSummary(d *commandpb.Command) string {
+	var details string
+	switch d.GetCommandType() {
+	case enumspb.COMMAND_TYPE_SCHEDULE_ACTIVITY_TASK:
+		attr := d.GetScheduleActivityTaskCommandAttributes()
+		details = fmt.Sprintf("ActivityType: %s, ActivityId: %s", attr.GetActivityType().GetName(), attr.GetActivityId())
+	case enumspb.COMMAND_TYPE_REQUEST_CANCEL_ACTIVITY_TASK:
+		details = fmt.Sprintf("ScheduledEventId: %d", d.GetRequestCancelActivityTaskCommandAttributes().GetScheduledEventId())
+	case enumspb.COMMAND_TYPE_START_TIMER:
+		details = fmt.Sprintf("TimerId: %s", d.GetStartTimerCommandAttributes().GetTimerId())
+	case enumspb.COMMAND_TYPE_CANCEL_TIMER:
+		details = fmt.Sprintf("TimerId: %s", d.GetCancelTimerCommandAttributes().GetTimerId())
+	case enumspb.COMMAND_TYPE_START_CHILD_WORKFLOW_EXECUTION:
+		attr := d.GetStartChildWorkflowExecutionCommandAttributes()
+		details = fmt.Sprintf("WorkflowType: %s, WorkflowId: %s", attr.GetWorkflowType().GetName(), attr.GetWorkflowId())
+	case enumspb.COMMAND_TYPE_RECORD_MARKER:
+		details = fmt.Sprintf("MarkerName: %s", d.GetRecordMarkerCommandAttributes().GetMarkerName())
+	case enumspb.COMMAND_TYPE_SIGNAL_EXTERNAL_WORKFLOW_EXECUTION:
+		attr := d.GetSignalExternalWorkflowExecutionCommandAttributes()
+		details = fmt.Sprintf("SignalName: %s, WorkflowId: %s", attr.GetSignalName(), attr.GetExecution().GetWorkflowId())
+	case enumspb.COMMAND_TYPE_REQUEST_CANCEL_EXTERNAL_WORKFLOW_EXECUTION:
+		details = fmt.Sprintf("WorkflowId: %s", d.GetRequestCancelExternalWorkflowExecutionCommandAttributes().GetWorkflowId())
+	}
+	if details == "" {
+		return d.GetCommandType().String()
+	}
+	return fmt.Sprintf("%s (%s)", d.GetCommandType(), details)
+}
+
 func lastPartOfName(name string) string {
 	lastDotIdx := strings.LastIndex(name, ".")
 	if lastDotIdx < 0 || lastDotIdx == len(name)-1 {
@@ -1463,6 +1607,14 @@ func (wth *workflowTaskHandlerImpl) completeWorkflow(
 	} else if errors.As(workflowContext.err, &contErr) {
 		// Continue as new error.
 		metricsScope.Counter(metrics.WorkflowContinueAsNewCounter).Inc(1)
+		memo := contErr.Memo
+		if memo == nil {
+			memo = workflowContext.workflowInfo.Memo
+		}
+		searchAttributes := contErr.SearchAttributes
+		if searchAttributes == nil {
+			searchAttributes = workflowContext.workflowInfo.SearchAttributes
+		}
 		closeCommand = createNewCommand(enumspb.COMMAND_TYPE_CONTINUE_AS_NEW_WORKFLOW_EXECUTION)
 		closeCommand.Attributes = &commandpb.Command_ContinueAsNewWorkflowExecutionCommandAttributes{ContinueAsNewWorkflowExecutionCommandAttributes: &commandpb.ContinueAsNewWorkflowExecutionCommandAttributes{
 			WorkflowType:        &commonpb.WorkflowType{Name: contErr.WorkflowType.Name},
@@ -1471,8 +1623,9 @@ func (wth *workflowTaskHandlerImpl) completeWorkflow(
 			WorkflowRunTimeout:  &contErr.WorkflowRunTimeout,
 			WorkflowTaskTimeout: &contErr.WorkflowTaskTimeout,
 			Header:              contErr.Header,
-			Memo:                workflowContext.workflowInfo.Memo,
-			SearchAttributes:    workflowContext.workflowInfo.SearchAttributes,
+			Memo:                memo,
+			SearchAttributes:    searchAttributes,
+			RetryPolicy:         convertToPBRetryPolicy(contErr.RetryPolicy),
 		}}
 	} else if workflowContext.err != nil {
 		// Workflow failures
@@ -103,6 +103,18 @@ func registerWorkflows(r *registry) {
 		binaryChecksumWorkflowFunc,
 		RegisterWorkflowOptions{Name: "BinaryChecksumWorkflow"},
 	)
+	r.RegisterWorkflowWithOptions(
+		continueAsNewWithOptionsWorkflowFunc,
+		RegisterWorkflowOptions{Name: "ContinueAsNewWithOptionsWorkflow"},
+	)
+	r.RegisterWorkflowWithOptions(
+		deprecatePatchWorkflowFunc,
+		RegisterWorkflowOptions{Name: "DeprecatePatchWorkflow"},
+	)
+	r.RegisterWorkflowWithOptions(
+		patchedWorkflowFunc,
+		RegisterWorkflowOptions{Name: "PatchedWorkflow"},
+	)
 }
 
 func returnPanicWorkflowFunc(Context, []byte) error {
@@ -501,6 +513,108 @@ func (t *TaskHandlersTestSuite) TestWorkflowTask_BinaryChecksum() {
 	t.Equal(getBinaryChecksum(), checksums[2])
 }
 
+func (t *TaskHandlersTestSuite) TestWorkflowTask_DeprecatePatch() {
+	taskQueue := "tq1"
+	testEvents := []*historypb.HistoryEvent{
+		createTestEventWorkflowExecutionStarted(1, &historypb.WorkflowExecutionStartedEventAttributes{TaskQueue: &taskqueuepb.TaskQueue{Name: taskQueue}}),
+		createTestEventWorkflowTaskScheduled(2, &historypb.WorkflowTaskScheduledEventAttributes{TaskQueue: &taskqueuepb.TaskQueue{Name: taskQueue}}),
+		createTestEventWorkflowTaskStarted(3),
+	}
+	task := createWorkflowTask(testEvents, 0, "DeprecatePatchWorkflow")
+	params := t.getTestWorkerExecutionParams()
+	taskHandler := newWorkflowTaskHandler(params, nil, t.registry)
+	request, err := taskHandler.ProcessWorkflowTask(&workflowTask{task: task}, nil)
+	t.NoError(err)
+	response := request.(*workflowservice.RespondWorkflowTaskCompletedRequest)
+	t.Equal(3, len(response.Commands))
+	t.Equal(enumspb.COMMAND_TYPE_RECORD_MARKER, response.Commands[0].GetCommandType())
+	t.Equal(versionMarkerName, response.Commands[0].GetRecordMarkerCommandAttributes().GetMarkerName())
+	t.Equal(enumspb.COMMAND_TYPE_UPSERT_WORKFLOW_SEARCH_ATTRIBUTES, response.Commands[1].GetCommandType())
+	t.Equal(enumspb.COMMAND_TYPE_START_TIMER, response.Commands[2].GetCommandType())
+}
+
+func (t *TaskHandlersTestSuite) TestWorkflowTask_PatchedAfterDeprecatePatch() {
+	// execution started by a build with DeprecatePatch is replayed by a rolled back build with Patched
+	taskQueue := "tq1"
+	testEvents := []*historypb.HistoryEvent{
+		createTestEventWorkflowExecutionStarted(1, &historypb.WorkflowExecutionStartedEventAttributes{TaskQueue: &taskqueuepb.TaskQueue{Name: taskQueue}}),
+		createTestEventWorkflowTaskScheduled(2, &historypb.WorkflowTaskScheduledEventAttributes{TaskQueue: &taskqueuepb.TaskQueue{Name: taskQueue}}),
+		createTestEventWorkflowTaskStarted(3),
+		createTestEventWorkflowTaskCompleted(4, &historypb.WorkflowTaskCompletedEventAttributes{ScheduledEventId: 2}),
+		createTestEventVersionMarker(5, 4, "test-patch", patchedVersion),
+		createTestUpsertWorkflowSearchAttributesForChangeVersion(6, 4, "test-patch", patchedVersion),
+		createTestEventTimerStarted(7, 7),
+		createTestEventTimerFired(8, 7),
+		createTestEventWorkflowTaskScheduled(9, &historypb.WorkflowTaskScheduledEventAttributes{TaskQueue: &taskqueuepb.TaskQueue{Name: taskQueue}}),
+		createTestEventWorkflowTaskStarted(10),
+	}
+	task := createWorkflowTask(testEvents, 3, "PatchedWorkflow")
+	params := t.getTestWorkerExecutionParams()
+	taskHandler := newWorkflowTaskHandler(params, nil, t.registry)
+	request, err := taskHandler.ProcessWorkflowTask(&workflowTask{task: task}, nil)
+	t.NoError(err)
+	response := request.(*workflowservice.RespondWorkflowTaskCompletedRequest)
+	t.Equal(1, len(response.Commands))
+	t.Equal(enumspb.COMMAND_TYPE_COMPLETE_WORKFLOW_EXECUTION, response.Commands[0].GetCommandType())
+	var patched bool
+	t.NoError(converter.GetDefaultDataConverter().FromPayloads(response.Commands[0].GetCompleteWorkflowExecutionCommandAttributes().GetResult(), &patched))
+	t.True(patched)
+}
+
+func (t *TaskHandlersTestSuite) TestWorkflowTask_ContinueAsNewWithOptions() {
+	taskQueue := "tq1"
+	testEvents := []*historypb.HistoryEvent{
+		createTestEventWorkflowExecutionStarted(1, &historypb.WorkflowExecutionStartedEventAttributes{
+			TaskQueue: &taskqueuepb.TaskQueue{Name: taskQueue},
+			Input:     testEncodeFunctionArgs(converter.GetDefaultDataConverter(), "valid"),
+		}),
+		createTestEventWorkflowTaskScheduled(2, &historypb.WorkflowTaskScheduledEventAttributes{TaskQueue: &taskqueuepb.TaskQueue{Name: taskQueue}}),
+		createTestEventWorkflowTaskStarted(3),
+	}
+	task := createWorkflowTask(testEvents, 0, "ContinueAsNewWithOptionsWorkflow")
+	params := t.getTestWorkerExecutionParams()
+	taskHandler := newWorkflowTaskHandler(params, nil, t.registry)
+	request, err := taskHandler.ProcessWorkflowTask(&workflowTask{task: task}, nil)
+	t.NoError(err)
+	response := request.(*workflowservice.RespondWorkflowTaskCompletedRequest)
+	t.Equal(1, len(response.Commands))
+	t.Equal(enumspb.COMMAND_TYPE_CONTINUE_AS_NEW_WORKFLOW_EXECUTION, response.Commands[0].GetCommandType())
+
+	attributes := response.Commands[0].GetContinueAsNewWorkflowExecutionCommandAttributes()
+	t.Equal("ContinueAsNewWithOptionsWorkflow", attributes.GetWorkflowType().GetName())
+	t.Equal("new-task-queue", attributes.GetTaskQueue().GetName())
+	t.Equal(time.Hour, *attributes.GetWorkflowRunTimeout())
+	t.Equal(int32(3), attributes.GetRetryPolicy().GetMaximumAttempts())
+	var description string
+	t.NoError(converter.GetDefaultDataConverter().FromPayload(attributes.GetMemo().GetFields()["Description"], &description))
+	t.Equal("next run", description)
+	searchAttributes := NewSearchAttributesFromProto(attributes.GetSearchAttributes())
+	intValue, ok := searchAttributes.GetInt64(NewSearchAttributeKeyInt64("CustomIntField"))
+	t.True(ok)
+	t.Equal(int64(2), intValue)
+}
+
+func (t *TaskHandlersTestSuite) TestWorkflowTask_ContinueAsNewWithOptions_InvalidMemo() {
+	taskQueue := "tq1"
+	testEvents := []*historypb.HistoryEvent{
+		createTestEventWorkflowExecutionStarted(1, &historypb.WorkflowExecutionStartedEventAttributes{
+			TaskQueue: &taskqueuepb.TaskQueue{Name: taskQueue},
+			Input:     testEncodeFunctionArgs(converter.GetDefaultDataConverter(), "invalid-memo"),
+		}),
+		createTestEventWorkflowTaskScheduled(2, &historypb.WorkflowTaskScheduledEventAttributes{TaskQueue: &taskqueuepb.TaskQueue{Name: taskQueue}}),
+		createTestEventWorkflowTaskStarted(3),
+	}
+	task := createWorkflowTask(testEvents, 0, "ContinueAsNewWithOptionsWorkflow")
+	params := t.getTestWorkerExecutionParams()
+	taskHandler := newWorkflowTaskHandler(params, nil, t.registry)
+	request, err := taskHandler.ProcessWorkflowTask(&workflowTask{task: task}, nil)
+	t.NoError(err)
+	response := request.(*workflowservice.RespondWorkflowTaskCompletedRequest)
+	t.Equal(1, len(response.Commands))
+	t.Equal(enumspb.COMMAND_TYPE_FAIL_WORKFLOW_EXECUTION, response.Commands[0].GetCommandType())
+	t.Contains(response.Commands[0].GetFailWorkflowExecutionCommandAttributes().GetFailure().GetMessage(), "invalid memo of the new run")
+}
+
 func (t *TaskHandlersTestSuite) TestWorkflowTask_ActivityTaskScheduled() {
 	// Schedule an activity and see if we complete workflow.
 	taskQueue := "tq1"
@@ -683,6 +797,38 @@ func (t *TaskHandlersTestSuite) TestCacheEvictionWhenErrorOccurs() {
 	t.EqualValues(params.cache.getWorkflowCache().Size(), 0)
 }
 
+func (t *TaskHandlersTestSuite) TestWorkflowTask_NonDeterminismError() {
+	testEvents := []*historypb.HistoryEvent{
+		createTestEventWorkflowExecutionStarted(1, &historypb.WorkflowExecutionStartedEventAttributes{TaskQueue: &taskqueuepb.TaskQueue{Name: testWorkflowTaskTaskqueue}}),
+		createTestEventWorkflowTaskScheduled(2, &historypb.WorkflowTaskScheduledEventAttributes{TaskQueue: &taskqueuepb.TaskQueue{Name: testWorkflowTaskTaskqueue}}),
+		createTestEventWorkflowTaskStarted(3),
+		createTestEventWorkflowTaskCompleted(4, &historypb.WorkflowTaskCompletedEventAttributes{ScheduledEventId: 2}),
+		createTestEventActivityTaskScheduled(5, &historypb.ActivityTaskScheduledEventAttributes{
+			ActivityId:   "0",
+			ActivityType: &commonpb.ActivityType{Name: "some-other-activity"},
+			TaskQueue:    &taskqueuepb.TaskQueue{Name: testWorkflowTaskTaskqueue},
+		}),
+	}
+	params := t.getTestWorkerExecutionParams()
+	params.WorkflowPanicPolicy = BlockWorkflow
+
+	taskHandler := newWorkflowTaskHandler(params, nil, t.registry)
+	task := createWorkflowTask(testEvents, 3, "HelloWorld_Workflow")
+	newWorkflowTaskWorkerInternal(taskHandler, t.service, params, make(chan struct{}))
+	request, err := taskHandler.ProcessWorkflowTask(&workflowTask{task: task}, nil)
+	t.Nil(request)
+
+	var ndErr *NonDeterminismError
+	t.True(errors.As(err, &ndErr))
+	t.EqualValues(5, ndErr.EventID())
+	t.Equal(enumspb.EVENT_TYPE_ACTIVITY_TASK_SCHEDULED, ndErr.HistoryEvent().GetEventType())
+	t.Equal(enumspb.COMMAND_TYPE_SCHEDULE_ACTIVITY_TASK, ndErr.Command().GetCommandType())
+	t.Contains(ndErr.StackTrace(), "coroutine root")
+	t.Equal("nondeterministic workflow: history event doesn't match replay command, "+
+		"history event: ActivityTaskScheduled (EventId: 5, ActivityType: some-other-activity, ActivityId: 0), "+
+		"replay command: ScheduleActivityTask (ActivityType: Greeter_Activity, ActivityId: 0)", ndErr.Error())
+}
+
 func (t *TaskHandlersTestSuite) TestWithMissingHistoryEvents() {
 	testEvents := []*historypb.HistoryEvent{
 		createTestEventWorkflowExecutionStarted(1, &historypb.WorkflowExecutionStartedEventAttributes{TaskQueue: &taskqueuepb.TaskQueue{Name: testWorkflowTaskTaskqueue}}),
@@ -42,12 +42,12 @@ import (
 	"sync"
 	"time"
 
-	"github.com/gogo/protobuf/jsonpb"
 	"github.com/gogo/protobuf/proto"
 	"github.com/golang/mock/gomock"
 	"github.com/opentracing/opentracing-go"
 	"github.com/pborman/uuid"
 	"github.com/uber-go/tally"
+	commandpb "go.temporal.io/api/command/v1"
 	commonpb "go.temporal.io/api/common/v1"
 	enumspb "go.temporal.io/api/enums/v1"
 	historypb "go.temporal.io/api/history/v1"
@@ -86,6 +86,10 @@ const (
 	// as during debugging.
 	unlimitedDeadlockDetectionTimeout = math.MaxInt64
 
+	// Continue-as-new is suggested when history reaches server warning limits.
+	defaultContinueAsNewSuggestedHistoryLength = 10 * 1024
+	defaultContinueAsNewSuggestedHistorySize   = 10 * 1024 * 1024
+
 	testTagsContextKey = "temporal-testTags"
 )
 
@@ -203,6 +207,18 @@ type (
 		// DeadlockDetectionTimeout specifies workflow task timeout.
 		DeadlockDetectionTimeout time.Duration
 
+		// ContinueAsNewSuggestedHistoryLength and ContinueAsNewSuggestedHistorySize specify history thresholds
+		// after which continue-as-new is suggested to workflow.
+		ContinueAsNewSuggestedHistoryLength int
+		ContinueAsNewSuggestedHistorySize   int
+
+		// EnableCoroutineDebugMode enables detection of native goroutines and blocking calls in workflow code.
+		EnableCoroutineDebugMode bool
+
+		// ReplayDebugCallbacks are invoked around history events and workflow tasks during replay. Set by
+		// WorkflowReplayer only.
+		ReplayDebugCallbacks *ReplayDebugCallbacks
+
 		// Pointer to the shared worker cache
 		cache *WorkerCache
 	}
@@ -677,6 +693,22 @@ func (r *registry) getInterceptors() []WorkflowInterceptor {
 	return r.workflowInterceptors
 }
 
+// withWorkflowInterceptor returns a registry that shares registered workflows and activities with r and has
+// interceptor appended to its workflow interceptors. Registrations must not be modified while it is in use.
+func (r *registry) withWorkflowInterceptor(interceptor WorkflowInterceptor) *registry {
+	r.Lock()
+	defer r.Unlock()
+	interceptors := make([]WorkflowInterceptor, 0, len(r.workflowInterceptors)+1)
+	interceptors = append(interceptors, r.workflowInterceptors...)
+	return &registry{
+		workflowFuncMap:      r.workflowFuncMap,
+		workflowAliasMap:     r.workflowAliasMap,
+		activityFuncMap:      r.activityFuncMap,
+		activityAliasMap:     r.activityAliasMap,
+		workflowInterceptors: append(interceptors, interceptor),
+	}
+}
+
 // Validate function parameters.
 func validateFnFormat(fnType reflect.Type, isWorkflow bool) error {
 	if fnType.Kind() != reflect.Func {
@@ -1037,14 +1069,84 @@ func (aw *AggregatedWorker) Stop() {
 	aw.logger.Info("Stopped Worker")
 }
 
-// WorkflowReplayer is used to replay workflow code from an event history
-type WorkflowReplayer struct {
-	registry *registry
-}
+type (
+	// WorkflowReplayer is used to replay workflow code from an event history
+	WorkflowReplayer struct {
+		registry           *registry
+		dataConverter      converter.DataConverter
+		contextPropagators []ContextPropagator
+		debugCallbacks     *ReplayDebugCallbacks
+		coroutineDebugMode bool
+
+		continueAsNewSuggestedHistoryLength int
+		continueAsNewSuggestedHistorySize   int
+	}
+
+	// WorkflowReplayerOptions are options for creating a WorkflowReplayer. They mirror the WorkerOptions and
+	// ClientOptions fields that affect how workflow code is executed, so that histories produced by a worker
+	// configured with them can be replayed the same way.
+	WorkflowReplayerOptions struct {
+		// Optional: Sets DataConverter used to deserialize workflow inputs and results from the history.
+		// Must match the DataConverter of the client that the workflow was run with.
+		// default: defaultDataConverter, an combination of google protobuf converter, gogo protobuf converter and json converter
+		DataConverter converter.DataConverter
+
+		// Optional: Sets ContextPropagators used to extract and inject the context headers during replay.
+		// default: nil
+		ContextPropagators []ContextPropagator
+
+		// Optional: Specifies factories used to instantiate workflow interceptor chain
+		// The chain is instantiated per each replay of a workflow execution
+		WorkflowInterceptorChainFactories []WorkflowInterceptor
+
+		// Optional: Sets callbacks invoked before and after each history event and workflow task during replay.
+		// Use to step through a replay in a debugger or to assert intermediate workflow state in tests.
+		// default: nil
+		DebugCallbacks *ReplayDebugCallbacks
+
+		// Optional: Enables detection of native goroutines and blocking calls in replayed workflow code.
+		// See WorkerOptions.EnableCoroutineDebugMode.
+		// default: false
+		EnableCoroutineDebugMode bool
+
+		// Optional: Number of history events after which WorkflowInfo.GetContinueAsNewSuggested starts returning true
+		// during replay. Must match WorkerOptions.ContinueAsNewSuggestedHistoryLength of the worker that produced
+		// the history to replay workflows that depend on the suggestion.
+		// default: 10240
+		ContinueAsNewSuggestedHistoryLength int
+
+		// Optional: Approximate history size in bytes after which WorkflowInfo.GetContinueAsNewSuggested starts
+		// returning true during replay. See ContinueAsNewSuggestedHistoryLength.
+		// default: 10MB
+		ContinueAsNewSuggestedHistorySize int
+	}
+)
 
 // NewWorkflowReplayer creates an instance of the WorkflowReplayer
 func NewWorkflowReplayer() *WorkflowReplayer {
-	return &WorkflowReplayer{registry: newRegistry()}
+	return NewWorkflowReplayerWithOptions(WorkflowReplayerOptions{})
+}
+
+// NewWorkflowReplayerWithOptions creates an instance of the WorkflowReplayer with provided replayer options
+func NewWorkflowReplayerWithOptions(options WorkflowReplayerOptions) *WorkflowReplayer {
+	registry := newRegistry()
+	registry.SetWorkflowInterceptors(options.WorkflowInterceptorChainFactories)
+	if options.ContinueAsNewSuggestedHistoryLength == 0 {
+		options.ContinueAsNewSuggestedHistoryLength = defaultContinueAsNewSuggestedHistoryLength
+	}
+	if options.ContinueAsNewSuggestedHistorySize == 0 {
+		options.ContinueAsNewSuggestedHistorySize = defaultContinueAsNewSuggestedHistorySize
+	}
+	return &WorkflowReplayer{
+		registry:           registry,
+		dataConverter:      options.DataConverter,
+		contextPropagators: options.ContextPropagators,
+		debugCallbacks:     options.DebugCallbacks,
+		coroutineDebugMode: options.EnableCoroutineDebugMode,
+
+		continueAsNewSuggestedHistoryLength: options.ContinueAsNewSuggestedHistoryLength,
+		continueAsNewSuggestedHistorySize:   options.ContinueAsNewSuggestedHistorySize,
+	}
 }
 
 // RegisterWorkflow registers workflow function to replay
@@ -1068,7 +1170,7 @@ func (aw *WorkflowReplayer) ReplayWorkflowHistory(logger log.Logger, history *hi
 	controller := gomock.NewController(ilog.NewTestReporter(logger))
 	service := workflowservicemock.NewMockWorkflowServiceClient(controller)
 
-	return aw.replayWorkflowHistory(logger, service, ReplayNamespace, history)
+	return aw.replayWorkflowHistory(logger, service, ReplayNamespace, history, nil)
 }
 
 // ReplayWorkflowHistoryFromJSONFile executes a single workflow task for the given json history file.
@@ -1083,7 +1185,7 @@ func (aw *WorkflowReplayer) ReplayWorkflowHistoryFromJSONFile(logger log.Logger,
 // Use for testing the backwards compatibility of code changes and troubleshooting workflows in a debugger.
 // The logger is an optional parameter. Defaults to the noop logger.
 func (aw *WorkflowReplayer) ReplayPartialWorkflowHistoryFromJSONFile(loger log.Logger, jsonfileName string, lastEventID int64) error {
-	history, err := extractHistoryFromFile(jsonfileName, lastEventID)
+	history, err := extractHistoryFromJSONFile(jsonfileName, lastEventID)
 
 	if err != nil {
 		return err
@@ -1096,7 +1198,36 @@ func (aw *WorkflowReplayer) ReplayPartialWorkflowHistoryFromJSONFile(loger log.L
 	controller := gomock.NewController(ilog.NewTestReporter(loger))
 	service := workflowservicemock.NewMockWorkflowServiceClient(controller)
 
-	return aw.replayWorkflowHistory(loger, service, ReplayNamespace, history)
+	return aw.replayWorkflowHistory(loger, service, ReplayNamespace, history, nil)
+}
+
+// ReplayWorkflowHistoryFromFile executes a single workflow task for the given history file. The file format is
+// chosen by the file name extension, see HistoryFileFormat, and the file is gzip decompressed if the name ends with .gz.
+// Use for testing the backwards compatibility of code changes and troubleshooting workflows in a debugger.
+// The logger is an optional parameter. Defaults to the noop logger.
+func (aw *WorkflowReplayer) ReplayWorkflowHistoryFromFile(logger log.Logger, fileName string) error {
+	return aw.ReplayPartialWorkflowHistoryFromFile(logger, fileName, 0)
+}
+
+// ReplayPartialWorkflowHistoryFromFile executes a single workflow task for the given history file upto provided
+// lastEventID(inclusive). Events after lastEventID are not read from the file.
+// Use for testing the backwards compatibility of code changes and troubleshooting workflows in a debugger.
+// The logger is an optional parameter. Defaults to the noop logger.
+func (aw *WorkflowReplayer) ReplayPartialWorkflowHistoryFromFile(logger log.Logger, fileName string, lastEventID int64) error {
+	history, err := extractHistoryFromFile(fileName, lastEventID)
+
+	if err != nil {
+		return err
+	}
+
+	if logger == nil {
+		logger = ilog.NewDefaultLogger()
+	}
+
+	controller := gomock.NewController(ilog.NewTestReporter(logger))
+	service := workflowservicemock.NewMockWorkflowServiceClient(controller)
+
+	return aw.replayWorkflowHistory(logger, service, ReplayNamespace, history, nil)
 }
 
 // ReplayWorkflowExecution replays workflow execution loading it from Temporal service.
@@ -1105,32 +1236,15 @@ func (aw *WorkflowReplayer) ReplayWorkflowExecution(ctx context.Context, service
 		logger = ilog.NewDefaultLogger()
 	}
 
-	sharedExecution := &commonpb.WorkflowExecution{
-		RunId:      execution.RunID,
-		WorkflowId: execution.ID,
-	}
-	request := &workflowservice.GetWorkflowExecutionHistoryRequest{
-		Namespace: namespace,
-		Execution: sharedExecution,
-	}
-	hResponse, err := service.GetWorkflowExecutionHistory(ctx, request)
+	history, err := getWorkflowExecutionHistory(ctx, service, namespace, execution)
 	if err != nil {
 		return err
 	}
 
-	if hResponse.RawHistory != nil {
-		history, err := serializer.DeserializeBlobDataToHistoryEvents(hResponse.RawHistory, enumspb.HISTORY_EVENT_FILTER_TYPE_ALL_EVENT)
-		if err != nil {
-			return err
-		}
-
-		hResponse.History = history
-	}
-
-	return aw.replayWorkflowHistory(logger, service, namespace, hResponse.History)
+	return aw.replayWorkflowHistory(logger, service, namespace, history, nil)
 }
 
-func (aw *WorkflowReplayer) replayWorkflowHistory(loger log.Logger, service workflowservice.WorkflowServiceClient, namespace string, history *historypb.History) error {
+func (aw *WorkflowReplayer) replayWorkflowHistory(loger log.Logger, service workflowservice.WorkflowServiceClient, namespace string, history *historypb.History, tracker *replayEventTracker) error {
 	taskQueue := "ReplayTaskQueue"
 	events := history.Events
 	if events == nil {
@@ -1176,15 +1290,32 @@ func (aw *WorkflowReplayer) replayWorkflowHistory(loger log.Logger, service work
 		metricsScope:  nil,
 		taskQueue:     taskQueue,
 	}
-	cache := NewWorkerCache()
+	// Each replay has its own cache, so that concurrent replays of histories with the same run ID, as done by
+	// ReplayWorkflowHistoriesFromDirectory, don't share the workflow context.
+	cache := newWorkerCache(&sharedWorkerCache{}, &sync.Mutex{}, 1)
+	// Evicting the context closes the dispatcher of the replayed workflow, which is still open if the history is partial.
+	defer cache.removeWorkflowContext(execution.GetRunId())
 	params := workerExecutionParameters{
 		Namespace: namespace,
 		TaskQueue: taskQueue,
 		Identity:  "replayID",
 		Logger:    loger,
 		cache:     cache,
+
+		DataConverter:        aw.dataConverter,
+		ContextPropagators:   aw.contextPropagators,
+		ReplayDebugCallbacks: aw.debugCallbacks,
+
+		EnableCoroutineDebugMode: aw.coroutineDebugMode,
+
+		ContinueAsNewSuggestedHistoryLength: aw.continueAsNewSuggestedHistoryLength,
+		ContinueAsNewSuggestedHistorySize:   aw.continueAsNewSuggestedHistorySize,
+	}
+	registry := aw.registry
+	if tracker != nil {
+		registry = aw.registry.withWorkflowInterceptor(tracker)
 	}
-	taskHandler := newWorkflowTaskHandler(params, nil, aw.registry)
+	taskHandler := newWorkflowTaskHandler(params, nil, registry)
 	resp, err := taskHandler.ProcessWorkflowTask(&workflowTask{task: task, historyIterator: iterator}, nil)
 	if err != nil {
 		return err
@@ -1198,11 +1329,13 @@ func (aw *WorkflowReplayer) replayWorkflowHistory(loger log.Logger, service work
 		return nil
 	}
 
+	var closeCommand *commandpb.Command
 	if resp != nil {
 		completeReq, ok := resp.(*workflowservice.RespondWorkflowTaskCompletedRequest)
 		if ok {
 			for _, d := range completeReq.Commands {
 				if d.GetCommandType() == enumspb.COMMAND_TYPE_CONTINUE_AS_NEW_WORKFLOW_EXECUTION {
+					closeCommand = d
 					if last.GetEventType() == enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_CONTINUED_AS_NEW {
 						inputA := d.GetContinueAsNewWorkflowExecutionCommandAttributes().GetInput()
 						inputB := last.GetWorkflowExecutionContinuedAsNewEventAttributes().GetInput()
@@ -1212,6 +1345,7 @@ func (aw *WorkflowReplayer) replayWorkflowHistory(loger log.Logger, service work
 					}
 				}
 				if d.GetCommandType() == enumspb.COMMAND_TYPE_COMPLETE_WORKFLOW_EXECUTION {
+					closeCommand = d
 					if last.GetEventType() == enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_COMPLETED {
 						resultA := last.GetWorkflowExecutionCompletedEventAttributes().GetResult()
 						resultB := d.GetCompleteWorkflowExecutionCommandAttributes().GetResult()
@@ -1223,38 +1357,39 @@ func (aw *WorkflowReplayer) replayWorkflowHistory(loger log.Logger, service work
 			}
 		}
 	}
-	return fmt.Errorf("replay workflow doesn't return the same result as the last event, resp: %v, last: %v", resp, last)
+	return newNonDeterminismError("replay workflow doesn't return the same result as the last event", last, closeCommand)
 }
 
-func extractHistoryFromFile(jsonfileName string, lastEventID int64) (*historypb.History, error) {
-	reader, err := os.Open(jsonfileName)
-	if err != nil {
-		return nil, err
-	}
-
-	var deserializedHistory historypb.History
-	err = jsonpb.Unmarshal(reader, &deserializedHistory)
+func getWorkflowExecutionHistory(ctx context.Context, service workflowservice.WorkflowServiceClient, namespace string, execution WorkflowExecution) (*historypb.History, error) {
+	request := &workflowservice.GetWorkflowExecutionHistoryRequest{
+		Namespace: namespace,
+		Execution: &commonpb.WorkflowExecution{
+			RunId:      execution.RunID,
+			WorkflowId: execution.ID,
+		},
+	}
+	history := &historypb.History{}
+	for {
+		hResponse, err := service.GetWorkflowExecutionHistory(ctx, request)
+		if err != nil {
+			return nil, err
+		}
 
-	if err != nil {
-		return nil, err
-	}
+		if hResponse.RawHistory != nil {
+			events, err := serializer.DeserializeBlobDataToHistoryEvents(hResponse.RawHistory, enumspb.HISTORY_EVENT_FILTER_TYPE_ALL_EVENT)
+			if err != nil {
+				return nil, err
+			}
 
-	if lastEventID <= 0 {
-		return &deserializedHistory, nil
-	}
+			hResponse.History = events
+		}
 
-	// Caller is potentially asking for subset of history instead of all history events
-	var events []*historypb.HistoryEvent
-	for _, event := range deserializedHistory.Events {
-		events = append(events, event)
-		if event.GetEventId() == lastEventID {
-			// Copy history up to last event (inclusive)
-			break
+		history.Events = append(history.Events, hResponse.History.GetEvents()...)
+		if len(hResponse.NextPageToken) == 0 {
+			return history, nil
 		}
+		request.NextPageToken = hResponse.NextPageToken
 	}
-	history := &historypb.History{Events: events}
-
-	return history, nil
 }
 
 // NewAggregatedWorker returns an instance to manage both activity and workflow workers
@@ -1292,6 +1427,9 @@ func NewAggregatedWorker(client *WorkflowClient, taskQueue string, options Worke
 		ContextPropagators:                    client.contextPropagators,
 		Tracer:                                client.tracer,
 		DeadlockDetectionTimeout:              options.DeadlockDetectionTimeout,
+		ContinueAsNewSuggestedHistoryLength:   options.ContinueAsNewSuggestedHistoryLength,
+		ContinueAsNewSuggestedHistorySize:     options.ContinueAsNewSuggestedHistorySize,
+		EnableCoroutineDebugMode:              options.EnableCoroutineDebugMode,
 		cache:                                 cache,
 	}
 
@@ -1473,6 +1611,12 @@ func setWorkerOptionsDefaults(options *WorkerOptions) {
 		}
 		options.DeadlockDetectionTimeout = defaultDeadlockDetectionTimeout
 	}
+	if options.ContinueAsNewSuggestedHistoryLength == 0 {
+		options.ContinueAsNewSuggestedHistoryLength = defaultContinueAsNewSuggestedHistoryLength
+	}
+	if options.ContinueAsNewSuggestedHistorySize == 0 {
+		options.ContinueAsNewSuggestedHistorySize = defaultContinueAsNewSuggestedHistorySize
+	}
 }
 
 // setClientDefaults should be needed only in unit tests.
@@ -98,7 +98,12 @@ type (
 		RemoveSession(sessionID string)
 		GetContextPropagators() []ContextPropagator
 		UpsertSearchAttributes(attributes map[string]interface{}) error
+		UpsertMemo(memo map[string]interface{}) error
+		GetRandomSeed() int64
 		GetRegistry() *registry
+		// IsCoroutineDebugModeEnabled reports whether the dispatcher should detect native goroutines and
+		// blocking calls in workflow code.
+		IsCoroutineDebugModeEnabled() bool
 	}
 
 	// WorkflowDefinitionFactory factory for creating WorkflowDefinition instances.
@@ -130,6 +130,30 @@ func binaryChecksumWorkflowFunc(ctx Context) ([]string, error) {
 	return result, nil
 }
 
+func deprecatePatchWorkflowFunc(ctx Context) error {
+	DeprecatePatch(ctx, "test-patch")
+	return Sleep(ctx, time.Hour)
+}
+
+func patchedWorkflowFunc(ctx Context) (bool, error) {
+	patched := Patched(ctx, "test-patch")
+	return patched, Sleep(ctx, time.Hour)
+}
+
+func continueAsNewWithOptionsWorkflowFunc(ctx Context, mode string) error {
+	options := ContinueAsNewErrorOptions{
+		TaskQueue:             "new-task-queue",
+		WorkflowRunTimeout:    time.Hour,
+		Memo:                  map[string]interface{}{"Description": "next run"},
+		TypedSearchAttributes: []SearchAttributeUpdate{NewSearchAttributeKeyInt64("CustomIntField").ValueSet(2)},
+		RetryPolicy:           &RetryPolicy{MaximumAttempts: 3},
+	}
+	if mode == "invalid-memo" {
+		options.Memo = map[string]interface{}{"Description": make(chan int)}
+	}
+	return NewContinueAsNewErrorWithOptions(ctx, options, "ContinueAsNewWithOptionsWorkflow", mode)
+}
+
 func helloWorldWorkflowCancelFunc(ctx Context, _ []byte) error {
 	activityName := "Greeter_Activity"
 	ao := ActivityOptions{
@@ -28,6 +28,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math/rand"
 	"os"
 	"reflect"
 	"strings"
@@ -46,6 +47,7 @@ import (
 	namespacepb "go.temporal.io/api/namespace/v1"
 	"go.temporal.io/api/serviceerror"
 	taskqueuepb "go.temporal.io/api/taskqueue/v1"
+	workflowpb "go.temporal.io/api/workflow/v1"
 	"go.temporal.io/api/workflowservice/v1"
 	"go.temporal.io/api/workflowservicemock/v1"
 	"google.golang.org/grpc"
@@ -309,6 +311,214 @@ func (s *internalWorkerTestSuite) TestReplayWorkflowHistory() {
 	require.NoError(s.T(), err)
 }
 
+type recordingDataConverter struct {
+	converter.DataConverter
+	fromPayloadsCount int
+}
+
+func (dc *recordingDataConverter) FromPayloads(payloads *commonpb.Payloads, valuePtrs ...interface{}) error {
+	dc.fromPayloadsCount++
+	return dc.DataConverter.FromPayloads(payloads, valuePtrs...)
+}
+
+func createTestReplayWorkflowHistory() *historypb.History {
+	taskQueue := "taskQueue1"
+	testEvents := []*historypb.HistoryEvent{
+		createTestEventWorkflowExecutionStarted(1, &historypb.WorkflowExecutionStartedEventAttributes{
+			WorkflowType: &commonpb.WorkflowType{Name: "testReplayWorkflow"},
+			TaskQueue:    &taskqueuepb.TaskQueue{Name: taskQueue},
+			Input:        testEncodeFunctionArgs(converter.GetDefaultDataConverter()),
+		}),
+		createTestEventWorkflowTaskScheduled(2, &historypb.WorkflowTaskScheduledEventAttributes{}),
+		createTestEventWorkflowTaskStarted(3),
+		createTestEventWorkflowTaskCompleted(4, &historypb.WorkflowTaskCompletedEventAttributes{}),
+		createTestEventActivityTaskScheduled(5, &historypb.ActivityTaskScheduledEventAttributes{
+			ActivityId:   "5",
+			ActivityType: &commonpb.ActivityType{Name: "testActivity"},
+			TaskQueue:    &taskqueuepb.TaskQueue{Name: taskQueue},
+		}),
+		createTestEventActivityTaskStarted(6, &historypb.ActivityTaskStartedEventAttributes{
+			ScheduledEventId: 5,
+		}),
+		createTestEventActivityTaskCompleted(7, &historypb.ActivityTaskCompletedEventAttributes{
+			ScheduledEventId: 5,
+			StartedEventId:   6,
+		}),
+		createTestEventWorkflowTaskScheduled(8, &historypb.WorkflowTaskScheduledEventAttributes{}),
+		createTestEventWorkflowTaskStarted(9),
+		createTestEventWorkflowTaskCompleted(10, &historypb.WorkflowTaskCompletedEventAttributes{
+			ScheduledEventId: 8,
+			StartedEventId:   9,
+		}),
+		createTestEventWorkflowExecutionCompleted(11, &historypb.WorkflowExecutionCompletedEventAttributes{
+			WorkflowTaskCompletedEventId: 10,
+		}),
+	}
+
+	return &historypb.History{Events: testEvents}
+}
+
+func (s *internalWorkerTestSuite) TestReplayWorkflowHistory_WithOptions() {
+	history := createTestReplayWorkflowHistory()
+	logger := getLogger()
+	dc := &recordingDataConverter{DataConverter: converter.GetDefaultDataConverter()}
+	interceptor := &tracingWorkflowInterceptor{}
+	replayer := NewWorkflowReplayerWithOptions(WorkflowReplayerOptions{
+		DataConverter:                     dc,
+		WorkflowInterceptorChainFactories: []WorkflowInterceptor{interceptor},
+	})
+	replayer.RegisterWorkflow(testReplayWorkflow)
+	err := replayer.ReplayWorkflowHistory(logger, history)
+	require.NoError(s.T(), err)
+	require.Greater(s.T(), dc.fromPayloadsCount, 0)
+	require.Len(s.T(), interceptor.instances, 1)
+	require.Equal(s.T(), []string{
+		"ExecuteWorkflow testReplayWorkflow begin",
+		"ExecuteActivity testActivity",
+		"ExecuteWorkflow testReplayWorkflow end",
+	}, interceptor.instances[0].trace)
+}
+
+func (s *internalWorkerTestSuite) TestReplayWorkflowHistory_DebugCallbacks() {
+	var trace []string
+	var commands [][]enumspb.CommandType
+	var stackTraces []string
+	replayer := NewWorkflowReplayerWithOptions(WorkflowReplayerOptions{
+		DebugCallbacks: &ReplayDebugCallbacks{
+			BeforeWorkflowTask: func(state ReplayDebugState, events []*historypb.HistoryEvent) {
+				trace = append(trace, fmt.Sprintf("task %d-%d", events[0].GetEventId(), events[len(events)-1].GetEventId()))
+			},
+			AfterWorkflowTask: func(state ReplayDebugState) {
+				var types []enumspb.CommandType
+				for _, command := range state.Commands() {
+					types = append(types, command.GetCommandType())
+				}
+				commands = append(commands, types)
+
+				result, err := state.Query(QueryTypeStackTrace)
+				s.NoError(err)
+				var stackTrace string
+				s.NoError(result.Get(&stackTrace))
+				s.Equal(state.StackTrace(), stackTrace)
+				stackTraces = append(stackTraces, stackTrace)
+			},
+			BeforeHistoryEvent: func(state ReplayDebugState, event *historypb.HistoryEvent) {
+				if event.GetEventType() == enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_STARTED {
+					_, err := state.Query(QueryTypeStackTrace)
+					s.Error(err)
+					s.Empty(state.StackTrace())
+				}
+				trace = append(trace, "before "+event.GetEventType().String())
+			},
+			AfterHistoryEvent: func(state ReplayDebugState, event *historypb.HistoryEvent) {
+				s.Equal("testReplayWorkflow", state.WorkflowInfo().WorkflowType.Name)
+				trace = append(trace, "after "+event.GetEventType().String())
+			},
+		},
+	})
+	replayer.RegisterWorkflow(testReplayWorkflow)
+	err := replayer.ReplayWorkflowHistory(getLogger(), createTestReplayWorkflowHistory())
+	require.NoError(s.T(), err)
+
+	require.Equal(s.T(), []string{
+		"task 1-3",
+		"before WorkflowExecutionStarted", "after WorkflowExecutionStarted",
+		"before WorkflowTaskStarted", "after WorkflowTaskStarted",
+		"task 4-9",
+		"before WorkflowTaskCompleted", "after WorkflowTaskCompleted",
+		"before ActivityTaskScheduled", "after ActivityTaskScheduled",
+		"before ActivityTaskStarted", "after ActivityTaskStarted",
+		"before ActivityTaskCompleted", "after ActivityTaskCompleted",
+		"before WorkflowTaskStarted", "after WorkflowTaskStarted",
+	}, trace)
+	require.Equal(s.T(), [][]enumspb.CommandType{
+		{enumspb.COMMAND_TYPE_SCHEDULE_ACTIVITY_TASK},
+		nil,
+	}, commands)
+	require.Contains(s.T(), stackTraces[0], "testReplayWorkflow")
+}
+
+func (s *internalWorkerTestSuite) TestReplayWorkflowExecutionsFromQuery() {
+	logger := getLogger()
+	query := "WorkflowType = 'testReplayWorkflow'"
+	s.service.EXPECT().ListWorkflowExecutions(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, request *workflowservice.ListWorkflowExecutionsRequest, opts ...grpc.CallOption) (*workflowservice.ListWorkflowExecutionsResponse, error) {
+			s.Equal(query, request.GetQuery())
+			if len(request.GetNextPageToken()) == 0 {
+				return &workflowservice.ListWorkflowExecutionsResponse{
+					Executions: []*workflowpb.WorkflowExecutionInfo{{
+						Execution: &commonpb.WorkflowExecution{WorkflowId: "wid1", RunId: "rid1"},
+						Type:      &commonpb.WorkflowType{Name: "testReplayWorkflow"},
+					}},
+					NextPageToken: []byte("token"),
+				}, nil
+			}
+			return &workflowservice.ListWorkflowExecutionsResponse{
+				Executions: []*workflowpb.WorkflowExecutionInfo{{
+					Execution: &commonpb.WorkflowExecution{WorkflowId: "wid2", RunId: "rid2"},
+					Type:      &commonpb.WorkflowType{Name: "testReplayWorkflow"},
+				}},
+			}, nil
+		}).Times(2)
+	s.service.EXPECT().GetWorkflowExecutionHistory(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, request *workflowservice.GetWorkflowExecutionHistoryRequest, opts ...grpc.CallOption) (*workflowservice.GetWorkflowExecutionHistoryResponse, error) {
+			history := createTestReplayWorkflowHistory()
+			if request.GetExecution().GetWorkflowId() == "wid2" {
+				// Change the activity type of a still running workflow to make replay nondeterministic
+				history.Events = history.Events[:7]
+				history.Events[4].GetActivityTaskScheduledEventAttributes().ActivityType.Name = "otherActivity"
+			}
+			return &workflowservice.GetWorkflowExecutionHistoryResponse{History: history}, nil
+		}).Times(2)
+
+	replayer := NewWorkflowReplayer()
+	replayer.RegisterWorkflow(testReplayWorkflow)
+	report, err := replayer.ReplayWorkflowExecutionsFromQuery(context.Background(), s.service, logger, "namespace", query, ReplayBatchOptions{})
+	require.NoError(s.T(), err)
+	require.Len(s.T(), report.Results, 2)
+	require.Len(s.T(), report.Passed(), 1)
+	require.Equal(s.T(), "wid1/rid1", report.Passed()[0].Source)
+
+	failed := report.Failed()
+	require.Len(s.T(), failed, 1)
+	require.Equal(s.T(), WorkflowExecution{ID: "wid2", RunID: "rid2"}, failed[0].Execution)
+	require.Equal(s.T(), "testReplayWorkflow", failed[0].WorkflowType)
+	require.NotZero(s.T(), failed[0].FailedEventID)
+	require.Error(s.T(), failed[0].Error)
+	require.Contains(s.T(), report.Err().Error(), "1 of 2 workflow replays failed: wid2/rid2")
+}
+
+func (s *internalWorkerTestSuite) TestReplayWorkflowExecutionsFromQuery_ContextCanceled() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.service.EXPECT().ListWorkflowExecutions(gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(&workflowservice.ListWorkflowExecutionsResponse{
+			Executions: []*workflowpb.WorkflowExecutionInfo{
+				{
+					Execution: &commonpb.WorkflowExecution{WorkflowId: "wid1", RunId: "rid1"},
+					Type:      &commonpb.WorkflowType{Name: "testReplayWorkflow"},
+				},
+				{
+					Execution: &commonpb.WorkflowExecution{WorkflowId: "wid2", RunId: "rid2"},
+					Type:      &commonpb.WorkflowType{Name: "testReplayWorkflow"},
+				},
+			},
+			NextPageToken: []byte("token"),
+		}, nil).Times(1)
+	s.service.EXPECT().GetWorkflowExecutionHistory(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(context.Context, *workflowservice.GetWorkflowExecutionHistoryRequest, ...grpc.CallOption) (*workflowservice.GetWorkflowExecutionHistoryResponse, error) {
+			// Cancel while the first execution is replayed, neither the second execution nor the next page are replayed.
+			cancel()
+			return &workflowservice.GetWorkflowExecutionHistoryResponse{History: createTestReplayWorkflowHistory()}, nil
+		}).Times(1)
+
+	replayer := NewWorkflowReplayer()
+	replayer.RegisterWorkflow(testReplayWorkflow)
+	report, err := replayer.ReplayWorkflowExecutionsFromQuery(ctx, s.service, getLogger(), "namespace", "", ReplayBatchOptions{MaxConcurrentReplays: 1})
+	require.Nil(s.T(), report)
+	require.Equal(s.T(), context.Canceled, err)
+}
+
 func (s *internalWorkerTestSuite) TestReplayWorkflowHistory_LocalActivity() {
 	taskQueue := "taskQueue1"
 	testEvents := []*historypb.HistoryEvent{
@@ -345,6 +555,341 @@ func (s *internalWorkerTestSuite) TestReplayWorkflowHistory_LocalActivity() {
 	require.NoError(s.T(), err)
 }
 
+func testReplayWorkflowUpsertMemo(ctx Context) error {
+	err := UpsertMemo(ctx, map[string]interface{}{"Description": "processing"})
+	if err != nil {
+		return err
+	}
+	var description string
+	return GetWorkflowInfo(ctx).GetDecodedMemo()["Description"].Get(&description)
+}
+
+func (s *internalWorkerTestSuite) TestReplayWorkflowHistory_UpsertMemo() {
+	taskQueue := "taskQueue1"
+	memo, err := getWorkflowMemo(map[string]interface{}{"Description": "processing"}, converter.GetDefaultDataConverter())
+	require.NoError(s.T(), err)
+	memoPayloads, err := converter.GetDefaultDataConverter().ToPayloads(memo)
+	require.NoError(s.T(), err)
+	testEvents := []*historypb.HistoryEvent{
+		createTestEventWorkflowExecutionStarted(1, &historypb.WorkflowExecutionStartedEventAttributes{
+			WorkflowType: &commonpb.WorkflowType{Name: "testReplayWorkflowUpsertMemo"},
+			TaskQueue:    &taskqueuepb.TaskQueue{Name: taskQueue},
+			Input:        testEncodeFunctionArgs(converter.GetDefaultDataConverter()),
+		}),
+		createTestEventWorkflowTaskScheduled(2, &historypb.WorkflowTaskScheduledEventAttributes{}),
+		createTestEventWorkflowTaskStarted(3),
+		createTestEventWorkflowTaskCompleted(4, &historypb.WorkflowTaskCompletedEventAttributes{}),
+		createTestEventMarkerRecorded(5, &historypb.MarkerRecordedEventAttributes{
+			MarkerName:                   upsertMemoMarkerName,
+			Details:                      map[string]*commonpb.Payloads{upsertMemoMarkerDataName: memoPayloads},
+			WorkflowTaskCompletedEventId: 4,
+		}),
+		createTestEventWorkflowExecutionCompleted(6, &historypb.WorkflowExecutionCompletedEventAttributes{
+			WorkflowTaskCompletedEventId: 4,
+		}),
+	}
+
+	history := &historypb.History{Events: testEvents}
+	logger := getLogger()
+	replayer := NewWorkflowReplayer()
+	replayer.RegisterWorkflow(testReplayWorkflowUpsertMemo)
+	err = replayer.ReplayWorkflowHistory(logger, history)
+	require.NoError(s.T(), err)
+}
+
+func (s *internalWorkerTestSuite) TestReplayWorkflowHistory_UpsertMemo_DataConverter() {
+	taskQueue := "taskQueue1"
+	dc := iconverter.NewTestDataConverter()
+	memo, err := getWorkflowMemo(map[string]interface{}{"Description": "processing"}, dc)
+	require.NoError(s.T(), err)
+	memoPayloads, err := dc.ToPayloads(memo)
+	require.NoError(s.T(), err)
+	testEvents := []*historypb.HistoryEvent{
+		createTestEventWorkflowExecutionStarted(1, &historypb.WorkflowExecutionStartedEventAttributes{
+			WorkflowType: &commonpb.WorkflowType{Name: "testReplayWorkflowUpsertMemo"},
+			TaskQueue:    &taskqueuepb.TaskQueue{Name: taskQueue},
+			Input:        testEncodeFunctionArgs(dc),
+		}),
+		createTestEventWorkflowTaskScheduled(2, &historypb.WorkflowTaskScheduledEventAttributes{}),
+		createTestEventWorkflowTaskStarted(3),
+		createTestEventWorkflowTaskCompleted(4, &historypb.WorkflowTaskCompletedEventAttributes{}),
+		createTestEventMarkerRecorded(5, &historypb.MarkerRecordedEventAttributes{
+			MarkerName:                   upsertMemoMarkerName,
+			Details:                      map[string]*commonpb.Payloads{upsertMemoMarkerDataName: memoPayloads},
+			WorkflowTaskCompletedEventId: 4,
+		}),
+		createTestEventWorkflowExecutionCompleted(6, &historypb.WorkflowExecutionCompletedEventAttributes{
+			WorkflowTaskCompletedEventId: 4,
+		}),
+	}
+
+	history := &historypb.History{Events: testEvents}
+	logger := getLogger()
+	replayer := NewWorkflowReplayerWithOptions(WorkflowReplayerOptions{DataConverter: dc})
+	replayer.RegisterWorkflow(testReplayWorkflowUpsertMemo)
+	err = replayer.ReplayWorkflowHistory(logger, history)
+	require.NoError(s.T(), err)
+}
+
+func testReplayWorkflowHistoryLength(ctx Context) error {
+	info := GetWorkflowInfo(ctx)
+	if info.GetCurrentHistoryLength() != 3 || info.GetCurrentHistorySize() == 0 || info.GetContinueAsNewSuggested() {
+		return fmt.Errorf("unexpected history stats: length %v, size %v", info.GetCurrentHistoryLength(), info.GetCurrentHistorySize())
+	}
+	ao := ActivityOptions{
+		ScheduleToStartTimeout: time.Second,
+		StartToCloseTimeout:    time.Second,
+	}
+	ctx = WithActivityOptions(ctx, ao)
+	err := ExecuteActivity(ctx, "testActivity").Get(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if info.GetCurrentHistoryLength() != 9 {
+		return fmt.Errorf("unexpected history length %v", info.GetCurrentHistoryLength())
+	}
+	return nil
+}
+
+func testReplayWorkflowContinueAsNewSuggested(ctx Context) error {
+	info := GetWorkflowInfo(ctx)
+	if info.GetContinueAsNewSuggested() {
+		return errors.New("continue-as-new suggested at the first workflow task")
+	}
+	ctx = WithActivityOptions(ctx, ActivityOptions{
+		ScheduleToStartTimeout: time.Second,
+		StartToCloseTimeout:    time.Second,
+	})
+	if err := ExecuteActivity(ctx, "testActivity").Get(ctx, nil); err != nil {
+		return err
+	}
+	if !info.GetContinueAsNewSuggested() {
+		return fmt.Errorf("continue-as-new not suggested at history length %v", info.GetCurrentHistoryLength())
+	}
+	return nil
+}
+
+func (s *internalWorkerTestSuite) TestReplayWorkflowHistory_HistoryLength() {
+	history := createTestHistoryWithActivity("testReplayWorkflowHistoryLength")
+	logger := getLogger()
+	replayer := NewWorkflowReplayer()
+	replayer.RegisterWorkflow(testReplayWorkflowHistoryLength)
+	err := replayer.ReplayWorkflowHistory(logger, history)
+	require.NoError(s.T(), err)
+}
+
+func (s *internalWorkerTestSuite) TestReplayWorkflowHistory_ContinueAsNewSuggestedHistoryLength() {
+	history := createTestHistoryWithActivity("testReplayWorkflowContinueAsNewSuggested")
+	logger := getLogger()
+	replayer := NewWorkflowReplayerWithOptions(WorkflowReplayerOptions{ContinueAsNewSuggestedHistoryLength: 5})
+	replayer.RegisterWorkflow(testReplayWorkflowContinueAsNewSuggested)
+	err := replayer.ReplayWorkflowHistory(logger, history)
+	require.NoError(s.T(), err)
+}
+
+// createTestHistoryWithActivity returns history of a completed workflow that executed a single activity.
+func createTestHistoryWithActivity(workflowType string) *historypb.History {
+	taskQueue := "taskQueue1"
+	testEvents := []*historypb.HistoryEvent{
+		createTestEventWorkflowExecutionStarted(1, &historypb.WorkflowExecutionStartedEventAttributes{
+			WorkflowType: &commonpb.WorkflowType{Name: workflowType},
+			TaskQueue:    &taskqueuepb.TaskQueue{Name: taskQueue},
+			Input:        testEncodeFunctionArgs(converter.GetDefaultDataConverter()),
+		}),
+		createTestEventWorkflowTaskScheduled(2, &historypb.WorkflowTaskScheduledEventAttributes{}),
+		createTestEventWorkflowTaskStarted(3),
+		createTestEventWorkflowTaskCompleted(4, &historypb.WorkflowTaskCompletedEventAttributes{}),
+		createTestEventActivityTaskScheduled(5, &historypb.ActivityTaskScheduledEventAttributes{
+			ActivityId:   "5",
+			ActivityType: &commonpb.ActivityType{Name: "testActivity"},
+			TaskQueue:    &taskqueuepb.TaskQueue{Name: taskQueue},
+		}),
+		createTestEventActivityTaskStarted(6, &historypb.ActivityTaskStartedEventAttributes{
+			ScheduledEventId: 5,
+		}),
+		createTestEventActivityTaskCompleted(7, &historypb.ActivityTaskCompletedEventAttributes{
+			ScheduledEventId: 5,
+			StartedEventId:   6,
+		}),
+		createTestEventWorkflowTaskScheduled(8, &historypb.WorkflowTaskScheduledEventAttributes{}),
+		createTestEventWorkflowTaskStarted(9),
+		createTestEventWorkflowTaskCompleted(10, &historypb.WorkflowTaskCompletedEventAttributes{
+			ScheduledEventId: 8,
+			StartedEventId:   9,
+		}),
+		createTestEventWorkflowExecutionCompleted(11, &historypb.WorkflowExecutionCompletedEventAttributes{
+			WorkflowTaskCompletedEventId: 10,
+		}),
+	}
+
+	return &historypb.History{Events: testEvents}
+}
+
+// expected history size at the second workflow task of testReplayWorkflowHistorySizeWithMarker, set by the test.
+var testReplayHistorySizeWithMarker int
+
+func testReplayWorkflowHistorySizeWithMarker(ctx Context) error {
+	var id string
+	if err := SideEffect(ctx, func(ctx Context) interface{} { return "TEST-UNIQUE-ID" }).Get(&id); err != nil {
+		return err
+	}
+	ctx = WithActivityOptions(ctx, ActivityOptions{
+		ScheduleToStartTimeout: time.Second,
+		StartToCloseTimeout:    time.Second,
+	})
+	if err := ExecuteActivity(ctx, "testActivity").Get(ctx, nil); err != nil {
+		return err
+	}
+	info := GetWorkflowInfo(ctx)
+	if info.GetCurrentHistoryLength() != 10 || info.GetCurrentHistorySize() != testReplayHistorySizeWithMarker {
+		return fmt.Errorf("unexpected history stats: length %v, size %v", info.GetCurrentHistoryLength(), info.GetCurrentHistorySize())
+	}
+	return nil
+}
+
+func (s *internalWorkerTestSuite) TestReplayWorkflowHistory_HistorySizeWithMarker() {
+	taskQueue := "taskQueue1"
+	sideEffectPayloads, err := s.dataConverter.ToPayloads("TEST-UNIQUE-ID")
+	s.NoError(err)
+	testEvents := []*historypb.HistoryEvent{
+		createTestEventWorkflowExecutionStarted(1, &historypb.WorkflowExecutionStartedEventAttributes{
+			WorkflowType: &commonpb.WorkflowType{Name: "testReplayWorkflowHistorySizeWithMarker"},
+			TaskQueue:    &taskqueuepb.TaskQueue{Name: taskQueue},
+			Input:        testEncodeFunctionArgs(converter.GetDefaultDataConverter()),
+		}),
+		createTestEventWorkflowTaskScheduled(2, &historypb.WorkflowTaskScheduledEventAttributes{}),
+		createTestEventWorkflowTaskStarted(3),
+		createTestEventWorkflowTaskCompleted(4, &historypb.WorkflowTaskCompletedEventAttributes{}),
+		createTestEventMarkerRecorded(5, &historypb.MarkerRecordedEventAttributes{
+			MarkerName:                   sideEffectMarkerName,
+			Details:                      s.createSideEffectMarkerDataForTest(sideEffectPayloads, 1),
+			WorkflowTaskCompletedEventId: 4,
+		}),
+		createTestEventActivityTaskScheduled(6, &historypb.ActivityTaskScheduledEventAttributes{
+			ActivityId:   "6",
+			ActivityType: &commonpb.ActivityType{Name: "testActivity"},
+			TaskQueue:    &taskqueuepb.TaskQueue{Name: taskQueue},
+		}),
+		createTestEventActivityTaskStarted(7, &historypb.ActivityTaskStartedEventAttributes{
+			ScheduledEventId: 6,
+		}),
+		createTestEventActivityTaskCompleted(8, &historypb.ActivityTaskCompletedEventAttributes{
+			ScheduledEventId: 6,
+			StartedEventId:   7,
+		}),
+		createTestEventWorkflowTaskScheduled(9, &historypb.WorkflowTaskScheduledEventAttributes{}),
+		createTestEventWorkflowTaskStarted(10),
+		createTestEventWorkflowTaskCompleted(11, &historypb.WorkflowTaskCompletedEventAttributes{
+			ScheduledEventId: 9,
+			StartedEventId:   10,
+		}),
+		createTestEventWorkflowExecutionCompleted(12, &historypb.WorkflowExecutionCompletedEventAttributes{
+			WorkflowTaskCompletedEventId: 11,
+		}),
+	}
+	// all events up to the second workflow task started, including the marker and workflow task scheduled events
+	testReplayHistorySizeWithMarker = 0
+	for _, event := range testEvents[:10] {
+		testReplayHistorySizeWithMarker += event.Size()
+	}
+
+	history := &historypb.History{Events: testEvents}
+	logger := getLogger()
+	replayer := NewWorkflowReplayer()
+	replayer.RegisterWorkflow(testReplayWorkflowHistorySizeWithMarker)
+	err = replayer.ReplayWorkflowHistory(logger, history)
+	require.NoError(s.T(), err)
+}
+
+func testReplayWorkflowRandomAfterReset(ctx Context) error {
+	// the seed recorded by the original run is used before the reset point
+	expected := rand.New(rand.NewSource(111 + 1)).Int63()
+	if v := NewRandom(ctx).Int63(); v != expected {
+		return fmt.Errorf("unexpected random value before reset %v", v)
+	}
+	ao := ActivityOptions{
+		ScheduleToStartTimeout: time.Second,
+		StartToCloseTimeout:    time.Second,
+	}
+	ctx = WithActivityOptions(ctx, ao)
+	err := ExecuteActivity(ctx, "testActivity").Get(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// the reset run recorded a new seed
+	expected = rand.New(rand.NewSource(222 + 1)).Int63()
+	if v := NewRandom(ctx).Int63(); v != expected {
+		return fmt.Errorf("unexpected random value after reset %v", v)
+	}
+	return nil
+}
+
+func (s *internalWorkerTestSuite) TestReplayWorkflowHistory_RandomAfterReset() {
+	taskQueue := "taskQueue1"
+	seed1, err := s.dataConverter.ToPayloads(int64(111))
+	s.NoError(err)
+	seed2, err := s.dataConverter.ToPayloads(int64(222))
+	s.NoError(err)
+	testEvents := []*historypb.HistoryEvent{
+		createTestEventWorkflowExecutionStarted(1, &historypb.WorkflowExecutionStartedEventAttributes{
+			WorkflowType:           &commonpb.WorkflowType{Name: "testReplayWorkflowRandomAfterReset"},
+			TaskQueue:              &taskqueuepb.TaskQueue{Name: taskQueue},
+			Input:                  testEncodeFunctionArgs(converter.GetDefaultDataConverter()),
+			OriginalExecutionRunId: "original-run-id",
+		}),
+		createTestEventWorkflowTaskScheduled(2, &historypb.WorkflowTaskScheduledEventAttributes{}),
+		createTestEventWorkflowTaskStarted(3),
+		createTestEventWorkflowTaskCompleted(4, &historypb.WorkflowTaskCompletedEventAttributes{}),
+		createTestEventMarkerRecorded(5, &historypb.MarkerRecordedEventAttributes{
+			MarkerName:                   sideEffectMarkerName,
+			Details:                      s.createSideEffectMarkerDataForTest(seed1, 1),
+			WorkflowTaskCompletedEventId: 4,
+		}),
+		createTestEventActivityTaskScheduled(6, &historypb.ActivityTaskScheduledEventAttributes{
+			ActivityId:   "6",
+			ActivityType: &commonpb.ActivityType{Name: "testActivity"},
+			TaskQueue:    &taskqueuepb.TaskQueue{Name: taskQueue},
+		}),
+		createTestEventActivityTaskStarted(7, &historypb.ActivityTaskStartedEventAttributes{
+			ScheduledEventId: 6,
+		}),
+		createTestEventActivityTaskCompleted(8, &historypb.ActivityTaskCompletedEventAttributes{
+			ScheduledEventId: 6,
+			StartedEventId:   7,
+		}),
+		createTestEventWorkflowTaskScheduled(9, &historypb.WorkflowTaskScheduledEventAttributes{}),
+		createTestEventWorkflowTaskStarted(10),
+		createTestEventWorkflowTaskFailed(11, &historypb.WorkflowTaskFailedEventAttributes{
+			ScheduledEventId: 9,
+			StartedEventId:   10,
+			Cause:            enumspb.WORKFLOW_TASK_FAILED_CAUSE_RESET_WORKFLOW,
+			BaseRunId:        "original-run-id",
+			NewRunId:         "reset-run-id",
+		}),
+		createTestEventWorkflowTaskScheduled(12, &historypb.WorkflowTaskScheduledEventAttributes{}),
+		createTestEventWorkflowTaskStarted(13),
+		createTestEventWorkflowTaskCompleted(14, &historypb.WorkflowTaskCompletedEventAttributes{
+			ScheduledEventId: 12,
+			StartedEventId:   13,
+		}),
+		createTestEventMarkerRecorded(15, &historypb.MarkerRecordedEventAttributes{
+			MarkerName:                   sideEffectMarkerName,
+			Details:                      s.createSideEffectMarkerDataForTest(seed2, 2),
+			WorkflowTaskCompletedEventId: 14,
+		}),
+		createTestEventWorkflowExecutionCompleted(16, &historypb.WorkflowExecutionCompletedEventAttributes{
+			WorkflowTaskCompletedEventId: 14,
+		}),
+	}
+
+	history := &historypb.History{Events: testEvents}
+	logger := getLogger()
+	replayer := NewWorkflowReplayer()
+	replayer.RegisterWorkflow(testReplayWorkflowRandomAfterReset)
+	err = replayer.ReplayWorkflowHistory(logger, history)
+	require.NoError(s.T(), err)
+}
+
 func testReplayWorkflowGetVersion(ctx Context) error {
 	version := GetVersion(ctx, "change_id_A", Version(3), Version(3))
 	if version != Version(3) {
@@ -607,6 +1152,37 @@ func (s *internalWorkerTestSuite) TestReplayWorkflowHistory_GetVersion_AddNewBef
 	require.NoError(s.T(), err)
 }
 
+func testReplayWorkflowPatched(ctx Context) error {
+	// the patch was deployed after the execution started, so the old code path is taken
+	if Patched(ctx, "change_id_B") {
+		return errors.New("unexpected patch")
+	}
+	// the execution started before the patch was deprecated, the history has no marker of change_id_C
+	DeprecatePatch(ctx, "change_id_C")
+
+	ao := ActivityOptions{
+		ScheduleToStartTimeout: time.Second,
+		StartToCloseTimeout:    time.Second,
+	}
+	ctx = WithActivityOptions(ctx, ao)
+	for i := 0; i < 3; i++ {
+		if err := ExecuteActivity(ctx, "testActivity").Get(ctx, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *internalWorkerTestSuite) TestReplayWorkflowHistory_Patched() {
+	testEvents := createHistoryForGetVersionTests("testReplayWorkflowPatched")
+	history := &historypb.History{Events: testEvents}
+	logger := getLogger()
+	replayer := NewWorkflowReplayer()
+	replayer.RegisterWorkflow(testReplayWorkflowPatched)
+	err := replayer.ReplayWorkflowHistory(logger, history)
+	require.NoError(s.T(), err)
+}
+
 func createHistoryForGetVersionTests(workflowType string) []*historypb.HistoryEvent {
 	taskQueue := "taskQueue1"
 	return []*historypb.HistoryEvent{
@@ -1331,6 +1907,10 @@ func (s *internalWorkerTestSuite) TestReplayWorkflowHistory_LocalActivity_Result
 	}
 	require.Error(s.T(), err)
 	require.True(s.T(), strings.HasPrefix(err.Error(), "replay workflow doesn't return the same result as the last event"))
+	var ndErr *NonDeterminismError
+	require.True(s.T(), errors.As(err, &ndErr))
+	require.EqualValues(s.T(), 7, ndErr.EventID())
+	require.Equal(s.T(), enumspb.COMMAND_TYPE_COMPLETE_WORKFLOW_EXECUTION, ndErr.Command().GetCommandType())
 }
 
 func (s *internalWorkerTestSuite) TestReplayWorkflowHistory_LocalActivity_Activity_Type_Mismatch() {
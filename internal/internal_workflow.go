@@ -27,15 +27,21 @@ package internal
 // All code in this file is private to the package.
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"math/rand"
 	"reflect"
 	"runtime"
+	"runtime/pprof"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 	"unicode"
 
+	"github.com/pborman/uuid"
 	commonpb "go.temporal.io/api/common/v1"
 	enumspb "go.temporal.io/api/enums/v1"
 	"go.uber.org/atomic"
@@ -47,6 +53,12 @@ import (
 const (
 	defaultSignalChannelSize = 100000 // really large buffering size(100K)
 
+	// coroutineDebugLabel is a profiler label with a value unique to each coroutine goroutine in debug mode. Label is
+	// inherited by goroutines started from workflow code, which allows to find them.
+	coroutineDebugLabel = "temporal-workflow-coroutine"
+	// coroutineDebugCheckInterval is an interval of checks if coroutine is blocked outside of dispatcher control.
+	coroutineDebugCheckInterval = 50 * time.Millisecond
+
 	panicIllegalAccessCoroutinueState = "getState: illegal access from outside of workflow context"
 )
 
@@ -79,6 +91,41 @@ type (
 		settable Settable // used to unblock the future when all coroutines have completed
 	}
 
+	// Implements Semaphore interface
+	semaphoreImpl struct {
+		size    int64
+		cur     int64
+		waiters []*semaphoreWaiter // waiters in the order of Acquire calls
+	}
+
+	semaphoreWaiter struct {
+		n        int64
+		acquired bool
+	}
+
+	// Implements Mutex interface
+	mutexImpl struct {
+		semaphore *semaphoreImpl
+	}
+
+	// workflowRandomness creates random generators for workflow code from the seed provided by WorkflowEnvironment
+	workflowRandomness struct {
+		seed  int64
+		count int64      // number of generators created with the seed
+		uuid  *rand.Rand // generator used by NewUUID
+	}
+
+	// Implements ErrGroup interface
+	errGroupImpl struct {
+		ctx     Context
+		cancel  CancelFunc
+		wg      WaitGroup
+		err     error                     // the first error returned by a function of the group
+		limit   int                       // maximum number of running functions, no limit if not positive
+		running int                       // number of running functions
+		pending []func(ctx Context) error // functions waiting for a running one to return
+	}
+
 	// Dispatcher is a container of a set of coroutines.
 	dispatcher interface {
 		// ExecuteUntilAllBlocked executes coroutines one by one in deterministic order
@@ -157,7 +204,10 @@ type (
 		keptBlocked  bool             // true indicates that coroutine didn't make any progress since the last yield unblocking
 		closed       atomic.Bool      // indicates that owning coroutine has finished execution
 		blocked      atomic.Bool
-		panicError   error // non nil if coroutine had unhandled panic
+		detached     atomic.Bool // closed by the dispatcher while blocked outside of its control, set in debug mode only
+		panicError   error       // non nil if coroutine had unhandled panic
+		goroutineID  string      // id of the goroutine running the coroutine, set in debug mode only
+		debugLabel   string      // value of coroutineDebugLabel of the goroutine running the coroutine
 	}
 
 	dispatcherImpl struct {
@@ -169,6 +219,7 @@ type (
 		mutex            sync.Mutex // used to synchronize executing
 		closed           bool
 		interceptor      WorkflowOutboundCallsInterceptor
+		debug            bool // detects native goroutines and blocking calls in workflow code
 	}
 
 	// WorkflowOptions options passed to the workflow function
@@ -189,8 +240,11 @@ type (
 		ContextPropagators       []ContextPropagator
 		Memo                     map[string]interface{}
 		SearchAttributes         map[string]interface{}
+		TypedSearchAttributes    []SearchAttributeUpdate
 		ParentClosePolicy        enumspb.ParentClosePolicy
 		signalChannels           map[string]Channel
+		signalHandlers           map[string]*signalHandler
+		randomness               *workflowRandomness
 		queryHandlers            map[string]func(*commonpb.Payloads) (*commonpb.Payloads, error)
 	}
 
@@ -241,6 +295,12 @@ type (
 		queryType     string
 		dataConverter converter.DataConverter
 	}
+
+	signalHandler struct {
+		fn            interface{}
+		signalName    string
+		dataConverter converter.DataConverter
+	}
 )
 
 const (
@@ -257,6 +317,9 @@ const (
 var _ Channel = (*channelImpl)(nil)
 var _ Selector = (*selectorImpl)(nil)
 var _ WaitGroup = (*waitGroupImpl)(nil)
+var _ Semaphore = (*semaphoreImpl)(nil)
+var _ Mutex = (*mutexImpl)(nil)
+var _ ErrGroup = (*errGroupImpl)(nil)
 var _ dispatcher = (*dispatcherImpl)(nil)
 
 var stackBuf [100000]byte
@@ -553,7 +616,10 @@ func (d *syncWorkflowDefinition) Close() {
 // Context passed to the root function is child of the passed rootCtx.
 // This way rootCtx can be used to pass values to the coroutine code.
 func newDispatcher(rootCtx Context, interceptor *workflowEnvironmentInterceptor, root func(ctx Context)) (*dispatcherImpl, Context) {
-	result := &dispatcherImpl{interceptor: interceptor.outboundInterceptor}
+	result := &dispatcherImpl{
+		interceptor: interceptor.outboundInterceptor,
+		debug:       interceptor.env.IsCoroutineDebugModeEnabled(),
+	}
 	interceptor.dispatcher = result
 	ctxWithState := result.interceptor.Go(rootCtx, "root", root)
 	return result, ctxWithState
@@ -593,6 +659,7 @@ func getState(ctx Context) *coroutineState {
 		panic("getState: not workflow context")
 	}
 	state := s.(*coroutineState)
+	state.exitIfDetached()
 	if !state.dispatcher.IsExecuting() {
 		panic(panicIllegalAccessCoroutinueState)
 	}
@@ -829,6 +896,7 @@ func (s *coroutineState) initialYield(stackDepth int, status string) {
 // yield indicates that coroutine cannot make progress and should sleep
 // this call blocks
 func (s *coroutineState) yield(status string) {
+	s.exitIfDetached()
 	s.aboutToBlock <- true
 	s.initialYield(3, status) // omit three levels of stack. To adjust change to 0 and count the lines to remove.
 	s.keptBlocked = true
@@ -875,17 +943,83 @@ func (s *coroutineState) call(timeout time.Duration) {
 	}
 	deadlockTimer := time.NewTimer(timeout)
 	defer func() { deadlockTimer.Stop() }()
+	var debugTicker <-chan time.Time
+	if s.dispatcher.debug {
+		ticker := time.NewTicker(coroutineDebugCheckInterval)
+		defer ticker.Stop()
+		debugTicker = ticker.C
+	}
 
-	select {
-	case <-s.aboutToBlock:
-	case <-deadlockTimer.C:
-		s.closed.Store(true)
-		panic(fmt.Sprintf("Potential deadlock detected: "+
-			"workflow goroutine %q didn't yield for over a second", s.name))
+	lastBlockedStatus := ""
+	for {
+		select {
+		case <-s.aboutToBlock:
+			return
+		case <-debugTicker:
+			// require the same status twice to skip short waits like lock acquisition by a logger
+			status, stack := s.nativeBlockingStatus()
+			if status != "" && status == lastBlockedStatus {
+				s.detached.Store(true)
+				s.closed.Store(true)
+				s.panicError = newWorkflowPanicError(fmt.Sprintf("workflow coroutine %q is blocked on %v outside of "+
+					"dispatcher control, use workflow.Sleep, workflow.Channel, workflow.Selector or workflow.Mutex "+
+					"instead of native ones", s.name, status), stack)
+				return
+			}
+			lastBlockedStatus = status
+		case <-deadlockTimer.C:
+			s.closed.Store(true)
+			panic(fmt.Sprintf("Potential deadlock detected: "+
+				"workflow goroutine %q didn't yield for over a second", s.name))
+		}
+	}
+}
+
+// initDebug labels the goroutine running the coroutine, so the goroutines started from it can be found.
+func (s *coroutineState) initDebug() {
+	labels := pprof.Labels(coroutineDebugLabel, s.debugLabel)
+	pprof.SetGoroutineLabels(pprof.WithLabels(context.Background(), labels))
+	s.goroutineID = getCurrentGoroutineID()
+}
+
+// nativeBlockingStatus returns status and stack trace of the goroutine running the coroutine if it is blocked
+// outside of dispatcher control. Returns empty status otherwise.
+func (s *coroutineState) nativeBlockingStatus() (status string, stackTrace string) {
+	stackTrace = getGoroutineStackTrace(s.goroutineID)
+	if stackTrace == "" || strings.Contains(stackTrace, "(*coroutineState).initialYield") {
+		return "", ""
+	}
+	// the first line is "goroutine 1 [chan receive, 2 minutes]:"
+	header := stackTrace[:strings.Index(stackTrace, "\n")]
+	status = header[strings.Index(header, "[")+1 : strings.LastIndex(header, "]")]
+	if i := strings.Index(status, ","); i >= 0 {
+		status = status[:i]
+	}
+	switch status {
+	case "running", "runnable", "syscall", "preempted":
+		return "", ""
+	}
+	return status, stackTrace
+}
+
+// exitIfDetached exits the goroutine of a coroutine detached by the dispatcher when it returns from the native blocking
+// call, so it doesn't run workflow code concurrently with the dispatcher. The workflow code between the native call and
+// the next call to the SDK can't be stopped.
+func (s *coroutineState) exitIfDetached() {
+	if s.detached.Load() {
+		runtime.Goexit()
 	}
 }
 
 func (s *coroutineState) close() {
+	if s.detached.Load() {
+		// the dispatcher has already closed the coroutine
+		return
+	}
+	if s.dispatcher.debug {
+		// goroutines still carrying the label after the coroutine is closed are native ones
+		pprof.SetGoroutineLabels(context.Background())
+	}
 	s.closed.Store(true)
 	s.aboutToBlock <- true
 }
@@ -917,17 +1051,27 @@ func (d *dispatcherImpl) NewCoroutine(ctx Context, name string, f func(ctx Conte
 	}
 	state := d.newState(name)
 	spawned := WithValue(ctx, coroutinesContextKey, state)
+	// in debug mode the new goroutine inherits labels of the caller until it replaces them with its own, wait for
+	// that so the caller coroutine is not reported for starting a native goroutine
+	debugReady := make(chan struct{})
 	go func(crt *coroutineState) {
 		defer crt.close()
 		defer func() {
-			if r := recover(); r != nil {
+			if r := recover(); r != nil && !crt.detached.Load() {
 				st := getStackTrace(name, "panic", 4)
 				crt.panicError = newWorkflowPanicError(r, st)
 			}
 		}()
+		if d.debug {
+			crt.initDebug()
+		}
+		close(debugReady)
 		crt.initialYield(1, "")
 		f(spawned)
 	}(state)
+	if d.debug {
+		<-debugReady
+	}
 	return spawned
 }
 
@@ -939,6 +1083,9 @@ func (d *dispatcherImpl) newState(name string) *coroutineState {
 		unblock:      make(chan unblockFunc),
 	}
 	d.sequence++
+	if d.debug {
+		c.debugLabel = fmt.Sprintf("%p/%v", d, d.sequence)
+	}
 	d.coroutines = append(d.coroutines, c)
 	return c
 }
@@ -966,6 +1113,12 @@ func (d *dispatcherImpl) ExecuteUntilAllBlocked(deadlockDetectionTimeout time.Du
 				// TODO: Support handling of panic in a coroutine by dispatcher.
 				// TODO: Dump all outstanding coroutines if one of them panics
 				c.call(deadlockDetectionTimeout)
+				if d.debug && c.panicError == nil {
+					if stackTrace := d.nativeGoroutineStackTrace(); stackTrace != "" {
+						return newWorkflowPanicError(fmt.Sprintf("workflow coroutine %q started native goroutine, "+
+							"use workflow.Go instead", c.name), stackTrace)
+					}
+				}
 			}
 			// c.call() can close the context so check again
 			if c.closed.Load() {
@@ -991,6 +1144,73 @@ func (d *dispatcherImpl) ExecuteUntilAllBlocked(deadlockDetectionTimeout time.Du
 	return nil
 }
 
+// nativeGoroutineStackTrace returns stack trace of goroutines started by workflow code of the dispatcher
+// coroutines, empty string if there are none. Each coroutine goroutine carries a label unique to the coroutine, so
+// any other goroutine with a label of the dispatcher coroutines was started by workflow code.
+func (d *dispatcherImpl) nativeGoroutineStackTrace() string {
+	expected := make(map[string]int)
+	for _, c := range d.coroutines {
+		if !c.closed.Load() {
+			expected[c.debugLabel] = 1
+		}
+	}
+	var profile bytes.Buffer
+	_ = pprof.Lookup("goroutine").WriteTo(&profile, 1)
+	prefix := fmt.Sprintf("%q:\"%p/", coroutineDebugLabel, d)
+	counts := make(map[string]int)
+	groups := make(map[string][]string)
+	// profile starts with "goroutine profile: total <count>" line and groups goroutines with the same stack and
+	// labels, groups are separated by an empty line and start with "<count> @ <pcs>" line followed by labels
+	groupsText := profile.String()
+	groupsText = groupsText[strings.Index(groupsText, "\n")+1:]
+	for _, group := range strings.Split(groupsText, "\n\n") {
+		i := strings.Index(group, prefix)
+		if i < 0 {
+			continue
+		}
+		value := group[i+len(coroutineDebugLabel)+4:]
+		value = value[:strings.Index(value, `"`)]
+		lines := strings.SplitN(strings.TrimSpace(group), "\n", 2)
+		count, err := strconv.Atoi(strings.Fields(lines[0])[0])
+		if err != nil {
+			continue
+		}
+		counts[value] += count
+		groups[value] = append(groups[value], group)
+	}
+	for value, count := range counts {
+		if count > expected[value] {
+			return strings.Join(groups[value], "\n\n")
+		}
+	}
+	return ""
+}
+
+func getCurrentGoroutineID() string {
+	var buf [64]byte
+	// stack trace starts with "goroutine 1 [running]:"
+	return strings.Fields(string(buf[:runtime.Stack(buf[:], false)]))[1]
+}
+
+func getGoroutineStackTrace(goroutineID string) string {
+	buf := make([]byte, 64*1024)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	prefix := fmt.Sprintf("goroutine %v [", goroutineID)
+	for _, stackTrace := range strings.Split(string(buf), "\n\n") {
+		if strings.HasPrefix(stackTrace, prefix) {
+			return stackTrace
+		}
+	}
+	return ""
+}
+
 func (d *dispatcherImpl) IsDone() bool {
 	return len(d.coroutines) == 0
 }
@@ -1229,6 +1449,8 @@ func setWorkflowEnvOptionsIfNotExist(ctx Context) Context {
 		newOptions = *options
 	} else {
 		newOptions.signalChannels = make(map[string]Channel)
+		newOptions.signalHandlers = make(map[string]*signalHandler)
+		newOptions.randomness = &workflowRandomness{}
 		newOptions.queryHandlers = make(map[string]func(*commonpb.Payloads) (*commonpb.Payloads, error))
 	}
 	if newOptions.DataConverter == nil {
@@ -1413,6 +1635,74 @@ func (h *queryHandler) execute(input *commonpb.Payloads) (result *commonpb.Paylo
 	return result, err
 }
 
+func setSignalHandler(ctx Context, signalName string, handler interface{}) error {
+	sh := &signalHandler{fn: handler, signalName: signalName, dataConverter: getDataConverterFromWorkflowContext(ctx)}
+	err := sh.validateHandlerFn()
+	if err != nil {
+		return err
+	}
+
+	eo := getWorkflowEnvOptions(ctx)
+	_, dispatching := eo.signalHandlers[signalName]
+	eo.signalHandlers[signalName] = sh
+	if dispatching {
+		return nil
+	}
+
+	// Signals are delivered through the signal channel, so the ones received before the handler is set are not lost.
+	ch := eo.getSignalChannel(ctx, signalName).(*channelImpl)
+	getState(ctx).dispatcher.NewCoroutine(ctx, fmt.Sprintf("%v-signal-dispatcher", signalName), func(ctx Context) {
+		selector := NewSelector(ctx)
+		selector.AddReceive(ch, func(c ReceiveChannel, more bool) {
+			v, ok, _ := ch.receiveAsyncImpl(nil)
+			if !ok {
+				return
+			}
+			// handler is looked up on every delivery as it can be replaced by SetSignalHandler
+			input, _ := v.(*commonpb.Payloads)
+			eo.signalHandlers[signalName].execute(ctx, input)
+		})
+		for {
+			selector.Select(ctx)
+		}
+	})
+	return nil
+}
+
+func (h *signalHandler) validateHandlerFn() error {
+	fnType := reflect.TypeOf(h.fn)
+	if fnType == nil || fnType.Kind() != reflect.Func {
+		return fmt.Errorf("signal handler must be function but was %v", fnType)
+	}
+
+	if fnType.NumIn() == 0 || !isWorkflowContext(fnType.In(0)) {
+		return fmt.Errorf("first argument of signal handler must be workflow.Context")
+	}
+
+	if fnType.NumOut() != 0 {
+		return fmt.Errorf("signal handler must not return values, but found %d return values", fnType.NumOut())
+	}
+	return nil
+}
+
+// execute starts the handler in a new coroutine, handlers are started in the order signals with the same name are
+// delivered.
+func (h *signalHandler) execute(ctx Context, input *commonpb.Payloads) {
+	fnType := reflect.TypeOf(h.fn)
+	decoded, err := decodeArgs(h.dataConverter, fnType, input)
+	if err != nil {
+		env := getWorkflowEnvironment(ctx)
+		env.GetLogger().Error(fmt.Sprintf("Deserialization error. Corrupted signal received for handler %s.", h.signalName), tagError, err)
+		env.GetMetricsScope().Counter(metrics.CorruptedSignalsCounter).Inc(1)
+		return
+	}
+
+	getState(ctx).dispatcher.NewCoroutine(ctx, h.signalName, func(ctx Context) {
+		args := append([]reflect.Value{reflect.ValueOf(ctx)}, decoded...)
+		reflect.ValueOf(h.fn).Call(args)
+	})
+}
+
 // Add adds delta, which may be negative, to the WaitGroup counter.
 // If the counter becomes zero, all goroutines blocked on Wait are released.
 // If the counter goes negative, Add panics.
@@ -1464,3 +1754,189 @@ func (wg *waitGroupImpl) Wait(ctx Context) {
 	}
 	wg.future, wg.settable = NewFuture(ctx)
 }
+
+func newSemaphore(n int64) *semaphoreImpl {
+	return &semaphoreImpl{size: n}
+}
+
+// Acquire blocks until n permits are acquired or ctx is canceled.
+// Waiters are granted permits in the order of Acquire calls, so the result doesn't depend on coroutine scheduling
+// and is the same during replay.
+func (s *semaphoreImpl) Acquire(ctx Context, n int64) error {
+	if n <= 0 || n > s.size {
+		return fmt.Errorf("unable to acquire %v permits from semaphore of size %v", n, s.size)
+	}
+	if len(s.waiters) == 0 && s.size-s.cur >= n {
+		s.cur += n
+		return nil
+	}
+
+	w := &semaphoreWaiter{n: n}
+	s.waiters = append(s.waiters, w)
+	err := Await(ctx, func() bool { return w.acquired })
+	if err != nil && !w.acquired {
+		s.removeWaiter(w)
+		// removed waiter could block the ones behind it
+		s.notifyWaiters()
+		return err
+	}
+	return nil
+}
+
+// TryAcquire acquires n permits without blocking. Returns false if permits are not available or there are
+// coroutines waiting for them.
+func (s *semaphoreImpl) TryAcquire(_ Context, n int64) bool {
+	if n <= 0 {
+		return false
+	}
+	if len(s.waiters) == 0 && s.size-s.cur >= n {
+		s.cur += n
+		return true
+	}
+	return false
+}
+
+// Release releases n permits and grants them to waiting coroutines.
+func (s *semaphoreImpl) Release(n int64) {
+	if n <= 0 {
+		panic(fmt.Sprintf("semaphore released invalid number of permits %v", n))
+	}
+	s.cur -= n
+	if s.cur < 0 {
+		panic("semaphore released more than held")
+	}
+	s.notifyWaiters()
+}
+
+func (s *semaphoreImpl) notifyWaiters() {
+	for len(s.waiters) > 0 {
+		w := s.waiters[0]
+		if s.size-s.cur < w.n {
+			// keep the order of waiters, big request blocks the smaller ones behind it
+			break
+		}
+		s.cur += w.n
+		w.acquired = true
+		s.waiters[0] = nil
+		s.waiters = s.waiters[1:]
+	}
+}
+
+func (s *semaphoreImpl) removeWaiter(w *semaphoreWaiter) {
+	for i, waiter := range s.waiters {
+		if waiter == w {
+			s.waiters = append(s.waiters[:i], s.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+// Lock blocks until the mutex is acquired or ctx is canceled.
+func (m *mutexImpl) Lock(ctx Context) error {
+	return m.semaphore.Acquire(ctx, 1)
+}
+
+// TryLock acquires the mutex without blocking.
+func (m *mutexImpl) TryLock(ctx Context) bool {
+	return m.semaphore.TryAcquire(ctx, 1)
+}
+
+// Unlock releases the mutex.
+func (m *mutexImpl) Unlock() {
+	if m.semaphore.cur == 0 {
+		panic("Mutex.Unlock of unlocked mutex")
+	}
+	m.semaphore.Release(1)
+}
+
+// IsLocked returns true if the mutex is held.
+func (m *mutexImpl) IsLocked() bool {
+	return m.semaphore.cur > 0
+}
+
+// Go starts f in a new coroutine, or queues it if the limit of running functions is reached.
+func (g *errGroupImpl) Go(f func(ctx Context) error) {
+	g.wg.Add(1)
+	if g.limit > 0 && g.running >= g.limit {
+		g.pending = append(g.pending, f)
+		return
+	}
+	g.start(f)
+}
+
+func (g *errGroupImpl) start(f func(ctx Context) error) {
+	g.running++
+	Go(g.ctx, func(ctx Context) {
+		defer g.wg.Done()
+		err := f(ctx)
+		if err != nil && g.err == nil {
+			g.err = err
+			// cancel siblings on the first error
+			g.cancel()
+		}
+		g.running--
+		if len(g.pending) > 0 {
+			next := g.pending[0]
+			g.pending[0] = nil
+			g.pending = g.pending[1:]
+			g.start(next)
+		}
+	})
+}
+
+// Wait blocks until all functions have returned and returns the first error.
+func (g *errGroupImpl) Wait(ctx Context) error {
+	g.wg.Wait(ctx)
+	g.cancel()
+	return g.err
+}
+
+// SetLimit limits the number of running functions.
+func (g *errGroupImpl) SetLimit(n int) {
+	g.limit = n
+}
+
+// newRecordedRandomSeed returns a new seed of workflow random generators. The seed is recorded with sideEffect, so the
+// same seed is returned when the workflow is replayed.
+func newRecordedRandomSeed(sideEffect func(f func() (*commonpb.Payloads, error), callback ResultHandler), dc converter.DataConverter) int64 {
+	var seed int64
+	sideEffect(func() (*commonpb.Payloads, error) {
+		return dc.ToPayloads(rand.Int63())
+	}, func(result *commonpb.Payloads, err error) {
+		if err == nil {
+			err = dc.FromPayloads(result, &seed)
+		}
+		if err != nil {
+			panic(err)
+		}
+	})
+	return seed
+}
+
+// newRandom returns a new generator. Each generator created with the same seed gets a different sequence.
+func (r *workflowRandomness) newRandom(seed int64) *rand.Rand {
+	r.reseed(seed)
+	r.count++
+	return rand.New(rand.NewSource(r.seed + r.count))
+}
+
+func (r *workflowRandomness) newUUID(seed int64) string {
+	r.reseed(seed)
+	if r.uuid == nil {
+		r.uuid = r.newRandom(seed)
+	}
+	id := make(uuid.UUID, 16)
+	_, _ = r.uuid.Read(id)
+	// version 4 (random) UUID as described in RFC 4122
+	id[6] = (id[6] & 0x0f) | 0x40
+	id[8] = (id[8] & 0x3f) | 0x80
+	return id.String()
+}
+
+func (r *workflowRandomness) reseed(seed int64) {
+	if r.seed != seed {
+		r.seed = seed
+		r.count = 0
+		r.uuid = nil
+	}
+}
@@ -41,6 +41,7 @@ import (
 	querypb "go.temporal.io/api/query/v1"
 	"go.temporal.io/api/serviceerror"
 	taskqueuepb "go.temporal.io/api/taskqueue/v1"
+	workflowpb "go.temporal.io/api/workflow/v1"
 	"go.temporal.io/api/workflowservice/v1"
 
 	"go.temporal.io/sdk/converter"
@@ -146,6 +147,49 @@ type (
 		// func which use a next token to get next page of history events
 		paginate func(nexttoken []byte) (*workflowservice.GetWorkflowExecutionHistoryResponse, error)
 	}
+
+	// WorkflowExecutionEntry is a single workflow execution returned by the visibility list APIs.
+	// Memo and SearchAttributes are decoded through the client's DataConverter.
+	WorkflowExecutionEntry struct {
+		// Info is the raw execution info returned by the server.
+		Info *workflowpb.WorkflowExecutionInfo
+		// Memo of the workflow execution keyed by memo field name.
+		Memo map[string]converter.EncodedValue
+		// SearchAttributes of the workflow execution keyed by search attribute name.
+		SearchAttributes map[string]converter.EncodedValue
+	}
+
+	// WorkflowExecutionIterator represents the interface for
+	// workflow execution iterator returned by the visibility list APIs
+	WorkflowExecutionIterator interface {
+		// HasNext return whether this iterator has next value
+		HasNext() bool
+		// Next returns the next workflow execution and error
+		// The errors it can return:
+		//	- BadRequestError
+		//	- InternalServiceError
+		//	- context.Canceled or context.DeadlineExceeded if the iterator context is done
+		Next() (*WorkflowExecutionEntry, error)
+	}
+
+	// workflowExecutionIteratorImpl is the implementation of WorkflowExecutionIterator
+	workflowExecutionIteratorImpl struct {
+		ctx           context.Context
+		dataConverter converter.DataConverter
+		// whether this iterator is initialized
+		initialized bool
+		// local cached executions and corresponding consuming index
+		nextIndex  int
+		executions []*workflowpb.WorkflowExecutionInfo
+		// token to get next page of executions
+		nexttoken []byte
+		// err when getting next page of executions
+		err error
+		// whether the iteration is finished and no more values should be returned
+		done bool
+		// func which use a next token to get next page of executions
+		paginate func(ctx context.Context, nexttoken []byte) ([]*workflowpb.WorkflowExecutionInfo, []byte, error)
+	}
 )
 
 // StartWorkflow starts a workflow execution
@@ -183,7 +227,7 @@ func (wc *WorkflowClient) StartWorkflow(
 		return nil, err
 	}
 
-	searchAttr, err := serializeSearchAttributes(options.SearchAttributes)
+	searchAttr, err := serializeStartSearchAttributes(options)
 	if err != nil {
 		return nil, err
 	}
@@ -383,7 +427,7 @@ func (wc *WorkflowClient) SignalWithStartWorkflow(ctx context.Context, workflowI
 		return nil, err
 	}
 
-	searchAttr, err := serializeSearchAttributes(options.SearchAttributes)
+	searchAttr, err := serializeStartSearchAttributes(options)
 	if err != nil {
 		return nil, err
 	}
@@ -721,6 +765,98 @@ func (wc *WorkflowClient) ScanWorkflow(ctx context.Context, request *workflowser
 	return response, nil
 }
 
+// ListClosedWorkflowIterator returns an iterator over closed workflow executions matching the request filters.
+// The iterator transparently fetches next pages starting from request.NextPageToken.
+func (wc *WorkflowClient) ListClosedWorkflowIterator(ctx context.Context, request *workflowservice.ListClosedWorkflowExecutionsRequest) WorkflowExecutionIterator {
+	paginate := func(ctx context.Context, nextToken []byte) ([]*workflowpb.WorkflowExecutionInfo, []byte, error) {
+		pageRequest := *request
+		pageRequest.NextPageToken = nextToken
+		response, err := wc.ListClosedWorkflow(ctx, &pageRequest)
+		if err != nil {
+			return nil, nil, err
+		}
+		return response.GetExecutions(), response.GetNextPageToken(), nil
+	}
+	return newWorkflowExecutionIterator(ctx, wc.dataConverter, request.GetNextPageToken(), paginate)
+}
+
+// ListOpenWorkflowIterator returns an iterator over open workflow executions matching the request filters.
+// The iterator transparently fetches next pages starting from request.NextPageToken.
+func (wc *WorkflowClient) ListOpenWorkflowIterator(ctx context.Context, request *workflowservice.ListOpenWorkflowExecutionsRequest) WorkflowExecutionIterator {
+	paginate := func(ctx context.Context, nextToken []byte) ([]*workflowpb.WorkflowExecutionInfo, []byte, error) {
+		pageRequest := *request
+		pageRequest.NextPageToken = nextToken
+		response, err := wc.ListOpenWorkflow(ctx, &pageRequest)
+		if err != nil {
+			return nil, nil, err
+		}
+		return response.GetExecutions(), response.GetNextPageToken(), nil
+	}
+	return newWorkflowExecutionIterator(ctx, wc.dataConverter, request.GetNextPageToken(), paginate)
+}
+
+// ListWorkflowIterator returns an iterator over workflow executions matching the request query.
+// The iterator transparently fetches next pages starting from request.NextPageToken.
+func (wc *WorkflowClient) ListWorkflowIterator(ctx context.Context, request *workflowservice.ListWorkflowExecutionsRequest) WorkflowExecutionIterator {
+	paginate := func(ctx context.Context, nextToken []byte) ([]*workflowpb.WorkflowExecutionInfo, []byte, error) {
+		pageRequest := *request
+		pageRequest.NextPageToken = nextToken
+		response, err := wc.ListWorkflow(ctx, &pageRequest)
+		if err != nil {
+			return nil, nil, err
+		}
+		return response.GetExecutions(), response.GetNextPageToken(), nil
+	}
+	return newWorkflowExecutionIterator(ctx, wc.dataConverter, request.GetNextPageToken(), paginate)
+}
+
+// ListArchivedWorkflowIterator returns an iterator over archived workflow executions matching the request query.
+// The iterator transparently fetches next pages starting from request.NextPageToken.
+func (wc *WorkflowClient) ListArchivedWorkflowIterator(ctx context.Context, request *workflowservice.ListArchivedWorkflowExecutionsRequest) WorkflowExecutionIterator {
+	paginate := func(ctx context.Context, nextToken []byte) ([]*workflowpb.WorkflowExecutionInfo, []byte, error) {
+		pageRequest := *request
+		pageRequest.NextPageToken = nextToken
+		response, err := wc.ListArchivedWorkflow(ctx, &pageRequest)
+		if err != nil {
+			return nil, nil, err
+		}
+		return response.GetExecutions(), response.GetNextPageToken(), nil
+	}
+	return newWorkflowExecutionIterator(ctx, wc.dataConverter, request.GetNextPageToken(), paginate)
+}
+
+// ScanWorkflowIterator returns an iterator over workflow executions matching the request query.
+// The iterator transparently fetches next pages starting from request.NextPageToken.
+func (wc *WorkflowClient) ScanWorkflowIterator(ctx context.Context, request *workflowservice.ScanWorkflowExecutionsRequest) WorkflowExecutionIterator {
+	paginate := func(ctx context.Context, nextToken []byte) ([]*workflowpb.WorkflowExecutionInfo, []byte, error) {
+		pageRequest := *request
+		pageRequest.NextPageToken = nextToken
+		response, err := wc.ScanWorkflow(ctx, &pageRequest)
+		if err != nil {
+			return nil, nil, err
+		}
+		return response.GetExecutions(), response.GetNextPageToken(), nil
+	}
+	return newWorkflowExecutionIterator(ctx, wc.dataConverter, request.GetNextPageToken(), paginate)
+}
+
+func newWorkflowExecutionIterator(
+	ctx context.Context,
+	dc converter.DataConverter,
+	nextToken []byte,
+	paginate func(ctx context.Context, nexttoken []byte) ([]*workflowpb.WorkflowExecutionInfo, []byte, error),
+) WorkflowExecutionIterator {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return &workflowExecutionIteratorImpl{
+		ctx:           ctx,
+		dataConverter: dc,
+		nexttoken:     nextToken,
+		paginate:      paginate,
+	}
+}
+
 // CountWorkflow implementation
 func (wc *WorkflowClient) CountWorkflow(ctx context.Context, request *workflowservice.CountWorkflowExecutionsRequest) (*workflowservice.CountWorkflowExecutionsResponse, error) {
 	if request.GetNamespace() == "" {
@@ -1044,6 +1180,79 @@ func (iter *historyEventIteratorImpl) Next() (*historypb.HistoryEvent, error) {
 	panic("HistoryEventIterator Next() should return either a history event or a err")
 }
 
+func (iter *workflowExecutionIteratorImpl) HasNext() bool {
+	if iter.done {
+		return false
+	}
+	if iter.err != nil {
+		return true
+	}
+	if err := iter.ctx.Err(); err != nil {
+		// Context is done, report its error once and stop the iteration.
+		iter.executions = nil
+		iter.nexttoken = nil
+		iter.err = err
+		return true
+	}
+	if iter.nextIndex < len(iter.executions) {
+		return true
+	}
+	// Skip empty pages which still have a next page token.
+	for !iter.initialized || len(iter.nexttoken) != 0 {
+		iter.initialized = true
+		executions, nextToken, err := iter.paginate(iter.ctx, iter.nexttoken)
+		iter.nextIndex = 0
+		if err != nil {
+			iter.executions = nil
+			iter.nexttoken = nil
+			iter.err = err
+			return true
+		}
+		iter.executions = executions
+		iter.nexttoken = nextToken
+		if len(iter.executions) > 0 {
+			return true
+		}
+	}
+
+	iter.done = true
+	return false
+}
+
+func (iter *workflowExecutionIteratorImpl) Next() (*WorkflowExecutionEntry, error) {
+	if !iter.HasNext() {
+		panic("WorkflowExecutionIterator Next() called without checking HasNext()")
+	}
+
+	if iter.err != nil {
+		// error terminates the iteration
+		err := iter.err
+		iter.err = nil
+		iter.done = true
+		return nil, err
+	}
+
+	info := iter.executions[iter.nextIndex]
+	iter.nextIndex++
+	return newWorkflowExecutionEntry(info, iter.dataConverter), nil
+}
+
+func newWorkflowExecutionEntry(info *workflowpb.WorkflowExecutionInfo, dc converter.DataConverter) *WorkflowExecutionEntry {
+	return &WorkflowExecutionEntry{
+		Info:             info,
+		Memo:             decodePayloadMap(info.GetMemo().GetFields(), dc),
+		SearchAttributes: decodePayloadMap(info.GetSearchAttributes().GetIndexedFields(), dc),
+	}
+}
+
+func decodePayloadMap(fields map[string]*commonpb.Payload, dc converter.DataConverter) map[string]converter.EncodedValue {
+	result := make(map[string]converter.EncodedValue, len(fields))
+	for k, v := range fields {
+		result[k] = newEncodedValue(&commonpb.Payloads{Payloads: []*commonpb.Payload{v}}, dc)
+	}
+	return result
+}
+
 func (workflowRun *workflowRunImpl) GetRunID() string {
 	return workflowRun.currentRunID.Get()
 }
@@ -1111,8 +1320,7 @@ func getWorkflowMemo(input map[string]interface{}, dc converter.DataConverter) (
 
 	memo := make(map[string]*commonpb.Payload)
 	for k, v := range input {
-		// TODO (shtin): use dc here???
-		memoBytes, err := converter.GetDefaultDataConverter().ToPayload(v)
+		memoBytes, err := dc.ToPayload(v)
 		if err != nil {
 			return nil, fmt.Errorf("encode workflow memo error: %v", err.Error())
 		}
@@ -1121,6 +1329,14 @@ func getWorkflowMemo(input map[string]interface{}, dc converter.DataConverter) (
 	return &commonpb.Memo{Fields: memo}, nil
 }
 
+func serializeStartSearchAttributes(options StartWorkflowOptions) (*commonpb.SearchAttributes, error) {
+	input, err := mergeTypedSearchAttributes(options.SearchAttributes, options.TypedSearchAttributes)
+	if err != nil {
+		return nil, err
+	}
+	return serializeSearchAttributes(input)
+}
+
 func serializeSearchAttributes(input map[string]interface{}) (*commonpb.SearchAttributes, error) {
 	if input == nil {
 		return nil, nil
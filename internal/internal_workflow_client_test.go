@@ -309,6 +309,92 @@ func (s *historyEventIteratorSuite) TestIteratorError() {
 	s.NotNil(err)
 }
 
+func (s *historyEventIteratorSuite) TestWorkflowExecutionIterator_Paginates() {
+	memo, err := getWorkflowMemo(map[string]interface{}{"owner": "alice"}, converter.GetDefaultDataConverter())
+	s.NoError(err)
+	searchAttr, err := serializeSearchAttributes(map[string]interface{}{"CustomIntField": 7})
+	s.NoError(err)
+	s.wfClient.dataConverter = converter.GetDefaultDataConverter()
+
+	request := &workflowservice.ListWorkflowExecutionsRequest{Query: "WorkflowType = 'wf'"}
+	request1 := &workflowservice.ListWorkflowExecutionsRequest{Namespace: DefaultNamespace, Query: request.Query}
+	response1 := &workflowservice.ListWorkflowExecutionsResponse{
+		Executions: []*workflowpb.WorkflowExecutionInfo{
+			{Execution: &commonpb.WorkflowExecution{WorkflowId: "wid1"}, Memo: memo, SearchAttributes: searchAttr},
+		},
+		NextPageToken: []byte{1},
+	}
+	request2 := &workflowservice.ListWorkflowExecutionsRequest{Namespace: DefaultNamespace, Query: request.Query, NextPageToken: []byte{1}}
+	response2 := &workflowservice.ListWorkflowExecutionsResponse{NextPageToken: []byte{2}}
+	request3 := &workflowservice.ListWorkflowExecutionsRequest{Namespace: DefaultNamespace, Query: request.Query, NextPageToken: []byte{2}}
+	response3 := &workflowservice.ListWorkflowExecutionsResponse{
+		Executions: []*workflowpb.WorkflowExecutionInfo{
+			{Execution: &commonpb.WorkflowExecution{WorkflowId: "wid2"}},
+		},
+	}
+	s.workflowServiceClient.EXPECT().ListWorkflowExecutions(gomock.Any(), request1, gomock.Any()).Return(response1, nil).Times(1)
+	s.workflowServiceClient.EXPECT().ListWorkflowExecutions(gomock.Any(), request2, gomock.Any()).Return(response2, nil).Times(1)
+	s.workflowServiceClient.EXPECT().ListWorkflowExecutions(gomock.Any(), request3, gomock.Any()).Return(response3, nil).Times(1)
+
+	var entries []*WorkflowExecutionEntry
+	iter := s.wfClient.ListWorkflowIterator(context.Background(), request)
+	for iter.HasNext() {
+		entry, err := iter.Next()
+		s.NoError(err)
+		entries = append(entries, entry)
+	}
+	s.Equal(2, len(entries))
+	s.Equal("wid1", entries[0].Info.GetExecution().GetWorkflowId())
+	s.Equal("wid2", entries[1].Info.GetExecution().GetWorkflowId())
+	s.Nil(request.NextPageToken)
+
+	var owner string
+	s.NoError(entries[0].Memo["owner"].Get(&owner))
+	s.Equal("alice", owner)
+	var intField int
+	s.NoError(entries[0].SearchAttributes["CustomIntField"].Get(&intField))
+	s.Equal(7, intField)
+	s.Empty(entries[1].Memo)
+}
+
+func (s *historyEventIteratorSuite) TestWorkflowExecutionIterator_Error() {
+	request := &workflowservice.ScanWorkflowExecutionsRequest{Namespace: DefaultNamespace}
+	s.workflowServiceClient.EXPECT().ScanWorkflowExecutions(gomock.Any(), request, gomock.Any()).Return(nil, serviceerror.NewInvalidArgument("bad query")).Times(1)
+
+	iter := s.wfClient.ScanWorkflowIterator(context.Background(), request)
+	s.True(iter.HasNext())
+	entry, err := iter.Next()
+	s.Nil(entry)
+	s.Error(err)
+	s.False(iter.HasNext())
+}
+
+func (s *historyEventIteratorSuite) TestWorkflowExecutionIterator_ContextCanceled() {
+	request := &workflowservice.ListOpenWorkflowExecutionsRequest{Namespace: DefaultNamespace}
+	response := &workflowservice.ListOpenWorkflowExecutionsResponse{
+		Executions: []*workflowpb.WorkflowExecutionInfo{
+			{Execution: &commonpb.WorkflowExecution{WorkflowId: "wid1"}},
+			{Execution: &commonpb.WorkflowExecution{WorkflowId: "wid2"}},
+		},
+		NextPageToken: []byte{1},
+	}
+	s.workflowServiceClient.EXPECT().ListOpenWorkflowExecutions(gomock.Any(), request, gomock.Any()).Return(response, nil).Times(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	iter := s.wfClient.ListOpenWorkflowIterator(ctx, request)
+	s.True(iter.HasNext())
+	entry, err := iter.Next()
+	s.NoError(err)
+	s.Equal("wid1", entry.Info.GetExecution().GetWorkflowId())
+
+	cancel()
+	s.True(iter.HasNext())
+	entry, err = iter.Next()
+	s.Nil(entry)
+	s.Equal(context.Canceled, err)
+	s.False(iter.HasNext())
+}
+
 // workflowRunSuite
 
 type (
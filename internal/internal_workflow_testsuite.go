@@ -30,6 +30,7 @@ import (
 	"fmt"
 	"os"
 	"reflect"
+	"runtime/pprof"
 	"strings"
 	"sync"
 	"time"
@@ -43,6 +44,7 @@ import (
 	commandpb "go.temporal.io/api/command/v1"
 	commonpb "go.temporal.io/api/common/v1"
 	enumspb "go.temporal.io/api/enums/v1"
+	historypb "go.temporal.io/api/history/v1"
 	"go.temporal.io/api/serviceerror"
 	taskqueuepb "go.temporal.io/api/taskqueue/v1"
 	"go.temporal.io/api/workflowservice/v1"
@@ -81,6 +83,7 @@ type (
 		mockTimeToFire time.Time
 		wallTimeToFire time.Time
 		timerID        int64
+		workflowTimer  bool
 	}
 
 	testActivityHandle struct {
@@ -111,6 +114,9 @@ type (
 	workflowExecutorWrapper struct {
 		*workflowExecutor
 		env *testWorkflowEnvironmentImpl
+		// replayed is set for the workflow instance that replaces an evicted one. The test environment was already
+		// notified of the start of the workflow, so it is executed right away.
+		replayed bool
 	}
 
 	mockWrapper struct {
@@ -159,6 +165,17 @@ type (
 
 		expectedMockCalls map[string]struct{}
 
+		recordHistory bool
+		verifyReplay  bool
+
+		maxContinueAsNewRuns int
+
+		routeExternalWorkflows bool
+		workflowRuns           []*TestWorkflowRun
+
+		chaos    *pressurePointMgrImpl
+		chaosErr error
+
 		onActivityStartedListener        func(activityInfo *ActivityInfo, ctx context.Context, args converter.EncodedValues)
 		onActivityCompletedListener      func(activityInfo *ActivityInfo, result converter.EncodedValue, err error)
 		onActivityCanceledListener       func(activityInfo *ActivityInfo)
@@ -181,6 +198,8 @@ type (
 		registry  *registry
 
 		workflowInfo   *WorkflowInfo
+		firstRunID     string
+		runNumber      int
 		workflowDef    WorkflowDefinition
 		changeVersions map[string]Version
 		openSessions   map[string]*SessionInfo
@@ -200,8 +219,13 @@ type (
 
 		heartbeatDetails *commonpb.Payloads
 
+		randomSeed         int64
+		randomSeedRecorded bool
+
 		workerStopChannel  chan struct{}
 		sessionEnvironment *testSessionEnvironmentImpl
+
+		historyRecorder *testHistoryRecorder
 	}
 
 	testSessionEnvironmentImpl struct {
@@ -386,6 +410,85 @@ func (env *testWorkflowEnvironmentImpl) newTestWorkflowEnvironmentForChild(param
 	return childEnv, nil
 }
 
+// continuedRunID returns the run ID of the run that continues this run as new
+func (env *testWorkflowEnvironmentImpl) continuedRunID() string {
+	firstRunID := env.firstRunID
+	if firstRunID == "" {
+		firstRunID = env.workflowInfo.WorkflowExecution.RunID
+	}
+	return fmt.Sprintf("%v_continued_%v", firstRunID, env.runNumber+1)
+}
+
+// newTestWorkflowEnvironmentForContinueAsNew creates the test env of the next run when the workflow continued as new
+// and continue-as-new chaining allows another run. It returns nil if no next run should be started.
+func (env *testWorkflowEnvironmentImpl) newTestWorkflowEnvironmentForContinueAsNew() (*testWorkflowEnvironmentImpl, *ContinueAsNewError) {
+	var continueAsNewErr *ContinueAsNewError
+	if !errors.As(env.testError, &continueAsNewErr) || len(env.workflowRuns) >= env.maxContinueAsNewRuns {
+		return nil, nil
+	}
+
+	// same as server, pending timers and activities of the closed run are dropped.
+	runID := env.workflowInfo.WorkflowExecution.RunID
+	for id, timerHandle := range env.timers {
+		if timerHandle.env == env && timerHandle.workflowTimer {
+			timerHandle.timer.Stop()
+			delete(env.timers, id)
+		}
+	}
+	for id := range env.activities {
+		if strings.HasPrefix(id, runID+"_") {
+			delete(env.activities, id)
+		}
+	}
+	// result of a dropped local activity is ignored by handleLocalActivityResult
+	for id, task := range env.localActivities {
+		if task.params.WorkflowInfo.WorkflowExecution.RunID == runID {
+			task.cancel()
+			delete(env.localActivities, id)
+		}
+	}
+
+	nextEnv := newTestWorkflowEnvironmentImpl(env.testSuite, env.registry)
+	nextEnv.testWorkflowEnvironmentShared = env.testWorkflowEnvironmentShared
+	nextEnv.workerOptions = env.workerOptions
+	nextEnv.dataConverter = env.dataConverter
+	nextEnv.registry = env.registry
+	nextEnv.workerStopChannel = env.workerStopChannel
+	nextEnv.runTimeout = env.runTimeout
+	if continueAsNewErr.WorkflowRunTimeout > 0 {
+		nextEnv.runTimeout = continueAsNewErr.WorkflowRunTimeout
+	}
+	nextEnv.firstRunID = env.firstRunID
+	if nextEnv.firstRunID == "" {
+		nextEnv.firstRunID = runID
+	}
+	nextEnv.runNumber = env.runNumber + 1
+
+	// set workflow info data for the new run
+	nextEnv.header = continueAsNewErr.Header
+	nextEnv.workflowInfo.Namespace = env.workflowInfo.Namespace
+	nextEnv.workflowInfo.WorkflowExecution.ID = env.workflowInfo.WorkflowExecution.ID
+	nextEnv.workflowInfo.WorkflowExecution.RunID = env.continuedRunID()
+	nextEnv.workflowInfo.ContinuedExecutionRunID = runID
+	nextEnv.workflowInfo.TaskQueueName = env.workflowInfo.TaskQueueName
+	if continueAsNewErr.TaskQueueName != "" {
+		nextEnv.workflowInfo.TaskQueueName = continueAsNewErr.TaskQueueName
+	}
+	nextEnv.workflowInfo.WorkflowExecutionTimeout = env.workflowInfo.WorkflowExecutionTimeout
+	nextEnv.workflowInfo.WorkflowRunTimeout = nextEnv.runTimeout
+	nextEnv.workflowInfo.WorkflowTaskTimeout = env.workflowInfo.WorkflowTaskTimeout
+	if continueAsNewErr.WorkflowTaskTimeout > 0 {
+		nextEnv.workflowInfo.WorkflowTaskTimeout = continueAsNewErr.WorkflowTaskTimeout
+	}
+	nextEnv.workflowInfo.Memo = continueAsNewErr.Memo
+	nextEnv.workflowInfo.SearchAttributes = continueAsNewErr.SearchAttributes
+	nextEnv.workflowInfo.CronSchedule = env.workflowInfo.CronSchedule
+
+	env.runningWorkflows[nextEnv.workflowInfo.WorkflowExecution.ID] = &testWorkflowHandle{env: nextEnv, callback: func(result *commonpb.Payloads, err error) {}}
+
+	return nextEnv, continueAsNewErr
+}
+
 func (env *testWorkflowEnvironmentImpl) setWorkerOptions(options WorkerOptions) {
 	env.workerOptions = options
 	env.registry.SetWorkflowInterceptors(options.WorkflowInterceptorChainFactories)
@@ -447,6 +550,30 @@ func (env *testWorkflowEnvironmentImpl) executeWorkflow(workflowFn interface{},
 
 func (env *testWorkflowEnvironmentImpl) executeWorkflowInternal(delayStart time.Duration, workflowType string, input *commonpb.Payloads) {
 	env.locker.Lock()
+	env.setWorkflowType(workflowType)
+	env.locker.Unlock()
+
+	env.startWorkflowInternal(delayStart, input)
+	env.startMainLoop()
+
+	if !env.isChildWorkflow() {
+		env.finishRecordedHistories()
+		if env.verifyReplay {
+			env.replayRecordedHistories()
+		}
+		if env.chaosErr != nil {
+			env.testResult = nil
+			env.testError = env.chaosErr
+		}
+		env.workflowRuns = append(env.workflowRuns, &TestWorkflowRun{
+			runID:  env.workflowInfo.WorkflowExecution.RunID,
+			result: env.testResult,
+			err:    env.testError,
+		})
+	}
+}
+
+func (env *testWorkflowEnvironmentImpl) setWorkflowType(workflowType string) {
 	wInfo := env.workflowInfo
 	if wInfo.WorkflowType.Name != workflowTypeNotSpecified {
 		// Current TestWorkflowEnvironment only support to run one workflow.
@@ -464,18 +591,30 @@ func (env *testWorkflowEnvironmentImpl) executeWorkflowInternal(delayStart time.
 	if wInfo.WorkflowTaskTimeout == 0 {
 		wInfo.WorkflowTaskTimeout = 1 * time.Second
 	}
-	env.locker.Unlock()
+}
 
-	workflowDefinition, err := env.getWorkflowDefinition(wInfo.WorkflowType)
+// startWorkflowInternal schedules the workflow to start in the main loop.
+func (env *testWorkflowEnvironmentImpl) startWorkflowInternal(delayStart time.Duration, input *commonpb.Payloads) {
+	workflowDefinition, err := env.getWorkflowDefinition(env.workflowInfo.WorkflowType, false)
 	if err != nil {
 		panic(err)
 	}
+	if env.chaos != nil {
+		workflowDefinition = newEvictableWorkflowDefinition(env, workflowDefinition)
+	}
 	env.workflowDef = workflowDefinition
+	env.workflowInfo.dataConverter = env.GetDataConverter()
+	if env.isHistoryRecorded() {
+		env.historyRecorder = newTestHistoryRecorder(env)
+	}
 
 	// env.workflowDef.Execute() method will execute dispatcher. We want the dispatcher to only run in main loop.
 	// In case of child workflow, this executeWorkflowInternal() is run in separate goroutinue, so use postCallback
 	// to make sure workflowDef.Execute() is run in main loop.
 	env.postCallback(func() {
+		if env.historyRecorder != nil {
+			env.historyRecorder.workflowExecutionStarted(env.header, input)
+		}
 		env.workflowDef.Execute(env, env.header, input)
 		// kick off first workflow task to start the workflow
 		if delayStart == 0 {
@@ -498,10 +637,94 @@ func (env *testWorkflowEnvironmentImpl) executeWorkflowInternal(delayStart time.
 			}
 		}, timeoutDuration)
 	}
-	env.startMainLoop()
 }
 
-func (env *testWorkflowEnvironmentImpl) getWorkflowDefinition(wt WorkflowType) (WorkflowDefinition, error) {
+// startWorkflow starts a workflow that is not a child of the tested workflow. It runs in the main loop of the tested
+// workflow, and the main loop does not stop until it completes.
+func (env *testWorkflowEnvironmentImpl) startWorkflow(options StartWorkflowOptions, workflowFn interface{}, args ...interface{}) {
+	if options.ID == "" {
+		panic("workflow ID is required to start a workflow in TestWorkflowEnvironment")
+	}
+	if handle, ok := env.runningWorkflows[options.ID]; ok && (handle.env == env || !handle.handled) {
+		panic(fmt.Sprintf("workflow %v is already started in TestWorkflowEnvironment", options.ID))
+	}
+	fType := reflect.TypeOf(workflowFn)
+	if getKind(fType) == reflect.Func {
+		env.RegisterWorkflowWithOptions(workflowFn, RegisterWorkflowOptions{DisableAlreadyRegisteredCheck: true})
+	}
+	workflowType, input, err := getValidatedWorkflowFunction(workflowFn, args, env.GetDataConverter(), env.GetRegistry())
+	if err != nil {
+		panic(err)
+	}
+
+	workflowEnv := newTestWorkflowEnvironmentImpl(env.testSuite, env.registry)
+	workflowEnv.testWorkflowEnvironmentShared = env.testWorkflowEnvironmentShared
+	workflowEnv.workerOptions = env.workerOptions
+	workflowEnv.dataConverter = env.dataConverter
+	workflowEnv.registry = env.registry
+	workflowEnv.workerStopChannel = env.workerStopChannel
+	workflowEnv.workflowInfo.Namespace = env.workflowInfo.Namespace
+	workflowEnv.workflowInfo.TaskQueueName = env.workflowInfo.TaskQueueName
+	workflowEnv.workflowInfo.WorkflowExecution.ID = options.ID
+	workflowEnv.workflowInfo.WorkflowExecution.RunID = options.ID + "_RunID"
+	workflowEnv.setStartWorkflowOptions(options)
+	if options.WorkflowRunTimeout > 0 {
+		workflowEnv.runTimeout = options.WorkflowRunTimeout
+	}
+
+	env.runningWorkflows[options.ID] = &testWorkflowHandle{env: workflowEnv, callback: func(result *commonpb.Payloads, err error) {}}
+
+	// called before the main loop starts or from the main loop, so the locker is either not needed or already held.
+	workflowEnv.setWorkflowType(workflowType.Name)
+	workflowEnv.startWorkflowInternal(0, input)
+}
+
+// isHistoryRecorded returns true if the histories of the workflow and its child workflows are recorded.
+func (env *testWorkflowEnvironmentImpl) isHistoryRecorded() bool {
+	return env.recordHistory || env.verifyReplay || env.chaos != nil
+}
+
+// recordedEnvs returns the environments of the workflow and its child workflows.
+func (env *testWorkflowEnvironmentImpl) recordedEnvs() []*testWorkflowEnvironmentImpl {
+	envs := []*testWorkflowEnvironmentImpl{env}
+	for _, handle := range env.runningWorkflows {
+		if handle.env != env {
+			envs = append(envs, handle.env)
+		}
+	}
+	return envs
+}
+
+// finishRecordedHistories completes the histories of the workflow and its child workflows once the test execution
+// is over.
+func (env *testWorkflowEnvironmentImpl) finishRecordedHistories() {
+	for _, e := range env.recordedEnvs() {
+		if e.historyRecorder != nil {
+			e.historyRecorder.finish()
+		}
+	}
+}
+
+// replayRecordedHistories replays the histories recorded for the workflow and its child workflows. Replay failure
+// replaces the result of the workflow.
+func (env *testWorkflowEnvironmentImpl) replayRecordedHistories() {
+	for _, e := range env.recordedEnvs() {
+		if e.historyRecorder == nil {
+			continue
+		}
+		if err := e.historyRecorder.replay(); err != nil {
+			env.logger.Error("Replay of workflow history failed.",
+				tagWorkflowType, e.workflowInfo.WorkflowType.Name,
+				tagWorkflowID, e.workflowInfo.WorkflowExecution.ID,
+				tagError, err)
+			env.testResult = nil
+			env.testError = err
+			return
+		}
+	}
+}
+
+func (env *testWorkflowEnvironmentImpl) getWorkflowDefinition(wt WorkflowType, replayed bool) (WorkflowDefinition, error) {
 	wf, ok := env.registry.getWorkflowFn(wt.Name)
 	if !ok {
 		supported := strings.Join(env.registry.getRegisteredWorkflowTypes(), ", ")
@@ -510,6 +733,7 @@ func (env *testWorkflowEnvironmentImpl) getWorkflowDefinition(wt WorkflowType) (
 	wd := &workflowExecutorWrapper{
 		workflowExecutor: &workflowExecutor{workflowType: wt.Name, fn: wf, interceptors: env.registry.WorkflowInterceptors()},
 		env:              env,
+		replayed:         replayed,
 	}
 	return newSyncWorkflowDefinition(wd), nil
 }
@@ -635,6 +859,12 @@ func (env *testWorkflowEnvironmentImpl) executeLocalActivity(
 
 func (env *testWorkflowEnvironmentImpl) startWorkflowTask() {
 	if !env.isWorkflowCompleted {
+		if env.historyRecorder != nil {
+			if env.historyRecorder.startWorkflowTask() {
+				env.evictWorkflow()
+			}
+			defer env.historyRecorder.workflowTaskDispatched()
+		}
 		env.workflowDef.OnWorkflowTaskStarted(env.workerOptions.DeadlockDetectionTimeout)
 	}
 }
@@ -688,6 +918,13 @@ func (env *testWorkflowEnvironmentImpl) shouldStopEventLoop() bool {
 			// ignore root workflow
 			continue
 		}
+		if !handle.env.isChildWorkflow() {
+			// workflow started by startWorkflow()
+			if !handle.handled {
+				return false
+			}
+			continue
+		}
 
 		if !handle.handled && (handle.params.ParentClosePolicy == enumspb.PARENT_CLOSE_POLICY_ABANDON ||
 			handle.params.ParentClosePolicy == enumspb.PARENT_CLOSE_POLICY_REQUEST_CANCEL) {
@@ -796,6 +1033,22 @@ func (env *testWorkflowEnvironmentImpl) postCallback(cb func(), startWorkflowTas
 	env.callbackChannel <- testCallbackHandle{callback: cb, startWorkflowTask: startWorkflowTask, env: env}
 }
 
+// goOutsideWorkflow runs f in a separate goroutine on behalf of workflow code. In coroutine debug mode the goroutine
+// drops the labels inherited from the calling coroutine, so the dispatcher doesn't report it as a native goroutine.
+func (env *testWorkflowEnvironmentImpl) goOutsideWorkflow(f func()) {
+	if !env.workerOptions.EnableCoroutineDebugMode {
+		go f()
+		return
+	}
+	unlabeled := make(chan struct{})
+	go func() {
+		pprof.SetGoroutineLabels(context.Background())
+		close(unlabeled)
+		f()
+	}()
+	<-unlabeled
+}
+
 func (env *testWorkflowEnvironmentImpl) RequestCancelActivity(activityID ActivityID) {
 	handle, ok := env.getActivityHandle(activityID)
 	if !ok {
@@ -805,6 +1058,9 @@ func (env *testWorkflowEnvironmentImpl) RequestCancelActivity(activityID Activit
 	activityInfo := env.getActivityInfo(activityID, handle.activityType)
 	env.logger.Debug("RequestCancelActivity", tagActivityID, activityID)
 	env.deleteHandle(activityID)
+	if env.historyRecorder != nil {
+		env.historyRecorder.activityTaskCancelRequested(activityID.id)
+	}
 	env.postCallback(func() {
 		handle.callback(nil, NewCanceledError())
 		if env.onActivityCanceledListener != nil {
@@ -824,6 +1080,9 @@ func (env *testWorkflowEnvironmentImpl) RequestCancelTimer(timerID TimerID) {
 
 	delete(env.timers, timerID.id)
 	timerHandle.timer.Stop()
+	if env.historyRecorder != nil {
+		env.historyRecorder.timerCanceled(timerID.id)
+	}
 	timerHandle.env.postCallback(func() {
 		timerHandle.callback(nil, NewCanceledError())
 		if timerHandle.env.onTimerCanceledListener != nil {
@@ -844,12 +1103,24 @@ func (env *testWorkflowEnvironmentImpl) Complete(result *commonpb.Payloads, err
 
 	dc := env.GetDataConverter()
 	env.isWorkflowCompleted = true
+	if env.historyRecorder != nil {
+		env.historyRecorder.workflowExecutionClosed(result, err)
+	}
 
 	if err != nil {
 		var continueAsNewErr *ContinueAsNewError
 		var timeoutErr *TimeoutError
 		var workflowPanicErr *workflowPanicError
 		var workflowExecutionAlreadyStartedErr *serviceerror.WorkflowExecutionAlreadyStarted
+		if errors.As(err, &continueAsNewErr) {
+			// same as worker, new run inherits memo and search attributes of the current run unless overridden
+			if continueAsNewErr.Memo == nil {
+				continueAsNewErr.Memo = env.workflowInfo.Memo
+			}
+			if continueAsNewErr.SearchAttributes == nil {
+				continueAsNewErr.SearchAttributes = env.workflowInfo.SearchAttributes
+			}
+		}
 		if errors.As(err, &canceledErr) || errors.As(err, &continueAsNewErr) || errors.As(err, &timeoutErr) || errors.As(err, &workflowExecutionAlreadyStartedErr) {
 			env.testError = err
 		} else if errors.As(err, &workflowPanicErr) {
@@ -871,6 +1142,10 @@ func (env *testWorkflowEnvironmentImpl) Complete(result *commonpb.Payloads, err
 		env.testResult = newEncodedValue(result, dc)
 	}
 
+	if handle, ok := env.runningWorkflows[env.workflowInfo.WorkflowExecution.ID]; ok && !env.isChildWorkflow() && handle.env == env {
+		handle.handled = true
+	}
+
 	if env.isChildWorkflow() {
 		// this is completion of child workflow
 		childWorkflowID := env.workflowInfo.WorkflowExecution.ID
@@ -886,6 +1161,9 @@ func (env *testWorkflowEnvironmentImpl) Complete(result *commonpb.Payloads, err
 
 			// no rerun, child workflow is done.
 			env.parentEnv.postCallback(func() {
+				if env.parentEnv.historyRecorder != nil {
+					env.parentEnv.historyRecorder.childWorkflowClosed(childWorkflowID, result, env.testError)
+				}
 				// deliver result
 				if env.testError != nil {
 					childWorkflowHandle.err = NewChildWorkflowExecutionError(
@@ -1065,10 +1343,25 @@ func (env *testWorkflowEnvironmentImpl) ExecuteActivity(parameters ExecuteActivi
 	activityHandle := &testActivityHandle{callback: callback, activityType: parameters.ActivityType.Name}
 
 	env.setActivityHandle(activityID, activityHandle)
+	if env.historyRecorder != nil {
+		env.historyRecorder.activityTaskScheduled(&historypb.ActivityTaskScheduledEventAttributes{
+			ActivityId:             scheduleTaskAttr.ActivityId,
+			ActivityType:           scheduleTaskAttr.ActivityType,
+			Namespace:              env.workflowInfo.Namespace,
+			TaskQueue:              scheduleTaskAttr.TaskQueue,
+			Header:                 scheduleTaskAttr.Header,
+			Input:                  scheduleTaskAttr.Input,
+			ScheduleToCloseTimeout: scheduleTaskAttr.ScheduleToCloseTimeout,
+			ScheduleToStartTimeout: scheduleTaskAttr.ScheduleToStartTimeout,
+			StartToCloseTimeout:    scheduleTaskAttr.StartToCloseTimeout,
+			HeartbeatTimeout:       scheduleTaskAttr.HeartbeatTimeout,
+			RetryPolicy:            scheduleTaskAttr.RetryPolicy,
+		}, parameters.ActivityID == "", parameters.WaitForCancellation)
+	}
 	env.runningCount++
 	// activity runs in separate goroutinue outside of workflow dispatcher
 	// do callback in a defer to handle calls to runtime.Goexit inside the activity (which is done by t.FailNow)
-	go func() {
+	env.goOutsideWorkflow(func() {
 		var result interface{}
 		defer func() {
 			panicErr := recover()
@@ -1085,12 +1378,14 @@ func (env *testWorkflowEnvironmentImpl) ExecuteActivity(parameters ExecuteActivi
 			}
 			// post activity result to workflow dispatcher
 			env.postCallback(func() {
-				env.handleActivityResult(activityID, result, parameters.ActivityType.Name, parameters.DataConverter)
+				env.deliverActivityResult(activityID, func() {
+					env.handleActivityResult(activityID, result, parameters.ActivityType.Name, parameters.DataConverter)
+				})
 				env.runningCount--
 			}, false /* do not auto schedule workflow task, because activity might be still pending */)
 		}()
 		result = env.executeActivityWithRetryForTest(taskHandler, parameters, task)
-	}()
+	})
 
 	return activityID
 }
@@ -1274,13 +1569,17 @@ func (env *testWorkflowEnvironmentImpl) executeActivityWithRetryForTest(
 	}
 
 	for {
-		var err error
-		result, err = taskHandler.Execute(parameters.TaskQueueName, task)
-		if err != nil {
-			if err == context.DeadlineExceeded {
-				return err
+		if injected := env.injectActivityFailure(parameters, task, expireTime); injected != nil {
+			result = injected
+		} else {
+			var err error
+			result, err = taskHandler.Execute(parameters.TaskQueueName, task)
+			if err != nil {
+				if err == context.DeadlineExceeded {
+					return err
+				}
+				panic(err)
 			}
-			panic(err)
 		}
 
 		// check if a retry is needed
@@ -1385,14 +1684,17 @@ func (env *testWorkflowEnvironmentImpl) ExecuteLocalActivity(params ExecuteLocal
 
 	env.localActivities[activityID] = task
 	env.runningCount++
+	if env.historyRecorder != nil {
+		env.historyRecorder.localActivityScheduled(activityID)
+	}
 
-	go func() {
+	env.goOutsideWorkflow(func() {
 		result := taskHandler.executeLocalActivityTask(task)
 		env.postCallback(func() {
 			env.handleLocalActivityResult(result)
 			env.runningCount--
 		}, false)
-	}()
+	})
 
 	return LocalActivityID{id: activityID}
 }
@@ -1430,6 +1732,9 @@ func (env *testWorkflowEnvironmentImpl) handleActivityResult(activityID Activity
 	}
 
 	delete(env.activities, activityID.id)
+	if env.historyRecorder != nil {
+		env.historyRecorder.activityTaskClosed(activityID.id, result)
+	}
 
 	var blob *commonpb.Payloads
 	var err error
@@ -1532,6 +1837,9 @@ func (env *testWorkflowEnvironmentImpl) handleLocalActivityResult(result *localA
 		lar.Backoff = getRetryBackoff(result, env.Now(), env.dataConverter)
 		lar.Attempt = task.attempt
 	}
+	if env.historyRecorder != nil {
+		env.historyRecorder.localActivityCompleted(result, lar)
+	}
 	task.callback(lar)
 	var canceledErr *CanceledError
 	if errors.As(lar.Err, &canceledErr) {
@@ -1615,6 +1923,10 @@ func (a *activityExecutorWrapper) ExecuteWithActualArgs(ctx context.Context, inp
 
 // Execute executes the workflow code.
 func (w *workflowExecutorWrapper) Execute(ctx Context, input *commonpb.Payloads) (result *commonpb.Payloads, err error) {
+	if w.replayed {
+		return w.workflowExecutor.Execute(ctx, input)
+	}
+
 	env := w.env
 	if env.isChildWorkflow() && env.onChildWorkflowStartedListener != nil {
 		env.onChildWorkflowStartedListener(GetWorkflowInfo(ctx), ctx, newEncodedValues(input, w.env.GetDataConverter()))
@@ -1635,15 +1947,18 @@ func (w *workflowExecutorWrapper) Execute(ctx Context, input *commonpb.Payloads)
 	mockReadyChannel := NewChannel(ctx)
 	// make a copy of the context for getMockReturn() call to avoid race condition
 	ctxCopy := newWorkflowContext(w.env, nil, nil)
-	go func() {
+	env.goOutsideWorkflow(func() {
 		// getMockReturn could block if mock is configured to wait. The returned mockRet is what has been configured
 		// for the mock by using MockCallWrapper.Return(). The mockRet could be mock values or mock function. We process
 		// the returned mockRet by calling executeMock() later in the main thread after it is send over via mockReadyChannel.
 		mockRet := m.getMockReturn(ctxCopy, input)
 		env.postCallback(func() {
+			if env.historyRecorder != nil {
+				env.historyRecorder.startExecution()
+			}
 			mockReadyChannel.SendAsync(mockRet)
 		}, true /* true to trigger the dispatcher for this workflow so it resume from mockReadyChannel block*/)
-	}()
+	})
 
 	var mockRet mock.Arguments
 	// This will block workflow dispatcher (on temporal channel), which the dispatcher understand and will return from
@@ -1658,6 +1973,10 @@ func (w *workflowExecutorWrapper) Execute(ctx Context, input *commonpb.Payloads)
 	var startedErr error
 	if mockRet != nil {
 		// workflow was mocked.
+		if env.historyRecorder != nil {
+			// history of a mocked workflow does not match its workflow definition.
+			env.historyRecorder.skipReplay = true
+		}
 		result, err = m.executeMock(ctx, input, mockRet)
 		if env.isChildWorkflow() && err == ErrMockStartChildWorkflowFailed {
 			childWE, startedErr = WorkflowExecution{}, err
@@ -1667,6 +1986,9 @@ func (w *workflowExecutorWrapper) Execute(ctx Context, input *commonpb.Payloads)
 	if env.isChildWorkflow() && env.startedHandler != nil /* startedHandler could be nil for retry */ {
 		// notify parent that child workflow is started
 		env.parentEnv.postCallback(func() {
+			if env.parentEnv.historyRecorder != nil {
+				env.parentEnv.historyRecorder.childWorkflowStarted(env.workflowInfo.WorkflowExecution.ID, childWE.RunID, startedErr)
+			}
 			env.startedHandler(childWE, startedErr)
 		}, true)
 	}
@@ -1927,6 +2249,9 @@ func (env *testWorkflowEnvironmentImpl) newTimer(d time.Duration, callback Resul
 	timer := env.mockClock.AfterFunc(d, func() {
 		delete(env.timers, timerInfo.id)
 		env.postCallback(func() {
+			if notifyListener && env.historyRecorder != nil {
+				env.historyRecorder.timerFired(timerInfo.id)
+			}
 			callback(nil, nil)
 			if notifyListener && env.onTimerFiredListener != nil {
 				env.onTimerFiredListener(timerInfo.id)
@@ -1941,6 +2266,10 @@ func (env *testWorkflowEnvironmentImpl) newTimer(d time.Duration, callback Resul
 		wallTimeToFire: env.wallClock.Now().Add(d),
 		duration:       d,
 		timerID:        nextID,
+		workflowTimer:  notifyListener,
+	}
+	if notifyListener && env.historyRecorder != nil {
+		env.historyRecorder.timerStarted(timerInfo.id, d)
 	}
 	if notifyListener && env.onTimerScheduledListener != nil {
 		env.onTimerScheduledListener(timerInfo.id, d)
@@ -1992,6 +2321,9 @@ func (env *testWorkflowEnvironmentImpl) RegisterQueryHandler(handler func(string
 func (env *testWorkflowEnvironmentImpl) RequestCancelChildWorkflow(_, workflowID string) {
 	if childHandle, ok := env.runningWorkflows[workflowID]; ok && !childHandle.handled {
 		// current workflow is a parent workflow, and we are canceling a child workflow
+		if env.historyRecorder != nil {
+			env.historyRecorder.childWorkflowCancelRequested(workflowID)
+		}
 		childEnv := childHandle.env
 		childEnv.cancelWorkflow(func(result *commonpb.Payloads, err error) {})
 		return
@@ -2009,13 +2341,18 @@ func (env *testWorkflowEnvironmentImpl) RequestCancelExternalWorkflow(namespace,
 			}, false)
 		}
 		return
+	} else if env.routeExternalWorkflows {
+		env.routeRequestCancelExternalWorkflow(namespace, workflowID, runID, callback)
+		return
 	} else if childHandle, ok := env.runningWorkflows[workflowID]; ok && !childHandle.handled {
 		// current workflow is a parent workflow, and we are canceling a child workflow
+		recordResult := env.recordRequestCancelExternalWorkflow(namespace, workflowID, runID)
 		if !childHandle.params.WaitForCancellation {
 			childHandle.env.Complete(nil, ErrCanceled)
 		}
 		childEnv := childHandle.env
 		env.postCallback(func() {
+			recordResult(nil)
 			callback(nil, nil)
 		}, true)
 		childEnv.cancelWorkflow(callback)
@@ -2025,8 +2362,9 @@ func (env *testWorkflowEnvironmentImpl) RequestCancelExternalWorkflow(namespace,
 	// target workflow is not child workflow, we need the mock. The mock needs to be called in a separate goroutinue
 	// so it can block and wait on the requested delay time (if configured). If we run it in main thread, and the mock
 	// configured to delay, it will block the main loop which stops the world.
+	recordResult := env.recordRequestCancelExternalWorkflow(namespace, workflowID, runID)
 	env.runningCount++
-	go func() {
+	env.goOutsideWorkflow(func() {
 		args := []interface{}{namespace, workflowID, runID}
 		// below call will panic if mock is not properly setup.
 		mockRet := env.mock.MethodCalled(mockMethodForRequestCancelExternalWorkflow, args...)
@@ -2039,10 +2377,82 @@ func (env *testWorkflowEnvironmentImpl) RequestCancelExternalWorkflow(namespace,
 			_, err = m.getMockValue(mockRet)
 		}
 		env.postCallback(func() {
+			recordResult(err)
 			callback(nil, err)
 			env.runningCount--
 		}, true)
-	}()
+	})
+}
+
+// getExternalWorkflow returns the test env of the running workflow execution targeted by an external workflow request.
+func (env *testWorkflowEnvironmentImpl) getExternalWorkflow(workflowID, runID string) (*testWorkflowEnvironmentImpl, bool) {
+	handle, ok := env.runningWorkflows[workflowID]
+	if !ok || handle.env.isWorkflowCompleted {
+		return nil, false
+	}
+	if runID != "" && runID != handle.env.workflowInfo.WorkflowExecution.RunID {
+		return nil, false
+	}
+	return handle.env, true
+}
+
+// routeSignalExternalWorkflow delivers the signal to the workflow running in the test env, without the mock.
+func (env *testWorkflowEnvironmentImpl) routeSignalExternalWorkflow(workflowID, runID, signalName string, input *commonpb.Payloads,
+	recordResult func(err error), callback ResultHandler) {
+	targetEnv, ok := env.getExternalWorkflow(workflowID, runID)
+	var err error
+	if ok {
+		targetEnv.deliverSignal(signalName, input)
+		targetEnv.postCallback(func() {}, true) // resume target workflow since a signal is sent.
+	} else {
+		err = newUnknownExternalWorkflowExecutionError()
+	}
+	env.deliverCommandResult(func() {
+		recordResult(err)
+		callback(nil, err)
+	})
+}
+
+// routeRequestCancelExternalWorkflow requests cancellation of the workflow running in the test env, without the mock.
+func (env *testWorkflowEnvironmentImpl) routeRequestCancelExternalWorkflow(namespace, workflowID, runID string, callback ResultHandler) {
+	recordResult := env.recordRequestCancelExternalWorkflow(namespace, workflowID, runID)
+	targetEnv, ok := env.getExternalWorkflow(workflowID, runID)
+	var err error
+	if ok {
+		targetEnv.cancelWorkflow(func(result *commonpb.Payloads, err error) {})
+	} else {
+		err = newUnknownExternalWorkflowExecutionError()
+	}
+	env.deliverCommandResult(func() {
+		recordResult(err)
+		callback(nil, err)
+	})
+}
+
+func (env *testWorkflowEnvironmentImpl) recordRequestCancelExternalWorkflow(namespace, workflowID, runID string) func(err error) {
+	if env.historyRecorder == nil {
+		return func(error) {}
+	}
+	return env.historyRecorder.requestCancelExternalWorkflowInitiated(namespace, workflowID, runID)
+}
+
+func (env *testWorkflowEnvironmentImpl) recordSignalExternalWorkflow(namespace, workflowID, runID, signalName string,
+	input *commonpb.Payloads, childWorkflowOnly bool) func(err error) {
+	if env.historyRecorder == nil {
+		return func(error) {}
+	}
+	return env.historyRecorder.signalExternalWorkflowInitiated(namespace, workflowID, runID, signalName, input, childWorkflowOnly)
+}
+
+// deliverCommandResult calls f that delivers a result of a command that the test environment completes without
+// waiting. When the history is recorded, the result is delivered in the next workflow task, same as server, so that
+// the recorded history can be replayed. Otherwise it is delivered immediately.
+func (env *testWorkflowEnvironmentImpl) deliverCommandResult(f func()) {
+	if env.historyRecorder == nil {
+		f()
+		return
+	}
+	env.postCallback(f, true)
 }
 
 func (env *testWorkflowEnvironmentImpl) IsReplaying() bool {
@@ -2051,18 +2461,27 @@ func (env *testWorkflowEnvironmentImpl) IsReplaying() bool {
 }
 
 func (env *testWorkflowEnvironmentImpl) SignalExternalWorkflow(namespace, workflowID, runID, signalName string, input *commonpb.Payloads, arg interface{}, childWorkflowOnly bool, callback ResultHandler) {
+	recordResult := env.recordSignalExternalWorkflow(namespace, workflowID, runID, signalName, input, childWorkflowOnly)
+	if env.routeExternalWorkflows {
+		env.routeSignalExternalWorkflow(workflowID, runID, signalName, input, recordResult, callback)
+		return
+	}
+
 	// check if target workflow is a known workflow
 	if childHandle, ok := env.runningWorkflows[workflowID]; ok {
 		// target workflow is a child
 		childEnv := childHandle.env
+		var err error
 		if childEnv.isWorkflowCompleted {
 			// child already completed (NOTE: we have only one failed cause now)
-			err := newUnknownExternalWorkflowExecutionError()
-			callback(nil, err)
+			err = newUnknownExternalWorkflowExecutionError()
 		} else {
-			childEnv.signalHandler(signalName, input)
-			callback(nil, nil)
+			childEnv.deliverSignal(signalName, input)
 		}
+		env.deliverCommandResult(func() {
+			recordResult(err)
+			callback(nil, err)
+		})
 		childEnv.postCallback(func() {}, true) // resume child workflow since a signal is sent.
 		return
 	}
@@ -2070,7 +2489,10 @@ func (env *testWorkflowEnvironmentImpl) SignalExternalWorkflow(namespace, workfl
 	// here we signal a child workflow but we cannot find it
 	if childWorkflowOnly {
 		err := newUnknownExternalWorkflowExecutionError()
-		callback(nil, err)
+		env.deliverCommandResult(func() {
+			recordResult(err)
+			callback(nil, err)
+		})
 		return
 	}
 
@@ -2078,7 +2500,7 @@ func (env *testWorkflowEnvironmentImpl) SignalExternalWorkflow(namespace, workfl
 	// so it can block and wait on the requested delay time (if configured). If we run it in main thread, and the mock
 	// configured to delay, it will block the main loop which stops the world.
 	env.runningCount++
-	go func() {
+	env.goOutsideWorkflow(func() {
 		args := []interface{}{namespace, workflowID, runID, signalName, arg}
 		// below call will panic if mock is not properly setup.
 		mockRet := env.mock.MethodCalled(mockMethodForSignalExternalWorkflow, args...)
@@ -2091,10 +2513,11 @@ func (env *testWorkflowEnvironmentImpl) SignalExternalWorkflow(namespace, workfl
 			_, err = m.getMockValue(mockRet)
 		}
 		env.postCallback(func() {
+			recordResult(err)
 			callback(nil, err)
 			env.runningCount--
 		}, true)
-	}()
+	})
 }
 
 func (env *testWorkflowEnvironmentImpl) ExecuteChildWorkflow(params ExecuteWorkflowParams, callback ResultHandler, startedHandler func(r WorkflowExecution, e error)) {
@@ -2102,11 +2525,17 @@ func (env *testWorkflowEnvironmentImpl) ExecuteChildWorkflow(params ExecuteWorkf
 }
 
 func (env *testWorkflowEnvironmentImpl) executeChildWorkflowWithDelay(delayStart time.Duration, params ExecuteWorkflowParams, callback ResultHandler, startedHandler func(r WorkflowExecution, e error)) {
+	generatedID := params.WorkflowID == ""
 	childEnv, err := env.newTestWorkflowEnvironmentForChild(&params, callback, startedHandler)
+	if env.historyRecorder != nil && startedHandler != nil /* startedHandler is nil for retry */ {
+		env.historyRecorder.childWorkflowInitiated(&params, params.WorkflowID, generatedID, err)
+	}
 	if err != nil {
 		env.logger.Info("ExecuteChildWorkflow failed", tagError, err)
-		callback(nil, err)
-		startedHandler(WorkflowExecution{}, err)
+		env.deliverCommandResult(func() {
+			callback(nil, err)
+			startedHandler(WorkflowExecution{}, err)
+		})
 		return
 	}
 
@@ -2114,24 +2543,28 @@ func (env *testWorkflowEnvironmentImpl) executeChildWorkflowWithDelay(delayStart
 	env.runningCount++
 
 	// run child workflow in separate goroutinue
-	go childEnv.executeWorkflowInternal(delayStart, params.WorkflowType.Name, params.Input)
+	env.goOutsideWorkflow(func() {
+		childEnv.executeWorkflowInternal(delayStart, params.WorkflowType.Name, params.Input)
+	})
 }
 
 func (env *testWorkflowEnvironmentImpl) SideEffect(f func() (*commonpb.Payloads, error), callback ResultHandler) {
-	callback(f())
+	result, err := f()
+	if err == nil && env.historyRecorder != nil {
+		env.historyRecorder.sideEffect(result)
+	}
+	callback(result, err)
 }
 
 func (env *testWorkflowEnvironmentImpl) GetVersion(changeID string, minSupported, maxSupported Version) (retVersion Version) {
 	if mockVersion, ok := env.getMockedVersion(changeID, changeID, minSupported, maxSupported); ok {
 		// GetVersion for changeID is mocked
-		_ = env.UpsertSearchAttributes(createSearchAttributesForChangeVersion(changeID, mockVersion, env.changeVersions))
-		env.changeVersions[changeID] = mockVersion
+		env.setChangeVersion(changeID, mockVersion)
 		return mockVersion
 	}
 	if mockVersion, ok := env.getMockedVersion(mock.Anything, changeID, minSupported, maxSupported); ok {
 		// GetVersion is mocked with any changeID.
-		_ = env.UpsertSearchAttributes(createSearchAttributesForChangeVersion(changeID, mockVersion, env.changeVersions))
-		env.changeVersions[changeID] = mockVersion
+		env.setChangeVersion(changeID, mockVersion)
 		return mockVersion
 	}
 
@@ -2140,11 +2573,23 @@ func (env *testWorkflowEnvironmentImpl) GetVersion(changeID string, minSupported
 		validateVersion(changeID, version, minSupported, maxSupported)
 		return version
 	}
-	_ = env.UpsertSearchAttributes(createSearchAttributesForChangeVersion(changeID, maxSupported, env.changeVersions))
-	env.changeVersions[changeID] = maxSupported
+	env.setChangeVersion(changeID, maxSupported)
 	return maxSupported
 }
 
+func (env *testWorkflowEnvironmentImpl) setChangeVersion(changeID string, version Version) {
+	_, recorded := env.changeVersions[changeID]
+	attr, err := env.upsertSearchAttributes(createSearchAttributesForChangeVersion(changeID, version, env.changeVersions))
+	if !recorded && env.historyRecorder != nil {
+		// same as worker, marker and search attributes are only recorded by the first call for the changeID.
+		env.historyRecorder.version(changeID, version)
+		if err == nil {
+			env.historyRecorder.upsertSearchAttributes(attr)
+		}
+	}
+	env.changeVersions[changeID] = version
+}
+
 func (env *testWorkflowEnvironmentImpl) getMockedVersion(mockedChangeID, changeID string, minSupported, maxSupported Version) (Version, bool) {
 	mockMethod := getMockMethodForGetVersion(mockedChangeID)
 	if _, ok := env.expectedMockCalls[mockMethod]; !ok {
@@ -2178,6 +2623,14 @@ func getMockMethodForGetVersion(changeID string) string {
 }
 
 func (env *testWorkflowEnvironmentImpl) UpsertSearchAttributes(attributes map[string]interface{}) error {
+	attr, err := env.upsertSearchAttributes(attributes)
+	if err == nil && env.historyRecorder != nil {
+		env.historyRecorder.upsertSearchAttributes(attr)
+	}
+	return err
+}
+
+func (env *testWorkflowEnvironmentImpl) upsertSearchAttributes(attributes map[string]interface{}) (*commonpb.SearchAttributes, error) {
 	attr, err := validateAndSerializeSearchAttributes(attributes)
 
 	env.workflowInfo.SearchAttributes = mergeSearchAttributes(env.workflowInfo.SearchAttributes, attr)
@@ -2185,17 +2638,49 @@ func (env *testWorkflowEnvironmentImpl) UpsertSearchAttributes(attributes map[st
 	mockMethod := mockMethodForUpsertSearchAttributes
 	if _, ok := env.expectedMockCalls[mockMethod]; !ok {
 		// mock not found
-		return err
+		return attr, err
 	}
 
 	args := []interface{}{attributes}
 	env.mock.MethodCalled(mockMethod, args...)
 
+	return attr, err
+}
+
+func (env *testWorkflowEnvironmentImpl) GetRandomSeed() int64 {
+	if !env.randomSeedRecorded {
+		env.randomSeed = newRecordedRandomSeed(env.SideEffect, env.GetDataConverter())
+		env.randomSeedRecorded = true
+	}
+	return env.randomSeed
+}
+
+func (env *testWorkflowEnvironmentImpl) UpsertMemo(memo map[string]interface{}) error {
+	memoProto, err := validateAndSerializeMemo(memo, env.GetDataConverter())
+
+	env.workflowInfo.Memo = mergeMemo(env.workflowInfo.Memo, memoProto)
+	if err == nil && env.historyRecorder != nil {
+		env.historyRecorder.upsertMemo(memoProto)
+	}
+
+	mockMethod := mockMethodForUpsertMemo
+	if _, ok := env.expectedMockCalls[mockMethod]; !ok {
+		// mock not found
+		return err
+	}
+
+	args := []interface{}{memo}
+	env.mock.MethodCalled(mockMethod, args...)
+
 	return err
 }
 
-func (env *testWorkflowEnvironmentImpl) MutableSideEffect(_ string, f func() interface{}, _ func(a, b interface{}) bool) converter.EncodedValue {
-	return newEncodedValue(env.encodeValue(f()), env.GetDataConverter())
+func (env *testWorkflowEnvironmentImpl) MutableSideEffect(id string, f func() interface{}, equals func(a, b interface{}) bool) converter.EncodedValue {
+	value := f()
+	if env.historyRecorder != nil {
+		env.historyRecorder.mutableSideEffect(id, value, equals)
+	}
+	return newEncodedValue(env.encodeValue(value), env.GetDataConverter())
 }
 
 func (env *testWorkflowEnvironmentImpl) AddSession(sessionInfo *SessionInfo) {
@@ -2232,6 +2717,9 @@ func (env *testWorkflowEnvironmentImpl) getActivityInfo(activityID ActivityID, a
 
 func (env *testWorkflowEnvironmentImpl) cancelWorkflow(callback ResultHandler) {
 	env.postCallback(func() {
+		if env.historyRecorder != nil {
+			env.historyRecorder.workflowExecutionCancelRequested()
+		}
 		// RequestCancelWorkflow needs to be run in main thread
 		env.RequestCancelExternalWorkflow(
 			env.workflowInfo.Namespace,
@@ -2248,7 +2736,7 @@ func (env *testWorkflowEnvironmentImpl) signalWorkflow(name string, input interf
 		panic(err)
 	}
 	env.postCallback(func() {
-		env.signalHandler(name, data)
+		env.deliverSignal(name, data)
 	}, startWorkflowTask)
 }
 
@@ -2263,7 +2751,7 @@ func (env *testWorkflowEnvironmentImpl) signalWorkflowByID(workflowID, signalNam
 			return serviceerror.NewNotFound(fmt.Sprintf("Workflow %v already completed", workflowID))
 		}
 		workflowHandle.env.postCallback(func() {
-			workflowHandle.env.signalHandler(signalName, data)
+			workflowHandle.env.deliverSignal(signalName, data)
 		}, true)
 		return nil
 	}
@@ -2320,6 +2808,25 @@ func (env *testWorkflowEnvironmentImpl) setLastError(err error) {
 	env.workflowInfo.lastFailure = ConvertErrorToFailure(err, env.dataConverter)
 }
 
+func (env *testWorkflowEnvironmentImpl) continueAsNewSuggestedThresholds() (length, size int) {
+	length = env.workerOptions.ContinueAsNewSuggestedHistoryLength
+	if length == 0 {
+		length = defaultContinueAsNewSuggestedHistoryLength
+	}
+	size = env.workerOptions.ContinueAsNewSuggestedHistorySize
+	if size == 0 {
+		size = defaultContinueAsNewSuggestedHistorySize
+	}
+	return length, size
+}
+
+func (env *testWorkflowEnvironmentImpl) setCurrentHistoryStats(length, size int) {
+	lengthThreshold, sizeThreshold := env.continueAsNewSuggestedThresholds()
+	env.workflowInfo.currentHistoryLength = length
+	env.workflowInfo.currentHistorySize = size
+	env.workflowInfo.continueAsNewSuggested = length >= lengthThreshold || size >= sizeThreshold
+}
+
 func (env *testWorkflowEnvironmentImpl) setHeartbeatDetails(details interface{}) {
 	data, err := encodeArg(env.GetDataConverter(), details)
 	if err != nil {
@@ -2332,6 +2839,10 @@ func (env *testWorkflowEnvironmentImpl) GetRegistry() *registry {
 	return env.registry
 }
 
+func (env *testWorkflowEnvironmentImpl) IsCoroutineDebugModeEnabled() bool {
+	return env.workerOptions.EnableCoroutineDebugMode
+}
+
 func (env *testWorkflowEnvironmentImpl) setStartWorkflowOptions(options StartWorkflowOptions) {
 	wf := env.workflowInfo
 	if options.WorkflowExecutionTimeout > 0 {
@@ -0,0 +1,178 @@
+// The MIT License
+//
+// Copyright (c) 2020 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	commonpb "go.temporal.io/api/common/v1"
+	"go.temporal.io/api/workflowservice/v1"
+)
+
+const (
+	defaultChaosMaxActivityDelay = time.Minute
+	chaosErrorType               = "ChaosError"
+)
+
+// newChaosPressurePoints returns the pressure points that inject the faults configured by options.
+func newChaosPressurePoints(options TestChaosOptions, env *testWorkflowEnvironmentImpl) *pressurePointMgrImpl {
+	maxActivityDelay := options.MaxActivityDelay
+	if maxActivityDelay <= 0 {
+		maxActivityDelay = defaultChaosMaxActivityDelay
+	}
+	percent := func(probability float64) string {
+		return strconv.FormatFloat(probability*100, 'f', -1, 64)
+	}
+	config := map[string]map[string]string{
+		pressurePointTypeActivityFailure: {
+			pressurePointConfigProbability: percent(options.ActivityFailureProbability),
+		},
+		pressurePointTypeActivityHeartbeatTimeout: {
+			pressurePointConfigProbability: percent(options.HeartbeatTimeoutProbability),
+		},
+		pressurePointTypeActivityDelay: {
+			pressurePointConfigProbability: percent(options.ActivityDelayProbability),
+			pressurePointConfigMaxDelay:    maxActivityDelay.String(),
+		},
+		pressurePointTypeSignalDuplicate: {
+			pressurePointConfigProbability: percent(options.DuplicateSignalProbability),
+		},
+		pressurePointTypeWorkflowEviction: {
+			pressurePointConfigProbability: percent(options.EvictionProbability),
+		},
+	}
+	return newSeededPressurePointMgr(config, options.Seed, env.logger)
+}
+
+// injectActivityFailure returns the failure of an activity attempt injected by chaos mode, or nil. Failures are only
+// injected when the activity is retried after them, so that they do not change the result of the workflow.
+func (env *testWorkflowEnvironmentImpl) injectActivityFailure(parameters ExecuteActivityParams,
+	task *workflowservice.PollActivityTaskQueueResponse, expireTime time.Time) *workflowservice.RespondActivityTaskFailedRequest {
+	if env.chaos == nil || parameters.RetryPolicy == nil {
+		return nil
+	}
+	key := fmt.Sprintf("%v_%v", env.makeUniqueActivityID(ActivityID{id: string(task.TaskToken)}), task.GetAttempt())
+	var err error
+	if parameters.HeartbeatTimeout > 0 && env.chaos.fire(pressurePointTypeActivityHeartbeatTimeout, key) {
+		err = NewHeartbeatTimeoutError()
+	} else if env.chaos.fire(pressurePointTypeActivityFailure, key) {
+		err = NewApplicationError("activity failure injected by chaos mode", chaosErrorType, false, nil)
+	} else {
+		return nil
+	}
+	p := fromProtoRetryPolicy(parameters.RetryPolicy)
+	if getRetryBackoffWithNowTime(p, task.GetAttempt(), err, env.Now(), expireTime) <= 0 {
+		return nil
+	}
+	env.logger.Debug("Chaos mode failed activity attempt.", tagActivityID, string(task.TaskToken),
+		tagAttempt, task.GetAttempt(), tagError, err)
+	return &workflowservice.RespondActivityTaskFailedRequest{
+		TaskToken: task.TaskToken,
+		Failure:   ConvertErrorToFailure(err, env.GetDataConverter()),
+	}
+}
+
+// deliverActivityResult delivers the result of an activity to the workflow, after a delay on the workflow clock if
+// chaos mode decides so.
+func (env *testWorkflowEnvironmentImpl) deliverActivityResult(activityID ActivityID, handleResult func()) {
+	if env.chaos != nil && env.chaos.fire(pressurePointTypeActivityDelay, env.makeUniqueActivityID(activityID)) {
+		delay := env.chaos.delay(pressurePointTypeActivityDelay, env.makeUniqueActivityID(activityID))
+		env.logger.Debug("Chaos mode delayed activity result.", tagActivityID, activityID, "Delay", delay)
+		env.newTimer(delay, func(result *commonpb.Payloads, err error) { handleResult() }, false)
+		return
+	}
+	handleResult()
+}
+
+// deliverSignal delivers the signal to the workflow, twice if chaos mode decides so.
+func (env *testWorkflowEnvironmentImpl) deliverSignal(signalName string, input *commonpb.Payloads) {
+	var key string
+	if env.chaos != nil && env.historyRecorder != nil {
+		key = fmt.Sprintf("%v_%v_%v", env.workflowInfo.WorkflowExecution.RunID, signalName, len(env.historyRecorder.events))
+	}
+	for {
+		if env.historyRecorder != nil {
+			env.historyRecorder.workflowExecutionSignaled(signalName, input)
+		}
+		env.signalHandler(signalName, input)
+		if key == "" || !env.chaos.fire(pressurePointTypeSignalDuplicate, key) {
+			return
+		}
+		env.logger.Debug("Chaos mode duplicated signal.", tagWorkflowID, env.workflowInfo.WorkflowExecution.ID,
+			"SignalName", signalName)
+		key = ""
+	}
+}
+
+// evictWorkflow evicts the workflow if chaos mode decides so. The history of the workflow up to the last completed
+// workflow task is replayed from scratch, the same way a worker replays a workflow evicted from its cache, and a new
+// workflow instance that replayed the calls of the running one continues the execution in its place. A replay failure
+// replaces the result of the test workflow.
+func (env *testWorkflowEnvironmentImpl) evictWorkflow() {
+	workflowDef, ok := env.workflowDef.(*evictableWorkflowDefinition)
+	if !ok || env.chaosErr != nil || env.historyRecorder == nil || env.historyRecorder.skipReplay {
+		return
+	}
+	key := fmt.Sprintf("%v_%v", env.workflowInfo.WorkflowExecution.RunID, env.historyRecorder.completedEvents)
+	if !env.chaos.fire(pressurePointTypeWorkflowEviction, key) {
+		return
+	}
+	env.logger.Debug("Chaos mode evicted workflow.", tagWorkflowID, env.workflowInfo.WorkflowExecution.ID)
+	err := env.historyRecorder.replayCompletedWorkflowTasks()
+	if err == nil {
+		err = workflowDef.evict()
+	}
+	if err != nil {
+		env.logger.Error("Replay of evicted workflow failed.",
+			tagWorkflowType, env.workflowInfo.WorkflowType.Name,
+			tagWorkflowID, env.workflowInfo.WorkflowExecution.ID,
+			tagError, err)
+		env.chaosErr = err
+	}
+}
+
+// compareTestResults returns an error describing the difference between results of the test workflows, or nil.
+func compareTestResults(expected, actual *testWorkflowEnvironmentImpl) error {
+	if expected.testError != nil || actual.testError != nil {
+		if expected.testError == nil || actual.testError == nil || expected.testError.Error() != actual.testError.Error() {
+			return fmt.Errorf("expected error: %v, actual error: %v", expected.testError, actual.testError)
+		}
+		return nil
+	}
+	var expectedResult, actualResult *commonpb.Payloads
+	if v, ok := expected.testResult.(*EncodedValue); ok && v != nil {
+		expectedResult = v.value
+	}
+	if v, ok := actual.testResult.(*EncodedValue); ok && v != nil {
+		actualResult = v.value
+	}
+	if !proto.Equal(expectedResult, actualResult) {
+		return fmt.Errorf("expected result: %v, actual result: %v", expectedResult, actualResult)
+	}
+	return nil
+}
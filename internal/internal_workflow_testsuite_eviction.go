@@ -0,0 +1,449 @@
+// The MIT License
+//
+// Copyright (c) 2020 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package internal
+
+import (
+	"fmt"
+	"time"
+
+	commonpb "go.temporal.io/api/common/v1"
+
+	"go.temporal.io/sdk/converter"
+)
+
+type (
+	// evictableWorkflowDefinition runs the workflow of a test environment in chaos mode so that it can be evicted. It
+	// logs the calls between the workflow and the environment, so that a new workflow instance can replay them and
+	// take over the execution, the same way a worker replays a workflow evicted from its cache.
+	evictableWorkflowDefinition struct {
+		env        *testWorkflowEnvironmentImpl
+		definition WorkflowDefinition
+		instance   *evictableWorkflowInstance
+		header     *commonpb.Header
+		input      *commonpb.Payloads
+
+		// events is the log of the calls between the workflow and the environment since the workflow started.
+		events []*evictableWorkflowEvent
+		// callbacks holds the callbacks of the running instance by slot. The environment calls them through their
+		// slot, so that the instance replacing an evicted one takes them over.
+		callbacks []interface{}
+	}
+
+	// evictableWorkflowInstance is the WorkflowEnvironment of a single workflow instance of an
+	// evictableWorkflowDefinition.
+	evictableWorkflowInstance struct {
+		*testWorkflowEnvironmentImpl
+		definition *evictableWorkflowDefinition
+		// replay is set while the instance replays the log of the instance it replaces.
+		replay *evictableWorkflowReplay
+		// evicted is set once the instance is replaced, its calls are ignored from then on.
+		evicted bool
+	}
+
+	evictableWorkflowReplay struct {
+		next      int // index of the next event to replay
+		now       time.Time
+		callbacks []interface{}
+		err       error
+	}
+
+	// evictableWorkflowEvent is a dispatch of the workflow code, a call made by the workflow to the environment or a
+	// call of a workflow callback made by the environment.
+	evictableWorkflowEvent struct {
+		dispatch     bool
+		dispatchTime time.Time
+
+		// call is the name of the environment method called by the workflow and key is the argument identifying the
+		// call. A replaying instance must make the same calls in the same order.
+		call    string
+		key     string
+		slots   []int         // slots of the callbacks passed to the call
+		results []interface{} // values returned by the call
+
+		// deliver calls the callback in slots[0] with the arguments the environment called it with.
+		deliver func(callback interface{})
+	}
+)
+
+func newEvictableWorkflowDefinition(env *testWorkflowEnvironmentImpl, definition WorkflowDefinition) *evictableWorkflowDefinition {
+	return &evictableWorkflowDefinition{env: env, definition: definition}
+}
+
+func (d *evictableWorkflowDefinition) Execute(_ WorkflowEnvironment, header *commonpb.Header, input *commonpb.Payloads) {
+	d.header = header
+	d.input = input
+	d.instance = &evictableWorkflowInstance{testWorkflowEnvironmentImpl: d.env, definition: d}
+	d.definition.Execute(d.instance, header, input)
+}
+
+func (d *evictableWorkflowDefinition) OnWorkflowTaskStarted(deadlockDetectionTimeout time.Duration) {
+	// Dispatches before the execution started only wait for the workflow mock, which a replaying instance skips.
+	if d.env.historyRecorder != nil && d.env.historyRecorder.executionStarted {
+		d.events = append(d.events, &evictableWorkflowEvent{dispatch: true, dispatchTime: d.env.Now()})
+	}
+	d.definition.OnWorkflowTaskStarted(deadlockDetectionTimeout)
+}
+
+func (d *evictableWorkflowDefinition) StackTrace() string {
+	return d.definition.StackTrace()
+}
+
+func (d *evictableWorkflowDefinition) Close() {
+	d.definition.Close()
+}
+
+// evict replaces the running workflow instance with a new one that replays the logged calls. The running instance is
+// kept if the new one doesn't make the same calls.
+func (d *evictableWorkflowDefinition) evict() error {
+	definition, err := d.env.getWorkflowDefinition(d.env.workflowInfo.WorkflowType, true)
+	if err != nil {
+		return err
+	}
+	replay := &evictableWorkflowReplay{callbacks: make([]interface{}, len(d.callbacks))}
+	instance := &evictableWorkflowInstance{testWorkflowEnvironmentImpl: d.env, definition: d, replay: replay}
+	definition.Execute(instance, d.header, d.input)
+	for replay.err == nil && replay.next < len(d.events) {
+		event := d.events[replay.next]
+		replay.next++
+		switch {
+		case event.dispatch:
+			replay.now = event.dispatchTime
+			definition.OnWorkflowTaskStarted(d.env.workerOptions.DeadlockDetectionTimeout)
+		case event.deliver != nil:
+			if callback := replay.callbacks[event.slots[0]]; callback != nil {
+				event.deliver(callback)
+			}
+		default:
+			replay.err = newNonDeterminismError(fmt.Sprintf("replayed workflow didn't call %v", event), nil, nil)
+		}
+	}
+	if replay.err != nil {
+		instance.evicted = true
+		definition.Close()
+		return replay.err
+	}
+
+	d.instance.evicted = true
+	d.definition.Close()
+	instance.replay = nil
+	d.definition = definition
+	d.instance = instance
+	copy(d.callbacks, replay.callbacks)
+	return nil
+}
+
+// logCall logs a call made by the running instance and puts the given callbacks in new slots.
+func (d *evictableWorkflowDefinition) logCall(call, key string, callbacks ...interface{}) *evictableWorkflowEvent {
+	event := &evictableWorkflowEvent{call: call, key: key}
+	for _, callback := range callbacks {
+		event.slots = append(event.slots, len(d.callbacks))
+		d.callbacks = append(d.callbacks, callback)
+	}
+	d.events = append(d.events, event)
+	return event
+}
+
+// deliver logs and makes a call of the callback in the given slot.
+func (d *evictableWorkflowDefinition) deliver(slot int, deliver func(callback interface{})) {
+	d.events = append(d.events, &evictableWorkflowEvent{slots: []int{slot}, deliver: deliver})
+	deliver(d.callbacks[slot])
+}
+
+func (d *evictableWorkflowDefinition) resultHandler(slot int) ResultHandler {
+	return func(result *commonpb.Payloads, err error) {
+		d.deliver(slot, func(callback interface{}) {
+			callback.(ResultHandler)(result, err)
+		})
+	}
+}
+
+func (e *evictableWorkflowEvent) String() string {
+	switch {
+	case e.dispatch:
+		return "workflow task"
+	case e.deliver != nil:
+		return "callback"
+	default:
+		return fmt.Sprintf("%v(%v)", e.call, e.key)
+	}
+}
+
+// call returns the logged event of a call made by the instance, and true if the instance is running and the call
+// must be made to the environment. The event is nil if the call is ignored.
+func (i *evictableWorkflowInstance) call(call, key string, callbacks ...interface{}) (*evictableWorkflowEvent, bool) {
+	if i.evicted {
+		return nil, false
+	}
+	if i.replay == nil {
+		return i.definition.logCall(call, key, callbacks...), true
+	}
+
+	r := i.replay
+	if r.err != nil {
+		return nil, false
+	}
+	events := i.definition.events
+	if r.next >= len(events) || events[r.next].call != call || events[r.next].key != key {
+		expected := "nothing"
+		if r.next < len(events) {
+			expected = events[r.next].String()
+		}
+		r.err = newNonDeterminismError(fmt.Sprintf("replayed workflow called %v(%v), evicted workflow had %v",
+			call, key, expected), nil, nil)
+		return nil, false
+	}
+	event := events[r.next]
+	r.next++
+	for j, slot := range event.slots {
+		r.callbacks[slot] = callbacks[j]
+	}
+	return event, false
+}
+
+func (i *evictableWorkflowInstance) ExecuteActivity(parameters ExecuteActivityParams, callback ResultHandler) ActivityID {
+	event, running := i.call("ExecuteActivity", parameters.ActivityType.Name, callback)
+	if event == nil {
+		return ActivityID{}
+	}
+	if running {
+		activityID := i.testWorkflowEnvironmentImpl.ExecuteActivity(parameters, i.definition.resultHandler(event.slots[0]))
+		event.results = []interface{}{activityID}
+	}
+	return event.results[0].(ActivityID)
+}
+
+func (i *evictableWorkflowInstance) RequestCancelActivity(activityID ActivityID) {
+	if _, running := i.call("RequestCancelActivity", activityID.id); running {
+		i.testWorkflowEnvironmentImpl.RequestCancelActivity(activityID)
+	}
+}
+
+func (i *evictableWorkflowInstance) ExecuteLocalActivity(params ExecuteLocalActivityParams, callback LocalActivityResultHandler) LocalActivityID {
+	event, running := i.call("ExecuteLocalActivity", params.ActivityType, callback)
+	if event == nil {
+		return LocalActivityID{}
+	}
+	if running {
+		slot := event.slots[0]
+		activityID := i.testWorkflowEnvironmentImpl.ExecuteLocalActivity(params, func(lar *LocalActivityResultWrapper) {
+			i.definition.deliver(slot, func(callback interface{}) {
+				callback.(LocalActivityResultHandler)(lar)
+			})
+		})
+		event.results = []interface{}{activityID}
+	}
+	return event.results[0].(LocalActivityID)
+}
+
+func (i *evictableWorkflowInstance) RequestCancelLocalActivity(activityID LocalActivityID) {
+	if _, running := i.call("RequestCancelLocalActivity", activityID.id); running {
+		i.testWorkflowEnvironmentImpl.RequestCancelLocalActivity(activityID)
+	}
+}
+
+func (i *evictableWorkflowInstance) Now() time.Time {
+	if i.replay != nil {
+		return i.replay.now
+	}
+	return i.testWorkflowEnvironmentImpl.Now()
+}
+
+func (i *evictableWorkflowInstance) NewTimer(d time.Duration, callback ResultHandler) *TimerID {
+	event, running := i.call("NewTimer", d.String(), callback)
+	if event == nil {
+		return &TimerID{}
+	}
+	if running {
+		event.results = []interface{}{i.testWorkflowEnvironmentImpl.NewTimer(d, i.definition.resultHandler(event.slots[0]))}
+	}
+	return event.results[0].(*TimerID)
+}
+
+func (i *evictableWorkflowInstance) RequestCancelTimer(timerID TimerID) {
+	if _, running := i.call("RequestCancelTimer", timerID.id); running {
+		i.testWorkflowEnvironmentImpl.RequestCancelTimer(timerID)
+	}
+}
+
+func (i *evictableWorkflowInstance) SideEffect(f func() (*commonpb.Payloads, error), callback ResultHandler) {
+	event, running := i.call("SideEffect", "")
+	if event == nil {
+		return
+	}
+	if running {
+		i.testWorkflowEnvironmentImpl.SideEffect(f, func(result *commonpb.Payloads, err error) {
+			event.results = []interface{}{result, err}
+			callback(result, err)
+		})
+		return
+	}
+	result, _ := event.results[0].(*commonpb.Payloads)
+	err, _ := event.results[1].(error)
+	callback(result, err)
+}
+
+func (i *evictableWorkflowInstance) GetVersion(changeID string, minSupported, maxSupported Version) Version {
+	event, running := i.call("GetVersion", changeID)
+	if event == nil {
+		return DefaultVersion
+	}
+	if running {
+		event.results = []interface{}{i.testWorkflowEnvironmentImpl.GetVersion(changeID, minSupported, maxSupported)}
+	}
+	return event.results[0].(Version)
+}
+
+func (i *evictableWorkflowInstance) MutableSideEffect(id string, f func() interface{}, equals func(a, b interface{}) bool) converter.EncodedValue {
+	event, running := i.call("MutableSideEffect", id)
+	if event == nil {
+		return newEncodedValue(nil, i.GetDataConverter())
+	}
+	if running {
+		event.results = []interface{}{i.testWorkflowEnvironmentImpl.MutableSideEffect(id, f, equals)}
+	}
+	return event.results[0].(converter.EncodedValue)
+}
+
+func (i *evictableWorkflowInstance) UpsertSearchAttributes(attributes map[string]interface{}) error {
+	event, running := i.call("UpsertSearchAttributes", "")
+	if event == nil {
+		return nil
+	}
+	if running {
+		event.results = []interface{}{i.testWorkflowEnvironmentImpl.UpsertSearchAttributes(attributes)}
+	}
+	err, _ := event.results[0].(error)
+	return err
+}
+
+func (i *evictableWorkflowInstance) UpsertMemo(memo map[string]interface{}) error {
+	event, running := i.call("UpsertMemo", "")
+	if event == nil {
+		return nil
+	}
+	if running {
+		event.results = []interface{}{i.testWorkflowEnvironmentImpl.UpsertMemo(memo)}
+	}
+	err, _ := event.results[0].(error)
+	return err
+}
+
+func (i *evictableWorkflowInstance) Complete(result *commonpb.Payloads, err error) {
+	switch {
+	case i.evicted:
+	case i.replay != nil:
+		// the evicted instance was still running when its calls were replayed
+		if i.replay.err == nil {
+			msg := "replayed workflow completed"
+			if err != nil {
+				msg += ": " + err.Error()
+			}
+			i.replay.err = newNonDeterminismError(msg, nil, nil)
+		}
+	default:
+		i.testWorkflowEnvironmentImpl.Complete(result, err)
+	}
+}
+
+func (i *evictableWorkflowInstance) RegisterCancelHandler(handler func()) {
+	if event, running := i.call("RegisterCancelHandler", "", handler); running {
+		slot := event.slots[0]
+		i.testWorkflowEnvironmentImpl.RegisterCancelHandler(func() {
+			i.definition.deliver(slot, func(callback interface{}) {
+				callback.(func())()
+			})
+		})
+	}
+}
+
+func (i *evictableWorkflowInstance) RegisterSignalHandler(handler func(name string, input *commonpb.Payloads)) {
+	if event, running := i.call("RegisterSignalHandler", "", handler); running {
+		slot := event.slots[0]
+		i.testWorkflowEnvironmentImpl.RegisterSignalHandler(func(name string, input *commonpb.Payloads) {
+			i.definition.deliver(slot, func(callback interface{}) {
+				callback.(func(string, *commonpb.Payloads))(name, input)
+			})
+		})
+	}
+}
+
+func (i *evictableWorkflowInstance) RegisterQueryHandler(handler func(string, *commonpb.Payloads) (*commonpb.Payloads, error)) {
+	if event, running := i.call("RegisterQueryHandler", "", handler); running {
+		// queries don't change the workflow state, so they are not logged
+		slot := event.slots[0]
+		i.testWorkflowEnvironmentImpl.RegisterQueryHandler(func(queryType string, queryArgs *commonpb.Payloads) (*commonpb.Payloads, error) {
+			return i.definition.callbacks[slot].(func(string, *commonpb.Payloads) (*commonpb.Payloads, error))(queryType, queryArgs)
+		})
+	}
+}
+
+func (i *evictableWorkflowInstance) RequestCancelChildWorkflow(namespace, workflowID string) {
+	if _, running := i.call("RequestCancelChildWorkflow", workflowID); running {
+		i.testWorkflowEnvironmentImpl.RequestCancelChildWorkflow(namespace, workflowID)
+	}
+}
+
+func (i *evictableWorkflowInstance) RequestCancelExternalWorkflow(namespace, workflowID, runID string, callback ResultHandler) {
+	if event, running := i.call("RequestCancelExternalWorkflow", workflowID, callback); running {
+		i.testWorkflowEnvironmentImpl.RequestCancelExternalWorkflow(namespace, workflowID, runID,
+			i.definition.resultHandler(event.slots[0]))
+	}
+}
+
+func (i *evictableWorkflowInstance) ExecuteChildWorkflow(params ExecuteWorkflowParams, callback ResultHandler, startedHandler func(r WorkflowExecution, e error)) {
+	if event, running := i.call("ExecuteChildWorkflow", params.WorkflowType.Name, callback, startedHandler); running {
+		slot := event.slots[1]
+		i.testWorkflowEnvironmentImpl.ExecuteChildWorkflow(params, i.definition.resultHandler(event.slots[0]),
+			func(r WorkflowExecution, e error) {
+				i.definition.deliver(slot, func(callback interface{}) {
+					callback.(func(WorkflowExecution, error))(r, e)
+				})
+			})
+	}
+}
+
+func (i *evictableWorkflowInstance) SignalExternalWorkflow(namespace, workflowID, runID, signalName string, input *commonpb.Payloads,
+	arg interface{}, childWorkflowOnly bool, callback ResultHandler) {
+	if event, running := i.call("SignalExternalWorkflow", workflowID+"/"+signalName, callback); running {
+		i.testWorkflowEnvironmentImpl.SignalExternalWorkflow(namespace, workflowID, runID, signalName, input, arg,
+			childWorkflowOnly, i.definition.resultHandler(event.slots[0]))
+	}
+}
+
+func (i *evictableWorkflowInstance) IsReplaying() bool {
+	return i.replay != nil
+}
+
+func (i *evictableWorkflowInstance) AddSession(sessionInfo *SessionInfo) {
+	if !i.evicted && i.replay == nil {
+		i.testWorkflowEnvironmentImpl.AddSession(sessionInfo)
+	}
+}
+
+func (i *evictableWorkflowInstance) RemoveSession(sessionID string) {
+	if !i.evicted && i.replay == nil {
+		i.testWorkflowEnvironmentImpl.RemoveSession(sessionID)
+	}
+}
@@ -0,0 +1,1096 @@
+// The MIT License
+//
+// Copyright (c) 2020 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	commonpb "go.temporal.io/api/common/v1"
+	enumspb "go.temporal.io/api/enums/v1"
+	failurepb "go.temporal.io/api/failure/v1"
+	historypb "go.temporal.io/api/history/v1"
+	taskqueuepb "go.temporal.io/api/taskqueue/v1"
+	"go.temporal.io/api/workflowservice/v1"
+
+)
+
+type (
+	// testHistoryRecorder builds the event history of a workflow run executed by testWorkflowEnvironmentImpl. Events
+	// are written the way the server writes them for the commands of a real worker, including the IDs the SDK
+	// generates for activities, timers and child workflows, so that the history can be replayed by WorkflowReplayer.
+	testHistoryRecorder struct {
+		env    *testWorkflowEnvironmentImpl
+		events []*historypb.HistoryEvent
+		// approximate size of the events, counted the same way as by the worker.
+		size int
+
+		// commands of the currently open workflow task, written to history when the task completes.
+		taskOpen             bool
+		taskScheduledEventID int64
+		taskStartedEventID   int64
+		commands             []*testRecordedCommand
+		// number of events up to the commands of the last completed workflow task.
+		completedEvents int
+		// same as commandsHelper.nextCommandEventID, used by the SDK to generate IDs of commands.
+		nextCommandEventID int64
+		// events that happened while the workflow was blocked, written before the next workflow task.
+		pendingEvents []testPendingEvent
+		dispatching   bool
+		// set when the workflow code starts running. Dispatches before that only wait for workflow mocks and are
+		// not workflow tasks.
+		executionStarted bool
+
+		activities           map[string]*testRecordedActivity
+		timers               map[string]*testRecordedCommand
+		children             map[string]*testRecordedChild
+		localActivities      map[string]string
+		localActivityCounter int64
+		sideEffectCounter    int64
+		mutableSideEffects   map[string]*commonpb.Payloads
+
+		closed bool
+		// set when the recorded history is known to be not replayable, like after a workflow panic.
+		skipReplay bool
+		// first failure to record an event, the recorded history is incomplete if set.
+		err error
+	}
+
+	testRecordedCommand struct {
+		eventID int64 // ID the SDK assigns to the command, used for generated activity, timer and child IDs.
+		build   func(workflowTaskCompletedEventID int64) *historypb.HistoryEvent
+		event   *historypb.HistoryEvent // set once the command is written to history
+		// command was canceled in the same workflow task it was created, so it is never sent to server.
+		dropped bool
+	}
+
+	testPendingEvent struct {
+		write func()
+		// whether the event causes server to schedule a new workflow task.
+		newWorkflowTask bool
+	}
+
+	testRecordedActivity struct {
+		command             *testRecordedCommand
+		waitForCancellation bool
+	}
+
+	testRecordedChild struct {
+		command      *testRecordedCommand
+		namespace    string
+		workflowID   string
+		workflowType string
+		runID        string
+		started      *historypb.HistoryEvent
+	}
+)
+
+func newTestHistoryRecorder(env *testWorkflowEnvironmentImpl) *testHistoryRecorder {
+	return &testHistoryRecorder{
+		env:                env,
+		activities:         make(map[string]*testRecordedActivity),
+		timers:             make(map[string]*testRecordedCommand),
+		children:           make(map[string]*testRecordedChild),
+		localActivities:    make(map[string]string),
+		mutableSideEffects: make(map[string]*commonpb.Payloads),
+	}
+}
+
+// history returns a copy of the events recorded so far.
+func (r *testHistoryRecorder) history() (*historypb.History, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	return copyHistory(r.events)
+}
+
+func copyHistory(events []*historypb.HistoryEvent) (*historypb.History, error) {
+	// proto.Clone does not support the stdtime fields of the events.
+	data, err := (&historypb.History{Events: events}).Marshal()
+	if err != nil {
+		return nil, err
+	}
+	history := &historypb.History{}
+	if err := history.Unmarshal(data); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// fail stops replay of the recorded history after an event could not be recorded.
+func (r *testHistoryRecorder) fail(err error) {
+	if r.err == nil {
+		r.err = fmt.Errorf("unable to record workflow history: %w", err)
+	}
+}
+
+// finish is called when the test execution is over.
+func (r *testHistoryRecorder) finish() {
+	if r.taskOpen && !r.closed {
+		// workflow is still running when test completes, same as worker it completes the current workflow task.
+		r.completeWorkflowTask()
+	}
+}
+
+// replay replays the recorded history with the workflow definitions registered in the test environment.
+func (r *testHistoryRecorder) replay() error {
+	if r.err != nil {
+		return r.err
+	}
+	if r.skipReplay || len(r.events) < 3 {
+		return nil
+	}
+	history, err := r.history()
+	if err != nil {
+		return err
+	}
+	return r.replayHistory(history)
+}
+
+// replayCompletedWorkflowTasks replays the history up to the last completed workflow task, the same way a worker
+// replays a workflow evicted from its cache.
+func (r *testHistoryRecorder) replayCompletedWorkflowTasks() error {
+	if r.err != nil {
+		return r.err
+	}
+	if r.skipReplay || r.completedEvents < 4 {
+		return nil
+	}
+	history, err := copyHistory(r.events[:r.completedEvents])
+	if err != nil {
+		return err
+	}
+	return r.replayHistory(history)
+}
+
+func (r *testHistoryRecorder) replayHistory(history *historypb.History) error {
+	lengthThreshold, sizeThreshold := r.env.continueAsNewSuggestedThresholds()
+	replayer := &WorkflowReplayer{
+		registry:           r.env.registry,
+		dataConverter:      r.env.GetDataConverter(),
+		contextPropagators: r.env.contextPropagators,
+
+		continueAsNewSuggestedHistoryLength: lengthThreshold,
+		continueAsNewSuggestedHistorySize:   sizeThreshold,
+	}
+	return replayer.replayWorkflowHistory(r.env.logger, nil, ReplayNamespace, history, nil)
+}
+
+func (r *testHistoryRecorder) write(event *historypb.HistoryEvent) *historypb.HistoryEvent {
+	now := r.env.Now()
+	event.EventId = int64(len(r.events)) + 1
+	event.EventTime = &now
+	r.events = append(r.events, event)
+	r.size += event.Size()
+	return event
+}
+
+func (r *testHistoryRecorder) command(build func(workflowTaskCompletedEventID int64) *historypb.HistoryEvent) *testRecordedCommand {
+	if !r.taskOpen {
+		r.openWorkflowTask()
+	}
+	c := &testRecordedCommand{eventID: r.nextCommandEventID, build: build}
+	r.nextCommandEventID++
+	r.commands = append(r.commands, c)
+	return c
+}
+
+func (r *testHistoryRecorder) event(newWorkflowTask bool, write func()) {
+	if r.closed {
+		return
+	}
+	r.pendingEvents = append(r.pendingEvents, testPendingEvent{write: write, newWorkflowTask: newWorkflowTask})
+}
+
+// startWorkflowTask is called before the workflow code is dispatched. Same as server, a new workflow task is only
+// started if something the workflow could be waiting on happened since the current one started. It returns true if
+// the current workflow task was completed.
+func (r *testHistoryRecorder) startWorkflowTask() bool {
+	r.dispatching = true
+	if r.closed || !r.executionStarted || (r.taskOpen && !r.hasNewWorkflowTaskEvents()) {
+		return false
+	}
+	completed := r.taskOpen
+	if completed {
+		r.completeWorkflowTask()
+	}
+	r.openWorkflowTask()
+	return completed
+}
+
+// startExecution is called when the workflow code is about to run, the first workflow task starts with the next
+// dispatch.
+func (r *testHistoryRecorder) startExecution() {
+	r.executionStarted = true
+}
+
+// workflowTaskDispatched is called after the workflow code is blocked again.
+func (r *testHistoryRecorder) workflowTaskDispatched() {
+	r.dispatching = false
+}
+
+func (r *testHistoryRecorder) hasNewWorkflowTaskEvents() bool {
+	for _, e := range r.pendingEvents {
+		if e.newWorkflowTask {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *testHistoryRecorder) writePendingEvents() {
+	pendingEvents := r.pendingEvents
+	r.pendingEvents = nil
+	for _, e := range pendingEvents {
+		e.write()
+	}
+}
+
+func (r *testHistoryRecorder) openWorkflowTask() {
+	r.writePendingEvents()
+	info := r.env.workflowInfo
+	timeout := info.WorkflowTaskTimeout
+	scheduled := r.write(&historypb.HistoryEvent{
+		EventType: enumspb.EVENT_TYPE_WORKFLOW_TASK_SCHEDULED,
+		Attributes: &historypb.HistoryEvent_WorkflowTaskScheduledEventAttributes{WorkflowTaskScheduledEventAttributes: &historypb.WorkflowTaskScheduledEventAttributes{
+			TaskQueue:           &taskqueuepb.TaskQueue{Name: info.TaskQueueName, Kind: enumspb.TASK_QUEUE_KIND_NORMAL},
+			StartToCloseTimeout: &timeout,
+			Attempt:             1,
+		}},
+	})
+	started := r.write(&historypb.HistoryEvent{
+		EventType: enumspb.EVENT_TYPE_WORKFLOW_TASK_STARTED,
+		Attributes: &historypb.HistoryEvent_WorkflowTaskStartedEventAttributes{WorkflowTaskStartedEventAttributes: &historypb.WorkflowTaskStartedEventAttributes{
+			ScheduledEventId: scheduled.EventId,
+			Identity:         r.env.identity,
+		}},
+	})
+	r.taskOpen = true
+	r.taskScheduledEventID = scheduled.EventId
+	r.taskStartedEventID = started.EventId
+	// WorkflowTaskCompleted takes the next event ID, commands follow it.
+	r.nextCommandEventID = started.EventId + 2
+	// the worker updates history length and size before it applies the events of a workflow task
+	r.env.setCurrentHistoryStats(int(started.EventId), r.size)
+}
+
+func (r *testHistoryRecorder) completeWorkflowTask() {
+	completed := r.write(&historypb.HistoryEvent{
+		EventType: enumspb.EVENT_TYPE_WORKFLOW_TASK_COMPLETED,
+		Attributes: &historypb.HistoryEvent_WorkflowTaskCompletedEventAttributes{WorkflowTaskCompletedEventAttributes: &historypb.WorkflowTaskCompletedEventAttributes{
+			ScheduledEventId: r.taskScheduledEventID,
+			StartedEventId:   r.taskStartedEventID,
+			Identity:         r.env.identity,
+		}},
+	})
+	commands := r.commands
+	r.commands = nil
+	r.taskOpen = false
+	for _, c := range commands {
+		if !c.dropped {
+			c.event = r.write(c.build(completed.EventId))
+		}
+	}
+	r.completedEvents = len(r.events)
+}
+
+func (r *testHistoryRecorder) failWorkflowTask(err error) {
+	if r.closed {
+		return
+	}
+	if !r.taskOpen {
+		r.openWorkflowTask()
+	}
+	r.write(&historypb.HistoryEvent{
+		EventType: enumspb.EVENT_TYPE_WORKFLOW_TASK_FAILED,
+		Attributes: &historypb.HistoryEvent_WorkflowTaskFailedEventAttributes{WorkflowTaskFailedEventAttributes: &historypb.WorkflowTaskFailedEventAttributes{
+			ScheduledEventId: r.taskScheduledEventID,
+			StartedEventId:   r.taskStartedEventID,
+			Cause:            enumspb.WORKFLOW_TASK_FAILED_CAUSE_WORKFLOW_WORKER_UNHANDLED_FAILURE,
+			Failure:          ConvertErrorToFailure(err, r.env.GetDataConverter()),
+			Identity:         r.env.identity,
+		}},
+	})
+	r.commands = nil
+	r.pendingEvents = nil
+	r.taskOpen = false
+	r.closed = true
+	r.skipReplay = true
+}
+
+func (r *testHistoryRecorder) workflowExecutionStarted(header *commonpb.Header, input *commonpb.Payloads) {
+	info := r.env.workflowInfo
+	executionTimeout := info.WorkflowExecutionTimeout
+	runTimeout := info.WorkflowRunTimeout
+	taskTimeout := info.WorkflowTaskTimeout
+	firstRunID := r.env.firstRunID
+	if firstRunID == "" {
+		firstRunID = info.WorkflowExecution.RunID
+	}
+	attributes := &historypb.WorkflowExecutionStartedEventAttributes{
+		WorkflowType:             &commonpb.WorkflowType{Name: info.WorkflowType.Name},
+		ParentWorkflowNamespace:  info.ParentWorkflowNamespace,
+		TaskQueue:                &taskqueuepb.TaskQueue{Name: info.TaskQueueName, Kind: enumspb.TASK_QUEUE_KIND_NORMAL},
+		Input:                    input,
+		WorkflowExecutionTimeout: &executionTimeout,
+		WorkflowRunTimeout:       &runTimeout,
+		WorkflowTaskTimeout:      &taskTimeout,
+		ContinuedExecutionRunId:  info.ContinuedExecutionRunID,
+		ContinuedFailure:         info.lastFailure,
+		LastCompletionResult:     info.lastCompletionResult,
+		OriginalExecutionRunId:   info.WorkflowExecution.RunID,
+		Identity:                 r.env.identity,
+		FirstExecutionRunId:      firstRunID,
+		Attempt:                  info.Attempt,
+		CronSchedule:             info.CronSchedule,
+		Memo:                     info.Memo,
+		SearchAttributes:         info.SearchAttributes,
+		Header:                   header,
+	}
+	if info.ParentWorkflowExecution != nil {
+		attributes.ParentWorkflowExecution = &commonpb.WorkflowExecution{
+			WorkflowId: info.ParentWorkflowExecution.ID,
+			RunId:      info.ParentWorkflowExecution.RunID,
+		}
+	}
+	r.write(&historypb.HistoryEvent{
+		EventType:  enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_STARTED,
+		Attributes: &historypb.HistoryEvent_WorkflowExecutionStartedEventAttributes{WorkflowExecutionStartedEventAttributes: attributes},
+	})
+}
+
+// workflowExecutionClosed records the close of the workflow execution. Workflow code closes the execution with a
+// command, everything else (timeout, termination, cancellation of a child by its parent) closes it from outside.
+func (r *testHistoryRecorder) workflowExecutionClosed(result *commonpb.Payloads, err error) {
+	if r.closed {
+		return
+	}
+	var panicErr *workflowPanicError
+	if errors.As(err, &panicErr) {
+		r.failWorkflowTask(err)
+		return
+	}
+
+	dc := r.env.GetDataConverter()
+	var canceledErr *CanceledError
+	var timeoutErr *TimeoutError
+	var terminatedErr *TerminatedError
+	var continueAsNewErr *ContinueAsNewError
+	if !r.dispatching {
+		if !r.executionStarted {
+			r.skipReplay = true
+		}
+		if r.taskOpen {
+			r.completeWorkflowTask()
+		}
+		r.writePendingEvents()
+		event := &historypb.HistoryEvent{}
+		switch {
+		case errors.As(err, &timeoutErr):
+			event.EventType = enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_TIMED_OUT
+			event.Attributes = &historypb.HistoryEvent_WorkflowExecutionTimedOutEventAttributes{WorkflowExecutionTimedOutEventAttributes: &historypb.WorkflowExecutionTimedOutEventAttributes{
+				RetryState: enumspb.RETRY_STATE_TIMEOUT,
+			}}
+		case errors.As(err, &terminatedErr):
+			event.EventType = enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_TERMINATED
+			event.Attributes = &historypb.HistoryEvent_WorkflowExecutionTerminatedEventAttributes{WorkflowExecutionTerminatedEventAttributes: &historypb.WorkflowExecutionTerminatedEventAttributes{
+				Reason:   "parent close policy",
+				Identity: r.env.identity,
+			}}
+		default:
+			// the workflow code did not observe this close, so the history cannot be replayed.
+			event.EventType = enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_CANCELED
+			event.Attributes = &historypb.HistoryEvent_WorkflowExecutionCanceledEventAttributes{WorkflowExecutionCanceledEventAttributes: &historypb.WorkflowExecutionCanceledEventAttributes{}}
+			r.skipReplay = true
+		}
+		r.write(event)
+		r.closed = true
+		return
+	}
+
+	r.command(func(workflowTaskCompletedEventID int64) *historypb.HistoryEvent {
+		switch {
+		case err == nil:
+			return &historypb.HistoryEvent{
+				EventType: enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_COMPLETED,
+				Attributes: &historypb.HistoryEvent_WorkflowExecutionCompletedEventAttributes{WorkflowExecutionCompletedEventAttributes: &historypb.WorkflowExecutionCompletedEventAttributes{
+					Result:                       result,
+					WorkflowTaskCompletedEventId: workflowTaskCompletedEventID,
+				}},
+			}
+		case errors.As(err, &canceledErr):
+			return &historypb.HistoryEvent{
+				EventType: enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_CANCELED,
+				Attributes: &historypb.HistoryEvent_WorkflowExecutionCanceledEventAttributes{WorkflowExecutionCanceledEventAttributes: &historypb.WorkflowExecutionCanceledEventAttributes{
+					Details:                      convertErrDetailsToPayloads(canceledErr.details, dc),
+					WorkflowTaskCompletedEventId: workflowTaskCompletedEventID,
+				}},
+			}
+		case errors.As(err, &continueAsNewErr):
+			runTimeout := continueAsNewErr.WorkflowRunTimeout
+			taskTimeout := continueAsNewErr.WorkflowTaskTimeout
+			return &historypb.HistoryEvent{
+				EventType: enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_CONTINUED_AS_NEW,
+				Attributes: &historypb.HistoryEvent_WorkflowExecutionContinuedAsNewEventAttributes{WorkflowExecutionContinuedAsNewEventAttributes: &historypb.WorkflowExecutionContinuedAsNewEventAttributes{
+					NewExecutionRunId:            r.env.continuedRunID(),
+					WorkflowType:                 &commonpb.WorkflowType{Name: continueAsNewErr.WorkflowType.Name},
+					TaskQueue:                    &taskqueuepb.TaskQueue{Name: continueAsNewErr.TaskQueueName, Kind: enumspb.TASK_QUEUE_KIND_NORMAL},
+					Input:                        continueAsNewErr.Input,
+					WorkflowRunTimeout:           &runTimeout,
+					WorkflowTaskTimeout:          &taskTimeout,
+					WorkflowTaskCompletedEventId: workflowTaskCompletedEventID,
+					Initiator:                    enumspb.CONTINUE_AS_NEW_INITIATOR_WORKFLOW,
+					Header:                       continueAsNewErr.Header,
+					Memo:                         continueAsNewErr.Memo,
+					SearchAttributes:             continueAsNewErr.SearchAttributes,
+				}},
+			}
+		default:
+			return &historypb.HistoryEvent{
+				EventType: enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_FAILED,
+				Attributes: &historypb.HistoryEvent_WorkflowExecutionFailedEventAttributes{WorkflowExecutionFailedEventAttributes: &historypb.WorkflowExecutionFailedEventAttributes{
+					Failure:                      ConvertErrorToFailure(err, dc),
+					RetryState:                   enumspb.RETRY_STATE_RETRY_POLICY_NOT_SET,
+					WorkflowTaskCompletedEventId: workflowTaskCompletedEventID,
+				}},
+			}
+		}
+	})
+	r.completeWorkflowTask()
+	r.pendingEvents = nil
+	r.closed = true
+}
+
+func (r *testHistoryRecorder) workflowExecutionSignaled(signalName string, input *commonpb.Payloads) {
+	r.event(true, func() {
+		r.write(&historypb.HistoryEvent{
+			EventType: enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_SIGNALED,
+			Attributes: &historypb.HistoryEvent_WorkflowExecutionSignaledEventAttributes{WorkflowExecutionSignaledEventAttributes: &historypb.WorkflowExecutionSignaledEventAttributes{
+				SignalName: signalName,
+				Input:      input,
+				Identity:   r.env.identity,
+			}},
+		})
+	})
+}
+
+func (r *testHistoryRecorder) workflowExecutionCancelRequested() {
+	r.event(true, func() {
+		r.write(&historypb.HistoryEvent{
+			EventType: enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_CANCEL_REQUESTED,
+			Attributes: &historypb.HistoryEvent_WorkflowExecutionCancelRequestedEventAttributes{WorkflowExecutionCancelRequestedEventAttributes: &historypb.WorkflowExecutionCancelRequestedEventAttributes{
+				Identity: r.env.identity,
+			}},
+		})
+	})
+}
+
+// activityTaskScheduled records the schedule of an activity. Activity ID generated by the test environment is
+// replaced by the one the SDK would generate.
+func (r *testHistoryRecorder) activityTaskScheduled(attributes *historypb.ActivityTaskScheduledEventAttributes, generatedID, waitForCancellation bool) {
+	if r.closed {
+		return
+	}
+	activityID := attributes.ActivityId
+	c := r.command(nil)
+	if generatedID {
+		attributes.ActivityId = getStringID(c.eventID)
+	}
+	c.build = func(workflowTaskCompletedEventID int64) *historypb.HistoryEvent {
+		attributes.WorkflowTaskCompletedEventId = workflowTaskCompletedEventID
+		return &historypb.HistoryEvent{
+			EventType:  enumspb.EVENT_TYPE_ACTIVITY_TASK_SCHEDULED,
+			Attributes: &historypb.HistoryEvent_ActivityTaskScheduledEventAttributes{ActivityTaskScheduledEventAttributes: attributes},
+		}
+	}
+	r.activities[activityID] = &testRecordedActivity{command: c, waitForCancellation: waitForCancellation}
+}
+
+// activityTaskClosed records the result of an activity, result is one of the values handled by handleActivityResult.
+func (r *testHistoryRecorder) activityTaskClosed(activityID string, result interface{}) {
+	activity, ok := r.activities[activityID]
+	if !ok {
+		return
+	}
+	delete(r.activities, activityID)
+	r.event(true, func() {
+		scheduledEventID := activity.command.event.EventId
+		started := r.write(&historypb.HistoryEvent{
+			EventType: enumspb.EVENT_TYPE_ACTIVITY_TASK_STARTED,
+			Attributes: &historypb.HistoryEvent_ActivityTaskStartedEventAttributes{ActivityTaskStartedEventAttributes: &historypb.ActivityTaskStartedEventAttributes{
+				ScheduledEventId: scheduledEventID,
+				Identity:         r.env.identity,
+				Attempt:          1,
+			}},
+		})
+		event := &historypb.HistoryEvent{}
+		switch request := result.(type) {
+		case *workflowservice.RespondActivityTaskCanceledRequest:
+			// The activity was not requested to cancel, so the server records its canceled error as a failure.
+			event.EventType = enumspb.EVENT_TYPE_ACTIVITY_TASK_FAILED
+			event.Attributes = &historypb.HistoryEvent_ActivityTaskFailedEventAttributes{ActivityTaskFailedEventAttributes: &historypb.ActivityTaskFailedEventAttributes{
+				Failure: &failurepb.Failure{
+					Message: "canceled",
+					FailureInfo: &failurepb.Failure_CanceledFailureInfo{CanceledFailureInfo: &failurepb.CanceledFailureInfo{
+						Details: request.Details,
+					}},
+				},
+				ScheduledEventId: scheduledEventID,
+				StartedEventId:   started.EventId,
+				Identity:         r.env.identity,
+				RetryState:       enumspb.RETRY_STATE_NON_RETRYABLE_FAILURE,
+			}}
+		case *workflowservice.RespondActivityTaskFailedRequest:
+			event.EventType = enumspb.EVENT_TYPE_ACTIVITY_TASK_FAILED
+			event.Attributes = &historypb.HistoryEvent_ActivityTaskFailedEventAttributes{ActivityTaskFailedEventAttributes: &historypb.ActivityTaskFailedEventAttributes{
+				Failure:          request.Failure,
+				ScheduledEventId: scheduledEventID,
+				StartedEventId:   started.EventId,
+				Identity:         r.env.identity,
+				RetryState:       enumspb.RETRY_STATE_UNSPECIFIED,
+			}}
+		case *workflowservice.RespondActivityTaskCompletedRequest:
+			event.EventType = enumspb.EVENT_TYPE_ACTIVITY_TASK_COMPLETED
+			event.Attributes = &historypb.HistoryEvent_ActivityTaskCompletedEventAttributes{ActivityTaskCompletedEventAttributes: &historypb.ActivityTaskCompletedEventAttributes{
+				Result:           request.Result,
+				ScheduledEventId: scheduledEventID,
+				StartedEventId:   started.EventId,
+				Identity:         r.env.identity,
+			}}
+		default:
+			timeoutErr := NewTimeoutError("Activity timeout", enumspb.TIMEOUT_TYPE_START_TO_CLOSE, nil)
+			event.EventType = enumspb.EVENT_TYPE_ACTIVITY_TASK_TIMED_OUT
+			event.Attributes = &historypb.HistoryEvent_ActivityTaskTimedOutEventAttributes{ActivityTaskTimedOutEventAttributes: &historypb.ActivityTaskTimedOutEventAttributes{
+				Failure:          ConvertErrorToFailure(timeoutErr, r.env.GetDataConverter()),
+				ScheduledEventId: scheduledEventID,
+				StartedEventId:   started.EventId,
+				RetryState:       enumspb.RETRY_STATE_TIMEOUT,
+			}}
+		}
+		r.write(event)
+	})
+}
+
+func (r *testHistoryRecorder) activityTaskCancelRequested(activityID string) {
+	activity, ok := r.activities[activityID]
+	if !ok {
+		return
+	}
+	delete(r.activities, activityID)
+	if activity.command.event == nil {
+		activity.command.dropped = true
+		return
+	}
+	scheduledEventID := activity.command.event.EventId
+	c := r.command(func(workflowTaskCompletedEventID int64) *historypb.HistoryEvent {
+		return &historypb.HistoryEvent{
+			EventType: enumspb.EVENT_TYPE_ACTIVITY_TASK_CANCEL_REQUESTED,
+			Attributes: &historypb.HistoryEvent_ActivityTaskCancelRequestedEventAttributes{ActivityTaskCancelRequestedEventAttributes: &historypb.ActivityTaskCancelRequestedEventAttributes{
+				ScheduledEventId:             scheduledEventID,
+				WorkflowTaskCompletedEventId: workflowTaskCompletedEventID,
+			}},
+		}
+	})
+	// without WaitForCancellation the workflow does not wait for the canceled event.
+	r.event(activity.waitForCancellation, func() {
+		r.write(&historypb.HistoryEvent{
+			EventType: enumspb.EVENT_TYPE_ACTIVITY_TASK_CANCELED,
+			Attributes: &historypb.HistoryEvent_ActivityTaskCanceledEventAttributes{ActivityTaskCanceledEventAttributes: &historypb.ActivityTaskCanceledEventAttributes{
+				LatestCancelRequestedEventId: c.event.EventId,
+				ScheduledEventId:             scheduledEventID,
+				Identity:                     r.env.identity,
+			}},
+		})
+	})
+}
+
+func (r *testHistoryRecorder) timerStarted(timerID string, d time.Duration) {
+	if r.closed {
+		return
+	}
+	c := r.command(nil)
+	c.build = func(workflowTaskCompletedEventID int64) *historypb.HistoryEvent {
+		return &historypb.HistoryEvent{
+			EventType: enumspb.EVENT_TYPE_TIMER_STARTED,
+			Attributes: &historypb.HistoryEvent_TimerStartedEventAttributes{TimerStartedEventAttributes: &historypb.TimerStartedEventAttributes{
+				TimerId:                      getStringID(c.eventID),
+				StartToFireTimeout:           &d,
+				WorkflowTaskCompletedEventId: workflowTaskCompletedEventID,
+			}},
+		}
+	}
+	r.timers[timerID] = c
+}
+
+func (r *testHistoryRecorder) timerFired(timerID string) {
+	c, ok := r.timers[timerID]
+	if !ok {
+		return
+	}
+	delete(r.timers, timerID)
+	r.event(true, func() {
+		r.write(&historypb.HistoryEvent{
+			EventType: enumspb.EVENT_TYPE_TIMER_FIRED,
+			Attributes: &historypb.HistoryEvent_TimerFiredEventAttributes{TimerFiredEventAttributes: &historypb.TimerFiredEventAttributes{
+				TimerId:        getStringID(c.eventID),
+				StartedEventId: c.event.EventId,
+			}},
+		})
+	})
+}
+
+func (r *testHistoryRecorder) timerCanceled(timerID string) {
+	c, ok := r.timers[timerID]
+	if !ok {
+		return
+	}
+	delete(r.timers, timerID)
+	if c.event == nil {
+		c.dropped = true
+		return
+	}
+	r.command(func(workflowTaskCompletedEventID int64) *historypb.HistoryEvent {
+		return &historypb.HistoryEvent{
+			EventType: enumspb.EVENT_TYPE_TIMER_CANCELED,
+			Attributes: &historypb.HistoryEvent_TimerCanceledEventAttributes{TimerCanceledEventAttributes: &historypb.TimerCanceledEventAttributes{
+				TimerId:                      getStringID(c.eventID),
+				StartedEventId:               c.event.EventId,
+				WorkflowTaskCompletedEventId: workflowTaskCompletedEventID,
+				Identity:                     r.env.identity,
+			}},
+		}
+	})
+}
+
+func (r *testHistoryRecorder) marker(name string, details map[string]*commonpb.Payloads, failure *failurepb.Failure) {
+	if r.closed {
+		return
+	}
+	r.command(func(workflowTaskCompletedEventID int64) *historypb.HistoryEvent {
+		return &historypb.HistoryEvent{
+			EventType: enumspb.EVENT_TYPE_MARKER_RECORDED,
+			Attributes: &historypb.HistoryEvent_MarkerRecordedEventAttributes{MarkerRecordedEventAttributes: &historypb.MarkerRecordedEventAttributes{
+				MarkerName:                   name,
+				Details:                      details,
+				Failure:                      failure,
+				WorkflowTaskCompletedEventId: workflowTaskCompletedEventID,
+			}},
+		}
+	})
+}
+
+func (r *testHistoryRecorder) sideEffect(data *commonpb.Payloads) {
+	r.sideEffectCounter++
+	r.marker(sideEffectMarkerName, map[string]*commonpb.Payloads{
+		sideEffectMarkerIDName:   r.encode(r.sideEffectCounter),
+		sideEffectMarkerDataName: data,
+	}, nil)
+}
+
+// mutableSideEffect records a marker when the value is new or changed, same as workflowEnvironmentImpl.
+func (r *testHistoryRecorder) mutableSideEffect(id string, value interface{}, equals func(a, b interface{}) bool) {
+	if old, ok := r.mutableSideEffects[id]; ok {
+		if value == nil {
+			if proto.Equal(r.encode(nil), old) {
+				return
+			}
+		} else {
+			// same as decodeValue, but the recording fails instead of the workflow
+			oldValue := reflect.New(reflect.TypeOf(value))
+			if err := newEncodedValue(old, r.env.GetDataConverter()).Get(oldValue.Interface()); err != nil {
+				r.fail(err)
+				return
+			}
+			if equals(value, oldValue.Elem().Interface()) {
+				return
+			}
+		}
+	}
+	data := r.encode(value)
+	r.mutableSideEffects[id] = data
+	details, err := encodeArgs(r.env.GetDataConverter(), []interface{}{id, data})
+	if err != nil {
+		r.fail(err)
+		return
+	}
+	r.marker(mutableSideEffectMarkerName, map[string]*commonpb.Payloads{
+		sideEffectMarkerIDName:   r.encode(id),
+		sideEffectMarkerDataName: details,
+	}, nil)
+}
+
+func (r *testHistoryRecorder) version(changeID string, version Version) {
+	r.marker(versionMarkerName, map[string]*commonpb.Payloads{
+		versionMarkerChangeIDName: r.encode(changeID),
+		versionMarkerDataName:     r.encode(version),
+	}, nil)
+}
+
+func (r *testHistoryRecorder) upsertSearchAttributes(attributes *commonpb.SearchAttributes) {
+	if r.closed {
+		return
+	}
+	r.command(func(workflowTaskCompletedEventID int64) *historypb.HistoryEvent {
+		return &historypb.HistoryEvent{
+			EventType: enumspb.EVENT_TYPE_UPSERT_WORKFLOW_SEARCH_ATTRIBUTES,
+			Attributes: &historypb.HistoryEvent_UpsertWorkflowSearchAttributesEventAttributes{UpsertWorkflowSearchAttributesEventAttributes: &historypb.UpsertWorkflowSearchAttributesEventAttributes{
+				SearchAttributes:             attributes,
+				WorkflowTaskCompletedEventId: workflowTaskCompletedEventID,
+			}},
+		}
+	})
+}
+
+func (r *testHistoryRecorder) upsertMemo(memo *commonpb.Memo) {
+	data, err := r.env.GetDataConverter().ToPayloads(memo)
+	if err != nil {
+		r.fail(err)
+		return
+	}
+	r.marker(upsertMemoMarkerName, map[string]*commonpb.Payloads{upsertMemoMarkerDataName: data}, nil)
+}
+
+func (r *testHistoryRecorder) localActivityScheduled(activityID string) {
+	r.localActivityCounter++
+	r.localActivities[activityID] = getStringID(r.localActivityCounter)
+}
+
+func (r *testHistoryRecorder) localActivityCompleted(result *localActivityResult, wrapper *LocalActivityResultWrapper) {
+	activityID, ok := r.localActivities[result.task.activityID]
+	if !ok {
+		return
+	}
+	delete(r.localActivities, result.task.activityID)
+	markerData := localActivityMarkerData{
+		ActivityID:   activityID,
+		ActivityType: result.task.params.ActivityType,
+		ReplayTime:   r.env.Now(),
+		Attempt:      wrapper.Attempt,
+	}
+	details := map[string]*commonpb.Payloads{}
+	var failure *failurepb.Failure
+	if wrapper.Err != nil {
+		markerData.Backoff = wrapper.Backoff
+		failure = ConvertErrorToFailure(result.err, r.env.GetDataConverter())
+	} else if wrapper.Result != nil {
+		details[localActivityResultName] = wrapper.Result
+	}
+	details[localActivityMarkerDataName] = r.encode(markerData)
+	r.marker(localActivityMarkerName, details, failure)
+}
+
+// childWorkflowInitiated records the start of a child workflow. Workflow ID generated by the test environment is
+// replaced by the one the SDK would generate. startErr is the error the test environment failed to start the child
+// workflow with.
+func (r *testHistoryRecorder) childWorkflowInitiated(params *ExecuteWorkflowParams, workflowID string, generatedID bool, startErr error) {
+	if r.closed {
+		return
+	}
+	c := r.command(nil)
+	child := &testRecordedChild{
+		command:      c,
+		namespace:    params.Namespace,
+		workflowID:   workflowID,
+		workflowType: params.WorkflowType.Name,
+	}
+	if generatedID {
+		child.workflowID = r.env.workflowInfo.WorkflowExecution.RunID + "_" + getStringID(c.eventID)
+	}
+	memo, _ := getWorkflowMemo(params.Memo, r.env.GetDataConverter())
+	searchAttributes, _ := serializeSearchAttributes(params.SearchAttributes)
+	executionTimeout := params.WorkflowExecutionTimeout
+	runTimeout := params.WorkflowRunTimeout
+	taskTimeout := params.WorkflowTaskTimeout
+	c.build = func(workflowTaskCompletedEventID int64) *historypb.HistoryEvent {
+		return &historypb.HistoryEvent{
+			EventType: enumspb.EVENT_TYPE_START_CHILD_WORKFLOW_EXECUTION_INITIATED,
+			Attributes: &historypb.HistoryEvent_StartChildWorkflowExecutionInitiatedEventAttributes{StartChildWorkflowExecutionInitiatedEventAttributes: &historypb.StartChildWorkflowExecutionInitiatedEventAttributes{
+				Namespace:                    child.namespace,
+				WorkflowId:                   child.workflowID,
+				WorkflowType:                 &commonpb.WorkflowType{Name: child.workflowType},
+				TaskQueue:                    &taskqueuepb.TaskQueue{Name: params.TaskQueueName, Kind: enumspb.TASK_QUEUE_KIND_NORMAL},
+				Input:                        params.Input,
+				WorkflowExecutionTimeout:     &executionTimeout,
+				WorkflowRunTimeout:           &runTimeout,
+				WorkflowTaskTimeout:          &taskTimeout,
+				ParentClosePolicy:            params.ParentClosePolicy,
+				WorkflowTaskCompletedEventId: workflowTaskCompletedEventID,
+				WorkflowIdReusePolicy:        params.WorkflowIDReusePolicy,
+				RetryPolicy:                  params.RetryPolicy,
+				CronSchedule:                 params.CronSchedule,
+				Header:                       params.Header,
+				Memo:                         memo,
+				SearchAttributes:             searchAttributes,
+			}},
+		}
+	}
+	if startErr != nil {
+		r.childWorkflowStartFailed(child)
+		return
+	}
+	r.children[workflowID] = child
+}
+
+// childWorkflowStarted records the result of starting a child workflow.
+func (r *testHistoryRecorder) childWorkflowStarted(workflowID, runID string, err error) {
+	child, ok := r.children[workflowID]
+	if !ok {
+		return
+	}
+	if err != nil {
+		delete(r.children, workflowID)
+		r.childWorkflowStartFailed(child)
+		return
+	}
+	child.runID = runID
+	r.event(true, func() {
+		child.started = r.write(&historypb.HistoryEvent{
+			EventType: enumspb.EVENT_TYPE_CHILD_WORKFLOW_EXECUTION_STARTED,
+			Attributes: &historypb.HistoryEvent_ChildWorkflowExecutionStartedEventAttributes{ChildWorkflowExecutionStartedEventAttributes: &historypb.ChildWorkflowExecutionStartedEventAttributes{
+				Namespace:         child.namespace,
+				InitiatedEventId:  child.command.event.EventId,
+				WorkflowExecution: &commonpb.WorkflowExecution{WorkflowId: child.workflowID, RunId: runID},
+				WorkflowType:      &commonpb.WorkflowType{Name: child.workflowType},
+			}},
+		})
+	})
+}
+
+func (r *testHistoryRecorder) childWorkflowStartFailed(child *testRecordedChild) {
+	r.event(true, func() {
+		r.write(&historypb.HistoryEvent{
+			EventType: enumspb.EVENT_TYPE_START_CHILD_WORKFLOW_EXECUTION_FAILED,
+			Attributes: &historypb.HistoryEvent_StartChildWorkflowExecutionFailedEventAttributes{StartChildWorkflowExecutionFailedEventAttributes: &historypb.StartChildWorkflowExecutionFailedEventAttributes{
+				Namespace:        child.namespace,
+				WorkflowId:       child.workflowID,
+				WorkflowType:     &commonpb.WorkflowType{Name: child.workflowType},
+				Cause:            enumspb.START_CHILD_WORKFLOW_EXECUTION_FAILED_CAUSE_WORKFLOW_ALREADY_EXISTS,
+				InitiatedEventId: child.command.event.EventId,
+			}},
+		})
+	})
+}
+
+// childWorkflowClosed records the close of a child workflow, err is the error the child workflow completed with.
+func (r *testHistoryRecorder) childWorkflowClosed(workflowID string, result *commonpb.Payloads, err error) {
+	child, ok := r.children[workflowID]
+	if !ok || child.runID == "" {
+		return
+	}
+	delete(r.children, workflowID)
+	r.event(true, func() {
+		execution := &commonpb.WorkflowExecution{WorkflowId: child.workflowID, RunId: child.runID}
+		workflowType := &commonpb.WorkflowType{Name: child.workflowType}
+		initiatedEventID := child.command.event.EventId
+		startedEventID := child.started.EventId
+		event := &historypb.HistoryEvent{}
+		var canceledErr *CanceledError
+		var timeoutErr *TimeoutError
+		var terminatedErr *TerminatedError
+		switch {
+		case err == nil:
+			event.EventType = enumspb.EVENT_TYPE_CHILD_WORKFLOW_EXECUTION_COMPLETED
+			event.Attributes = &historypb.HistoryEvent_ChildWorkflowExecutionCompletedEventAttributes{ChildWorkflowExecutionCompletedEventAttributes: &historypb.ChildWorkflowExecutionCompletedEventAttributes{
+				Result: result, Namespace: child.namespace, WorkflowExecution: execution, WorkflowType: workflowType,
+				InitiatedEventId: initiatedEventID, StartedEventId: startedEventID,
+			}}
+		case errors.As(err, &canceledErr):
+			event.EventType = enumspb.EVENT_TYPE_CHILD_WORKFLOW_EXECUTION_CANCELED
+			event.Attributes = &historypb.HistoryEvent_ChildWorkflowExecutionCanceledEventAttributes{ChildWorkflowExecutionCanceledEventAttributes: &historypb.ChildWorkflowExecutionCanceledEventAttributes{
+				Details:   convertErrDetailsToPayloads(canceledErr.details, r.env.GetDataConverter()),
+				Namespace: child.namespace, WorkflowExecution: execution, WorkflowType: workflowType,
+				InitiatedEventId: initiatedEventID, StartedEventId: startedEventID,
+			}}
+		case errors.As(err, &timeoutErr):
+			event.EventType = enumspb.EVENT_TYPE_CHILD_WORKFLOW_EXECUTION_TIMED_OUT
+			event.Attributes = &historypb.HistoryEvent_ChildWorkflowExecutionTimedOutEventAttributes{ChildWorkflowExecutionTimedOutEventAttributes: &historypb.ChildWorkflowExecutionTimedOutEventAttributes{
+				Namespace: child.namespace, WorkflowExecution: execution, WorkflowType: workflowType,
+				InitiatedEventId: initiatedEventID, StartedEventId: startedEventID, RetryState: enumspb.RETRY_STATE_TIMEOUT,
+			}}
+		case errors.As(err, &terminatedErr):
+			event.EventType = enumspb.EVENT_TYPE_CHILD_WORKFLOW_EXECUTION_TERMINATED
+			event.Attributes = &historypb.HistoryEvent_ChildWorkflowExecutionTerminatedEventAttributes{ChildWorkflowExecutionTerminatedEventAttributes: &historypb.ChildWorkflowExecutionTerminatedEventAttributes{
+				Namespace: child.namespace, WorkflowExecution: execution, WorkflowType: workflowType,
+				InitiatedEventId: initiatedEventID, StartedEventId: startedEventID,
+			}}
+		default:
+			event.EventType = enumspb.EVENT_TYPE_CHILD_WORKFLOW_EXECUTION_FAILED
+			event.Attributes = &historypb.HistoryEvent_ChildWorkflowExecutionFailedEventAttributes{ChildWorkflowExecutionFailedEventAttributes: &historypb.ChildWorkflowExecutionFailedEventAttributes{
+				Failure:   ConvertErrorToFailure(err, r.env.GetDataConverter()),
+				Namespace: child.namespace, WorkflowExecution: execution, WorkflowType: workflowType,
+				InitiatedEventId: initiatedEventID, StartedEventId: startedEventID, RetryState: enumspb.RETRY_STATE_UNSPECIFIED,
+			}}
+		}
+		r.write(event)
+	})
+}
+
+// childWorkflowCancelRequested records the cancellation of a started child workflow through its context.
+func (r *testHistoryRecorder) childWorkflowCancelRequested(workflowID string) {
+	child, ok := r.children[workflowID]
+	if !ok || child.runID == "" || r.closed {
+		return
+	}
+	execution := &commonpb.WorkflowExecution{WorkflowId: child.workflowID}
+	c := r.command(func(workflowTaskCompletedEventID int64) *historypb.HistoryEvent {
+		return &historypb.HistoryEvent{
+			EventType: enumspb.EVENT_TYPE_REQUEST_CANCEL_EXTERNAL_WORKFLOW_EXECUTION_INITIATED,
+			Attributes: &historypb.HistoryEvent_RequestCancelExternalWorkflowExecutionInitiatedEventAttributes{RequestCancelExternalWorkflowExecutionInitiatedEventAttributes: &historypb.RequestCancelExternalWorkflowExecutionInitiatedEventAttributes{
+				WorkflowTaskCompletedEventId: workflowTaskCompletedEventID,
+				Namespace:                    child.namespace,
+				WorkflowExecution:            execution,
+				ChildWorkflowOnly:            true,
+			}},
+		}
+	})
+	r.event(false, func() {
+		r.write(&historypb.HistoryEvent{
+			EventType: enumspb.EVENT_TYPE_EXTERNAL_WORKFLOW_EXECUTION_CANCEL_REQUESTED,
+			Attributes: &historypb.HistoryEvent_ExternalWorkflowExecutionCancelRequestedEventAttributes{ExternalWorkflowExecutionCancelRequestedEventAttributes: &historypb.ExternalWorkflowExecutionCancelRequestedEventAttributes{
+				InitiatedEventId:  c.event.EventId,
+				Namespace:         child.namespace,
+				WorkflowExecution: execution,
+			}},
+		})
+	})
+}
+
+// externalWorkflowExecution maps workflowID of a child workflow to the ID the SDK would generate for it.
+func (r *testHistoryRecorder) externalWorkflowExecution(workflowID, runID string) *commonpb.WorkflowExecution {
+	if child, ok := r.children[workflowID]; ok {
+		workflowID = child.workflowID
+	}
+	return &commonpb.WorkflowExecution{WorkflowId: workflowID, RunId: runID}
+}
+
+// signalExternalWorkflowInitiated records a signal sent to another workflow, the returned function records its
+// result.
+func (r *testHistoryRecorder) signalExternalWorkflowInitiated(namespace, workflowID, runID, signalName string,
+	input *commonpb.Payloads, childWorkflowOnly bool) func(err error) {
+	if r.closed {
+		return func(error) {}
+	}
+	execution := r.externalWorkflowExecution(workflowID, runID)
+	c := r.command(nil)
+	control := getStringID(c.eventID)
+	c.build = func(workflowTaskCompletedEventID int64) *historypb.HistoryEvent {
+		return &historypb.HistoryEvent{
+			EventType: enumspb.EVENT_TYPE_SIGNAL_EXTERNAL_WORKFLOW_EXECUTION_INITIATED,
+			Attributes: &historypb.HistoryEvent_SignalExternalWorkflowExecutionInitiatedEventAttributes{SignalExternalWorkflowExecutionInitiatedEventAttributes: &historypb.SignalExternalWorkflowExecutionInitiatedEventAttributes{
+				WorkflowTaskCompletedEventId: workflowTaskCompletedEventID,
+				Namespace:                    namespace,
+				WorkflowExecution:            execution,
+				SignalName:                   signalName,
+				Input:                        input,
+				Control:                      control,
+				ChildWorkflowOnly:            childWorkflowOnly,
+			}},
+		}
+	}
+	return func(err error) {
+		r.event(true, func() {
+			if err != nil {
+				r.write(&historypb.HistoryEvent{
+					EventType: enumspb.EVENT_TYPE_SIGNAL_EXTERNAL_WORKFLOW_EXECUTION_FAILED,
+					Attributes: &historypb.HistoryEvent_SignalExternalWorkflowExecutionFailedEventAttributes{SignalExternalWorkflowExecutionFailedEventAttributes: &historypb.SignalExternalWorkflowExecutionFailedEventAttributes{
+						Cause:             enumspb.SIGNAL_EXTERNAL_WORKFLOW_EXECUTION_FAILED_CAUSE_EXTERNAL_WORKFLOW_EXECUTION_NOT_FOUND,
+						Namespace:         namespace,
+						WorkflowExecution: execution,
+						InitiatedEventId:  c.event.EventId,
+						Control:           control,
+					}},
+				})
+				return
+			}
+			r.write(&historypb.HistoryEvent{
+				EventType: enumspb.EVENT_TYPE_EXTERNAL_WORKFLOW_EXECUTION_SIGNALED,
+				Attributes: &historypb.HistoryEvent_ExternalWorkflowExecutionSignaledEventAttributes{ExternalWorkflowExecutionSignaledEventAttributes: &historypb.ExternalWorkflowExecutionSignaledEventAttributes{
+					InitiatedEventId:  c.event.EventId,
+					Namespace:         namespace,
+					WorkflowExecution: execution,
+					Control:           control,
+				}},
+			})
+		})
+	}
+}
+
+// requestCancelExternalWorkflowInitiated records a cancellation request sent to another workflow, the returned
+// function records its result.
+func (r *testHistoryRecorder) requestCancelExternalWorkflowInitiated(namespace, workflowID, runID string) func(err error) {
+	if r.closed {
+		return func(error) {}
+	}
+	execution := r.externalWorkflowExecution(workflowID, runID)
+	c := r.command(nil)
+	control := getStringID(c.eventID)
+	c.build = func(workflowTaskCompletedEventID int64) *historypb.HistoryEvent {
+		return &historypb.HistoryEvent{
+			EventType: enumspb.EVENT_TYPE_REQUEST_CANCEL_EXTERNAL_WORKFLOW_EXECUTION_INITIATED,
+			Attributes: &historypb.HistoryEvent_RequestCancelExternalWorkflowExecutionInitiatedEventAttributes{RequestCancelExternalWorkflowExecutionInitiatedEventAttributes: &historypb.RequestCancelExternalWorkflowExecutionInitiatedEventAttributes{
+				WorkflowTaskCompletedEventId: workflowTaskCompletedEventID,
+				Namespace:                    namespace,
+				WorkflowExecution:            execution,
+				Control:                      control,
+			}},
+		}
+	}
+	return func(err error) {
+		r.event(true, func() {
+			if err != nil {
+				r.write(&historypb.HistoryEvent{
+					EventType: enumspb.EVENT_TYPE_REQUEST_CANCEL_EXTERNAL_WORKFLOW_EXECUTION_FAILED,
+					Attributes: &historypb.HistoryEvent_RequestCancelExternalWorkflowExecutionFailedEventAttributes{RequestCancelExternalWorkflowExecutionFailedEventAttributes: &historypb.RequestCancelExternalWorkflowExecutionFailedEventAttributes{
+						Cause:             enumspb.CANCEL_EXTERNAL_WORKFLOW_EXECUTION_FAILED_CAUSE_EXTERNAL_WORKFLOW_EXECUTION_NOT_FOUND,
+						Namespace:         namespace,
+						WorkflowExecution: execution,
+						InitiatedEventId:  c.event.EventId,
+						Control:           control,
+					}},
+				})
+				return
+			}
+			r.write(&historypb.HistoryEvent{
+				EventType: enumspb.EVENT_TYPE_EXTERNAL_WORKFLOW_EXECUTION_CANCEL_REQUESTED,
+				Attributes: &historypb.HistoryEvent_ExternalWorkflowExecutionCancelRequestedEventAttributes{ExternalWorkflowExecutionCancelRequestedEventAttributes: &historypb.ExternalWorkflowExecutionCancelRequestedEventAttributes{
+					InitiatedEventId:  c.event.EventId,
+					Namespace:         namespace,
+					WorkflowExecution: execution,
+				}},
+			})
+		})
+	}
+}
+
+func (r *testHistoryRecorder) encode(value interface{}) *commonpb.Payloads {
+	data, err := encodeArg(r.env.GetDataConverter(), value)
+	if err != nil {
+		r.fail(err)
+	}
+	return data
+}
@@ -29,10 +29,12 @@ import (
 	"errors"
 	"fmt"
 	"runtime"
+	"strconv"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/pborman/uuid"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
 	commonpb "go.temporal.io/api/common/v1"
@@ -711,6 +713,68 @@ func (s *WorkflowTestSuiteUnitTest) Test_ChildWorkflow_Basic() {
 	s.Equal("hello_activity hello_world", actualResult)
 }
 
+func (s *WorkflowTestSuiteUnitTest) Test_CoroutineDebugMode() {
+	workflowFn := func(ctx Context) (string, error) {
+		ctx = WithActivityOptions(ctx, s.activityOptions)
+		var helloActivityResult string
+		err := ExecuteActivity(ctx, testActivityHello, "activity").Get(ctx, &helloActivityResult)
+		if err != nil {
+			return "", err
+		}
+
+		ctx = WithLocalActivityOptions(ctx, s.localActivityOptions)
+		var helloLocalActivityResult string
+		err = ExecuteLocalActivity(ctx, testActivityHello, "local_activity").Get(ctx, &helloLocalActivityResult)
+		if err != nil {
+			return "", err
+		}
+
+		cwo := ChildWorkflowOptions{WorkflowRunTimeout: time.Minute}
+		ctx = WithChildWorkflowOptions(ctx, cwo)
+		var helloWorkflowResult string
+		err = ExecuteChildWorkflow(ctx, testWorkflowHello).Get(ctx, &helloWorkflowResult)
+		if err != nil {
+			return "", err
+		}
+
+		return helloActivityResult + " " + helloLocalActivityResult + " " + helloWorkflowResult, nil
+	}
+
+	env := s.NewTestWorkflowEnvironment()
+	env.SetWorkerOptions(WorkerOptions{EnableCoroutineDebugMode: true})
+	env.RegisterWorkflow(workflowFn)
+	env.RegisterWorkflow(testWorkflowHello)
+	env.RegisterActivity(testActivityHello)
+	env.ExecuteWorkflow(workflowFn)
+
+	s.True(env.IsWorkflowCompleted())
+	s.NoError(env.GetWorkflowError())
+	var actualResult string
+	s.NoError(env.GetWorkflowResult(&actualResult))
+	s.Equal("hello_activity hello_local_activity hello_world", actualResult)
+}
+
+func (s *WorkflowTestSuiteUnitTest) Test_CoroutineDebugMode_NativeGoroutine() {
+	done := make(chan struct{})
+	defer close(done)
+	workflowFn := func(ctx Context) error {
+		go func() {
+			<-done
+		}()
+		return Sleep(ctx, time.Minute)
+	}
+
+	env := s.NewTestWorkflowEnvironment()
+	env.SetWorkerOptions(WorkerOptions{EnableCoroutineDebugMode: true})
+	env.RegisterWorkflow(workflowFn)
+	env.ExecuteWorkflow(workflowFn)
+
+	s.True(env.IsWorkflowCompleted())
+	var panicErr *PanicError
+	s.True(errors.As(env.GetWorkflowError(), &panicErr))
+	s.Contains(panicErr.Error(), "started native goroutine")
+}
+
 func (s *WorkflowTestSuiteUnitTest) Test_ChildWorkflow_BasicWithDataConverter() {
 	workflowFn := func(ctx Context) (string, error) {
 		ctx = WithActivityOptions(ctx, s.activityOptions)
@@ -1534,6 +1598,68 @@ func (s *WorkflowTestSuiteUnitTest) Test_GetVersion() {
 	env.AssertExpectations(s.T())
 }
 
+func (s *WorkflowTestSuiteUnitTest) Test_Patched() {
+	workflowFn := func(ctx Context) ([]bool, error) {
+		DeprecatePatch(ctx, "deprecated_change")
+		return []bool{Patched(ctx, "change_1"), Patched(ctx, "change_2"), Patched(ctx, "change_1")}, nil
+	}
+
+	env := s.NewTestWorkflowEnvironment()
+	env.RegisterWorkflow(workflowFn)
+	env.OnGetVersion("change_2", DefaultVersion, 1).Return(DefaultVersion)
+	env.ExecuteWorkflow(workflowFn)
+
+	s.True(env.IsWorkflowCompleted())
+	s.NoError(env.GetWorkflowError())
+	var patched []bool
+	s.NoError(env.GetWorkflowResult(&patched))
+	s.Equal([]bool{true, false, true}, patched)
+	env.AssertExpectations(s.T())
+}
+
+func (s *WorkflowTestSuiteUnitTest) Test_NewRandom() {
+	workflowFn := func(ctx Context) ([]string, error) {
+		r1 := NewRandom(ctx)
+		r2 := NewRandom(ctx)
+		return []string{
+			strconv.FormatInt(r1.Int63(), 10),
+			strconv.FormatInt(r2.Int63(), 10),
+			NewUUID(ctx),
+			NewUUID(ctx),
+		}, nil
+	}
+	execute := func() []string {
+		env := s.NewTestWorkflowEnvironment()
+		env.RegisterWorkflow(workflowFn)
+		// replay gets the same values from the seed recorded in the history
+		env.SetReplayVerification(true)
+		env.ExecuteWorkflow(workflowFn)
+		s.True(env.IsWorkflowCompleted())
+		s.NoError(env.GetWorkflowError())
+		history, err := env.GetHistory()
+		s.NoError(err)
+		var markers int
+		for _, event := range history.GetEvents() {
+			if event.GetMarkerRecordedEventAttributes().GetMarkerName() == sideEffectMarkerName {
+				markers++
+			}
+		}
+		s.Equal(1, markers)
+		var values []string
+		s.NoError(env.GetWorkflowResult(&values))
+		return values
+	}
+
+	values := execute()
+	s.NotEqual(values[0], values[1])
+	s.NotEqual(values[2], values[3])
+	version, ok := uuid.Parse(values[2]).Version()
+	s.True(ok)
+	s.Equal(uuid.Version(4), version)
+	// every execution records a new seed
+	s.NotEqual(values, execute())
+}
+
 func (s *WorkflowTestSuiteUnitTest) Test_MockGetVersion() {
 	oldActivity := func(ctx context.Context, msg string) (string, error) {
 		return "hello" + "_" + msg, nil
@@ -1668,6 +1794,249 @@ func (s *WorkflowTestSuiteUnitTest) Test_MockUpsertSearchAttributes() {
 	// mix no-mock and mock is not support
 }
 
+func (s *WorkflowTestSuiteUnitTest) Test_UpsertTypedSearchAttributes() {
+	intKey := NewSearchAttributeKeyInt64("CustomIntField")
+	keywordKey := NewSearchAttributeKeyKeyword("CustomKeywordField")
+	timeKey := NewSearchAttributeKeyTime("CustomDatetimeField")
+	startTime := time.Date(2021, 4, 27, 15, 4, 5, 0, time.UTC)
+	workflowFn := func(ctx Context) error {
+		searchAttributes := GetWorkflowInfo(ctx).GetTypedSearchAttributes()
+		keyword, ok := searchAttributes.GetKeyword(keywordKey)
+		s.True(ok)
+		s.Equal("seattle", keyword)
+		_, ok = searchAttributes.GetInt64(intKey)
+		s.False(ok)
+
+		err := UpsertTypedSearchAttributes(ctx, intKey.ValueSet(2), timeKey.ValueSet(startTime))
+		s.NoError(err)
+
+		searchAttributes = GetWorkflowInfo(ctx).GetTypedSearchAttributes()
+		s.Equal(3, searchAttributes.Size())
+		intValue, ok := searchAttributes.GetInt64(intKey)
+		s.True(ok)
+		s.Equal(int64(2), intValue)
+		timeValue, ok := searchAttributes.GetTime(timeKey)
+		s.True(ok)
+		s.True(startTime.Equal(timeValue))
+		// keyword value does not decode as int
+		_, ok = searchAttributes.GetInt64(NewSearchAttributeKeyInt64("CustomKeywordField"))
+		s.False(ok)
+
+		err = UpsertTypedSearchAttributes(ctx, NewSearchAttributeKeyKeywordList(TemporalChangeVersion).ValueSet([]string{"v"}))
+		s.Error(err)
+		return nil
+	}
+
+	env := s.NewTestWorkflowEnvironment()
+	env.RegisterWorkflow(workflowFn)
+	s.NoError(env.SetTypedSearchAttributesOnStart(keywordKey.ValueSet("seattle")))
+	env.ExecuteWorkflow(workflowFn)
+	s.True(env.IsWorkflowCompleted())
+	s.Nil(env.GetWorkflowError())
+}
+
+func (s *WorkflowTestSuiteUnitTest) Test_UpsertMemo() {
+	workflowFn := func(ctx Context) error {
+		memo := GetWorkflowInfo(ctx).GetDecodedMemo()
+		s.Equal(1, len(memo))
+		var description string
+		s.NoError(memo["Description"].Get(&description))
+		s.Equal("started", description)
+
+		err := UpsertMemo(ctx, map[string]interface{}{})
+		s.Error(err)
+
+		err = UpsertMemo(ctx, map[string]interface{}{"Description": "processing", "Progress": 50})
+		s.NoError(err)
+
+		memo = GetWorkflowInfo(ctx).GetDecodedMemo()
+		s.Equal(2, len(memo))
+		s.NoError(memo["Description"].Get(&description))
+		s.Equal("processing", description)
+		var progress int
+		s.NoError(memo["Progress"].Get(&progress))
+		s.Equal(50, progress)
+		return nil
+	}
+
+	// no mock
+	env := s.NewTestWorkflowEnvironment()
+	env.RegisterWorkflow(workflowFn)
+	s.NoError(env.SetMemoOnStart(map[string]interface{}{"Description": "started"}))
+	env.ExecuteWorkflow(workflowFn)
+	s.True(env.IsWorkflowCompleted())
+	s.Nil(env.GetWorkflowError())
+	env.AssertExpectations(s.T())
+
+	// has mock
+	env = s.NewTestWorkflowEnvironment()
+	s.NoError(env.SetMemoOnStart(map[string]interface{}{"Description": "started"}))
+	env.OnUpsertMemo(map[string]interface{}{}).Return(errors.New("empty")).Once()
+	env.OnUpsertMemo(map[string]interface{}{"Description": "processing", "Progress": 50}).Return(nil).Once()
+	env.ExecuteWorkflow(workflowFn)
+	s.True(env.IsWorkflowCompleted())
+	s.Nil(env.GetWorkflowError())
+	env.AssertExpectations(s.T())
+}
+
+func (s *WorkflowTestSuiteUnitTest) Test_UpsertMemo_DataConverter() {
+	dc := iconverter.NewTestDataConverter()
+	workflowFn := func(ctx Context) (string, error) {
+		if err := UpsertMemo(ctx, map[string]interface{}{"Progress": 50}); err != nil {
+			return "", err
+		}
+		memo := GetWorkflowInfo(ctx).GetDecodedMemo()
+		var description string
+		if err := memo["Description"].Get(&description); err != nil {
+			return "", err
+		}
+		var progress int
+		if err := memo["Progress"].Get(&progress); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%v %v", description, progress), nil
+	}
+
+	env := s.NewTestWorkflowEnvironment()
+	env.SetDataConverter(dc)
+	env.SetReplayVerification(true)
+	env.RegisterWorkflow(workflowFn)
+	s.NoError(env.SetMemoOnStart(map[string]interface{}{"Description": "started"}))
+	env.ExecuteWorkflow(workflowFn)
+	s.True(env.IsWorkflowCompleted())
+	s.NoError(env.GetWorkflowError())
+	var result string
+	s.NoError(env.GetWorkflowResult(&result))
+	s.Equal("started 50", result)
+
+	// memo is encoded with the data converter of the workflow, not the default one
+	history, err := env.GetHistory()
+	s.NoError(err)
+	var markers int
+	for _, event := range history.Events {
+		if attributes := event.GetMarkerRecordedEventAttributes(); attributes != nil {
+			markers++
+			var memo commonpb.Memo
+			s.NoError(dc.FromPayloads(attributes.Details[upsertMemoMarkerDataName], &memo))
+			var progress int
+			s.NoError(dc.FromPayload(memo.Fields["Progress"], &progress))
+			s.Equal(50, progress)
+			s.Error(converter.GetDefaultDataConverter().FromPayload(memo.Fields["Progress"], &progress))
+		}
+	}
+	s.Equal(1, markers)
+}
+
+func (s *WorkflowTestSuiteUnitTest) Test_ContinueAsNewSuggested() {
+	workflowFn := func(ctx Context) (bool, error) {
+		info := GetWorkflowInfo(ctx)
+		s.Equal(100, info.GetCurrentHistoryLength())
+		s.Equal(2048, info.GetCurrentHistorySize())
+		return info.GetContinueAsNewSuggested(), nil
+	}
+
+	env := s.NewTestWorkflowEnvironment()
+	env.RegisterWorkflow(workflowFn)
+	env.SetCurrentHistoryLength(100)
+	env.SetCurrentHistorySize(2048)
+	env.ExecuteWorkflow(workflowFn)
+	s.True(env.IsWorkflowCompleted())
+	s.NoError(env.GetWorkflowError())
+	var suggested bool
+	s.NoError(env.GetWorkflowResult(&suggested))
+	s.False(suggested)
+
+	env = s.NewTestWorkflowEnvironment()
+	env.RegisterWorkflow(workflowFn)
+	env.SetWorkerOptions(WorkerOptions{ContinueAsNewSuggestedHistoryLength: 100})
+	env.SetCurrentHistoryLength(100)
+	env.SetCurrentHistorySize(2048)
+	env.ExecuteWorkflow(workflowFn)
+	s.True(env.IsWorkflowCompleted())
+	s.NoError(env.GetWorkflowError())
+	s.NoError(env.GetWorkflowResult(&suggested))
+	s.True(suggested)
+}
+
+func (s *WorkflowTestSuiteUnitTest) Test_ContinueAsNewSuggested_RecordedHistory() {
+	workflowFn := func(ctx Context) ([]int, error) {
+		info := GetWorkflowInfo(ctx)
+		var lengths []int
+		for !info.GetContinueAsNewSuggested() {
+			lengths = append(lengths, info.GetCurrentHistoryLength())
+			if info.GetCurrentHistorySize() <= 0 {
+				return nil, errors.New("history size is not counted")
+			}
+			if err := Sleep(ctx, time.Minute); err != nil {
+				return nil, err
+			}
+		}
+		return lengths, nil
+	}
+
+	env := s.NewTestWorkflowEnvironment()
+	env.RegisterWorkflow(workflowFn)
+	env.SetWorkerOptions(WorkerOptions{ContinueAsNewSuggestedHistoryLength: 20})
+	// replay of the recorded history fails if the worker counts history differently
+	env.SetReplayVerification(true)
+	env.ExecuteWorkflow(workflowFn)
+	s.True(env.IsWorkflowCompleted())
+	s.NoError(env.GetWorkflowError())
+	var lengths []int
+	s.NoError(env.GetWorkflowResult(&lengths))
+	// each workflow task adds TimerStarted, TimerFired, WorkflowTaskScheduled, WorkflowTaskStarted and
+	// WorkflowTaskCompleted events
+	s.Equal([]int{3, 8, 13, 18}, lengths)
+}
+
+func (s *WorkflowTestSuiteUnitTest) Test_SetSignalHandler() {
+	workflowFn := func(ctx Context) ([]string, error) {
+		var received []string
+		s.Error(SetSignalHandler(ctx, "add", func(value int) {}))
+		s.Error(SetSignalHandler(ctx, "add", func(ctx Context, value int) error { return nil }))
+
+		// signal sent before the handler is set is buffered
+		err := Sleep(ctx, time.Minute)
+		s.NoError(err)
+
+		err = SetSignalHandler(ctx, "add", func(ctx Context, value int) {
+			received = append(received, fmt.Sprintf("start-%v", value))
+			// blocking handler doesn't delay other handlers
+			_ = Sleep(ctx, time.Duration(10-value)*time.Second)
+			received = append(received, fmt.Sprintf("end-%v", value))
+		})
+		s.NoError(err)
+		err = SetSignalHandler(ctx, "done", func(ctx Context) {
+			received = append(received, "done")
+		})
+		s.NoError(err)
+
+		err = Await(ctx, func() bool { return len(received) > 0 && received[len(received)-1] == "done" })
+		return received, err
+	}
+
+	env := s.NewTestWorkflowEnvironment()
+	env.RegisterWorkflow(workflowFn)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("add", 1)
+	}, time.Second)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("add", 2)
+		env.SignalWorkflow("add", "corrupted")
+		env.SignalWorkflow("add", 3)
+	}, 2*time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("done", nil)
+	}, 3*time.Minute)
+	env.ExecuteWorkflow(workflowFn)
+
+	s.True(env.IsWorkflowCompleted())
+	s.NoError(env.GetWorkflowError())
+	var received []string
+	s.NoError(env.GetWorkflowResult(&received))
+	s.Equal([]string{"start-1", "end-1", "start-2", "start-3", "end-3", "end-2", "done"}, received)
+}
+
 func (s *WorkflowTestSuiteUnitTest) Test_ActivityWithPointerTypes() {
 	var actualValues []string
 	retVal := "retVal"
@@ -3679,3 +4048,577 @@ func (s *WorkflowTestSuiteUnitTest) Test_AwaitWithTimeoutTimeout() {
 	_ = env.GetWorkflowResult(&result)
 	s.False(result)
 }
+
+func (s *WorkflowTestSuiteUnitTest) Test_ReplayVerification() {
+	childWorkflowFn := func(ctx Context, name string) (string, error) {
+		ctx = WithActivityOptions(ctx, s.activityOptions)
+		var result string
+		err := ExecuteActivity(ctx, testActivityHello, name).Get(ctx, &result)
+		return result, err
+	}
+	workflowFn := func(ctx Context) (string, error) {
+		var signal string
+		GetSignalChannel(ctx, "signal").Receive(ctx, &signal)
+		if err := Sleep(ctx, time.Minute); err != nil {
+			return "", err
+		}
+		ctx = WithChildWorkflowOptions(ctx, ChildWorkflowOptions{WorkflowRunTimeout: time.Minute})
+		var result string
+		err := ExecuteChildWorkflow(ctx, childWorkflowFn, signal).Get(ctx, &result)
+		return result, err
+	}
+
+	env := s.NewTestWorkflowEnvironment()
+	env.SetReplayVerification(true)
+	env.RegisterWorkflow(workflowFn)
+	env.RegisterWorkflow(childWorkflowFn)
+	env.RegisterActivity(testActivityHello)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("signal", "replay")
+	}, time.Second)
+	env.ExecuteWorkflow(workflowFn)
+
+	s.True(env.IsWorkflowCompleted())
+	s.NoError(env.GetWorkflowError())
+	var result string
+	s.NoError(env.GetWorkflowResult(&result))
+	s.Equal("hello_replay", result)
+}
+
+func (s *WorkflowTestSuiteUnitTest) Test_ReplayVerification_Parallel() {
+	workflowFn := func(ctx Context, name string) (string, error) {
+		ctx = WithActivityOptions(ctx, s.activityOptions)
+		var result string
+		err := ExecuteActivity(ctx, testActivityHello, name).Get(ctx, &result)
+		return result, err
+	}
+
+	// recorded histories of all test environments have the same run ID
+	results := make([]string, 8)
+	errs := make([]error, len(results))
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			env := s.NewTestWorkflowEnvironment()
+			env.SetReplayVerification(true)
+			env.RegisterWorkflow(workflowFn)
+			env.RegisterActivity(testActivityHello)
+			env.ExecuteWorkflow(workflowFn, fmt.Sprintf("replay%v", i))
+			if errs[i] = env.GetWorkflowError(); errs[i] == nil {
+				errs[i] = env.GetWorkflowResult(&results[i])
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i, result := range results {
+		s.NoError(errs[i])
+		s.Equal(fmt.Sprintf("hello_replay%v", i), result)
+	}
+}
+
+func (s *WorkflowTestSuiteUnitTest) Test_ReplayVerification_NonDeterminism() {
+	executions := 0
+	workflowFn := func(ctx Context) error {
+		executions++
+		if executions == 1 {
+			ctx = WithActivityOptions(ctx, s.activityOptions)
+			return ExecuteActivity(ctx, testActivityHello, "replay").Get(ctx, nil)
+		}
+		return Sleep(ctx, time.Minute)
+	}
+
+	env := s.NewTestWorkflowEnvironment()
+	env.SetReplayVerification(true)
+	env.RegisterWorkflow(workflowFn)
+	env.RegisterActivity(testActivityHello)
+	env.ExecuteWorkflow(workflowFn)
+
+	s.True(env.IsWorkflowCompleted())
+	s.Equal(2, executions)
+	var nonDeterminismErr *NonDeterminismError
+	s.True(errors.As(env.GetWorkflowError(), &nonDeterminismErr))
+}
+
+func (s *WorkflowTestSuiteUnitTest) Test_GetHistory() {
+	childWorkflowFn := func(ctx Context) error {
+		return nil
+	}
+	workflowFn := func(ctx Context) (string, error) {
+		var signal string
+		GetSignalChannel(ctx, "signal").Receive(ctx, &signal)
+		if err := Sleep(ctx, time.Minute); err != nil {
+			return "", err
+		}
+		var name string
+		if err := SideEffect(ctx, func(ctx Context) interface{} { return signal }).Get(&name); err != nil {
+			return "", err
+		}
+		ctx = WithChildWorkflowOptions(ctx, ChildWorkflowOptions{WorkflowRunTimeout: time.Minute})
+		if err := ExecuteChildWorkflow(ctx, childWorkflowFn).Get(ctx, nil); err != nil {
+			return "", err
+		}
+		ctx = WithActivityOptions(ctx, s.activityOptions)
+		var result string
+		err := ExecuteActivity(ctx, testActivityHello, name).Get(ctx, &result)
+		return result, err
+	}
+
+	env := s.NewTestWorkflowEnvironment()
+	_, err := env.GetHistory()
+	s.Error(err)
+	env.SetHistoryRecording(true)
+	history, err := env.GetHistory()
+	s.NoError(err)
+	s.Nil(history)
+	env.RegisterWorkflow(workflowFn)
+	env.RegisterWorkflow(childWorkflowFn)
+	env.RegisterActivity(testActivityHello)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("signal", "history")
+	}, time.Second)
+	env.ExecuteWorkflow(workflowFn)
+	s.NoError(env.GetWorkflowError())
+
+	history, err = env.GetHistory()
+	s.NoError(err)
+	var eventTypes []enumspb.EventType
+	for i, event := range history.Events {
+		s.Equal(int64(i+1), event.GetEventId())
+		eventTypes = append(eventTypes, event.GetEventType())
+	}
+	s.Equal([]enumspb.EventType{
+		enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_STARTED,
+		enumspb.EVENT_TYPE_WORKFLOW_TASK_SCHEDULED,
+		enumspb.EVENT_TYPE_WORKFLOW_TASK_STARTED,
+		enumspb.EVENT_TYPE_WORKFLOW_TASK_COMPLETED,
+		enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_SIGNALED,
+		enumspb.EVENT_TYPE_WORKFLOW_TASK_SCHEDULED,
+		enumspb.EVENT_TYPE_WORKFLOW_TASK_STARTED,
+		enumspb.EVENT_TYPE_WORKFLOW_TASK_COMPLETED,
+		enumspb.EVENT_TYPE_TIMER_STARTED,
+		enumspb.EVENT_TYPE_TIMER_FIRED,
+		enumspb.EVENT_TYPE_WORKFLOW_TASK_SCHEDULED,
+		enumspb.EVENT_TYPE_WORKFLOW_TASK_STARTED,
+		enumspb.EVENT_TYPE_WORKFLOW_TASK_COMPLETED,
+		enumspb.EVENT_TYPE_MARKER_RECORDED,
+		enumspb.EVENT_TYPE_START_CHILD_WORKFLOW_EXECUTION_INITIATED,
+		enumspb.EVENT_TYPE_CHILD_WORKFLOW_EXECUTION_STARTED,
+		enumspb.EVENT_TYPE_WORKFLOW_TASK_SCHEDULED,
+		enumspb.EVENT_TYPE_WORKFLOW_TASK_STARTED,
+		enumspb.EVENT_TYPE_WORKFLOW_TASK_COMPLETED,
+		enumspb.EVENT_TYPE_CHILD_WORKFLOW_EXECUTION_COMPLETED,
+		enumspb.EVENT_TYPE_WORKFLOW_TASK_SCHEDULED,
+		enumspb.EVENT_TYPE_WORKFLOW_TASK_STARTED,
+		enumspb.EVENT_TYPE_WORKFLOW_TASK_COMPLETED,
+		enumspb.EVENT_TYPE_ACTIVITY_TASK_SCHEDULED,
+		enumspb.EVENT_TYPE_ACTIVITY_TASK_STARTED,
+		enumspb.EVENT_TYPE_ACTIVITY_TASK_COMPLETED,
+		enumspb.EVENT_TYPE_WORKFLOW_TASK_SCHEDULED,
+		enumspb.EVENT_TYPE_WORKFLOW_TASK_STARTED,
+		enumspb.EVENT_TYPE_WORKFLOW_TASK_COMPLETED,
+		enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_COMPLETED,
+	}, eventTypes)
+
+	replayer := NewWorkflowReplayer()
+	replayer.RegisterWorkflow(workflowFn)
+	replayer.RegisterWorkflow(childWorkflowFn)
+	s.NoError(replayer.ReplayWorkflowHistory(nil, history))
+}
+
+func (s *WorkflowTestSuiteUnitTest) Test_GetHistory_NotRecorded() {
+	workflowFn := func(ctx Context) error {
+		return Sleep(ctx, time.Minute)
+	}
+
+	env := s.NewTestWorkflowEnvironment()
+	env.RegisterWorkflow(workflowFn)
+	env.ExecuteWorkflow(workflowFn)
+	s.NoError(env.GetWorkflowError())
+
+	s.Nil(env.impl.historyRecorder)
+	history, err := env.GetHistory()
+	s.Error(err)
+	s.Nil(history)
+}
+
+// testUndecodableValue can be encoded but not decoded by the json payload converter.
+type testUndecodableValue struct{}
+
+func (*testUndecodableValue) UnmarshalJSON([]byte) error {
+	return errors.New("undecodable value")
+}
+
+func (s *WorkflowTestSuiteUnitTest) Test_GetHistory_RecordingFailure() {
+	workflowFn := func(ctx Context) error {
+		for i := 0; i < 2; i++ {
+			MutableSideEffect(ctx, "id", func(ctx Context) interface{} {
+				return testUndecodableValue{}
+			}, func(a, b interface{}) bool { return false })
+		}
+		return nil
+	}
+
+	env := s.NewTestWorkflowEnvironment()
+	env.SetReplayVerification(true)
+	env.RegisterWorkflow(workflowFn)
+	env.ExecuteWorkflow(workflowFn)
+
+	s.True(env.IsWorkflowCompleted())
+	s.Error(env.GetWorkflowError())
+	s.Contains(env.GetWorkflowError().Error(), "undecodable value")
+	history, err := env.GetHistory()
+	s.Error(err)
+	s.Nil(history)
+}
+
+func (s *WorkflowTestSuiteUnitTest) Test_ContinueAsNewChaining() {
+	var runIDs []string
+	var workflowFn func(ctx Context, total int) (int, error)
+	workflowFn = func(ctx Context, total int) (int, error) {
+		runIDs = append(runIDs, GetWorkflowInfo(ctx).WorkflowExecution.RunID)
+		var value int
+		GetSignalChannel(ctx, "add").Receive(ctx, &value)
+		total += value
+		if value > 0 {
+			return 0, NewContinueAsNewError(ctx, workflowFn, total)
+		}
+		return total, nil
+	}
+
+	env := s.NewTestWorkflowEnvironment()
+	env.SetContinueAsNewChaining(10)
+	env.SetHistoryRecording(true)
+	env.RegisterWorkflow(workflowFn)
+	for i, value := range []int{1, 2, 3, 0} {
+		value := value
+		env.RegisterDelayedCallback(func() {
+			env.SignalWorkflow("add", value)
+		}, time.Duration(i+1)*time.Minute)
+	}
+	env.ExecuteWorkflow(workflowFn, 0)
+
+	s.True(env.IsWorkflowCompleted())
+	s.NoError(env.GetWorkflowError())
+	var total int
+	s.NoError(env.GetWorkflowResult(&total))
+	s.Equal(6, total)
+
+	s.Equal([]string{
+		defaultTestRunID,
+		defaultTestRunID + "_continued_1",
+		defaultTestRunID + "_continued_2",
+		defaultTestRunID + "_continued_3",
+	}, runIDs)
+	runs := env.GetWorkflowRuns()
+	s.Len(runs, 4)
+	for i, run := range runs {
+		s.Equal(runIDs[i], run.GetRunID())
+		if i < len(runs)-1 {
+			var continueAsNewErr *ContinueAsNewError
+			s.True(errors.As(run.GetWorkflowError(), &continueAsNewErr))
+		}
+	}
+	s.NoError(runs[3].GetWorkflowResult(&total))
+	s.Equal(6, total)
+	history, err := env.GetHistory()
+	s.NoError(err)
+	s.Equal(runIDs[2], history.Events[0].GetWorkflowExecutionStartedEventAttributes().GetContinuedExecutionRunId())
+}
+
+func (s *WorkflowTestSuiteUnitTest) Test_ContinueAsNewChaining_PendingLocalActivity() {
+	var runs int
+	var workflowFn func(ctx Context) (int, error)
+	workflowFn = func(ctx Context) (int, error) {
+		runs++
+		if runs > 1 {
+			return runs, nil
+		}
+		ctx = WithLocalActivityOptions(ctx, LocalActivityOptions{ScheduleToCloseTimeout: time.Minute})
+		ExecuteLocalActivity(ctx, func() error {
+			time.Sleep(100 * time.Millisecond)
+			return nil
+		})
+		return 0, NewContinueAsNewError(ctx, workflowFn)
+	}
+
+	env := s.NewTestWorkflowEnvironment()
+	env.SetContinueAsNewChaining(3)
+	env.RegisterWorkflow(workflowFn)
+	env.ExecuteWorkflow(workflowFn)
+
+	s.True(env.IsWorkflowCompleted())
+	s.NoError(env.GetWorkflowError())
+	s.Len(env.GetWorkflowRuns(), 2)
+	s.Empty(env.impl.localActivities)
+}
+
+func (s *WorkflowTestSuiteUnitTest) Test_ContinueAsNewChaining_MaxRuns() {
+	var workflowFn func(ctx Context, count int) error
+	workflowFn = func(ctx Context, count int) error {
+		if err := Sleep(ctx, time.Hour); err != nil {
+			return err
+		}
+		return NewContinueAsNewError(ctx, workflowFn, count+1)
+	}
+
+	env := s.NewTestWorkflowEnvironment()
+	env.SetContinueAsNewChaining(3)
+	env.SetReplayVerification(true)
+	env.RegisterWorkflow(workflowFn)
+	env.ExecuteWorkflow(workflowFn, 0)
+
+	s.True(env.IsWorkflowCompleted())
+	s.Len(env.GetWorkflowRuns(), 3)
+	var continueAsNewErr *ContinueAsNewError
+	s.True(errors.As(env.GetWorkflowError(), &continueAsNewErr))
+	var count int
+	s.NoError(env.impl.GetDataConverter().FromPayloads(continueAsNewErr.Input, &count))
+	s.Equal(3, count)
+}
+
+func (s *WorkflowTestSuiteUnitTest) Test_ExternalWorkflowRouting_Signal() {
+	pongWorkflowFn := func(ctx Context) (string, error) {
+		var from string
+		GetSignalChannel(ctx, "ping").Receive(ctx, &from)
+		err := SignalExternalWorkflow(ctx, from, "", "pong", "pong").Get(ctx, nil)
+		return from, err
+	}
+	pingWorkflowFn := func(ctx Context) (string, error) {
+		err := SignalExternalWorkflow(ctx, "pong-id", "", "ping", GetWorkflowInfo(ctx).WorkflowExecution.ID).Get(ctx, nil)
+		if err != nil {
+			return "", err
+		}
+		var pong string
+		GetSignalChannel(ctx, "pong").Receive(ctx, &pong)
+
+		err = SignalExternalWorkflow(ctx, "unknown-id", "", "ping", "").Get(ctx, nil)
+		var unknownErr *UnknownExternalWorkflowExecutionError
+		s.True(errors.As(err, &unknownErr))
+		return pong, nil
+	}
+
+	env := s.NewTestWorkflowEnvironment()
+	env.SetExternalWorkflowRouting(true)
+	env.SetReplayVerification(true)
+	env.RegisterWorkflow(pongWorkflowFn)
+	env.StartWorkflow(StartWorkflowOptions{ID: "pong-id"}, pongWorkflowFn)
+	env.ExecuteWorkflow(pingWorkflowFn)
+
+	s.True(env.IsWorkflowCompleted())
+	s.NoError(env.GetWorkflowError())
+	var result string
+	s.NoError(env.GetWorkflowResult(&result))
+	s.Equal("pong", result)
+	s.NoError(env.GetWorkflowResultByID("pong-id", &result))
+	s.Equal(defaultTestWorkflowID, result)
+}
+
+func (s *WorkflowTestSuiteUnitTest) Test_ExternalWorkflowRouting_ResultNotRecorded() {
+	workflowFn := func(ctx Context) error {
+		// without history recording results are delivered immediately, same as for the mocked commands
+		signalFuture := SignalExternalWorkflow(ctx, "unknown-id", "", "ping", "")
+		cancelFuture := RequestCancelExternalWorkflow(ctx, "unknown-id", "")
+		s.True(signalFuture.IsReady())
+		s.True(cancelFuture.IsReady())
+		return nil
+	}
+
+	env := s.NewTestWorkflowEnvironment()
+	env.SetExternalWorkflowRouting(true)
+	env.ExecuteWorkflow(workflowFn)
+
+	s.True(env.IsWorkflowCompleted())
+	s.NoError(env.GetWorkflowError())
+}
+
+func (s *WorkflowTestSuiteUnitTest) Test_ExternalWorkflowRouting_Cancel() {
+	childWorkflowFn := func(ctx Context) error {
+		// cancel the parent, which then cancels this child
+		info := GetWorkflowInfo(ctx)
+		err := RequestCancelExternalWorkflow(ctx, info.ParentWorkflowExecution.ID, info.ParentWorkflowExecution.RunID).Get(ctx, nil)
+		if err != nil {
+			return err
+		}
+		return Sleep(ctx, time.Hour)
+	}
+	sleepingWorkflowFn := func(ctx Context) error {
+		return Sleep(ctx, time.Hour)
+	}
+	workflowFn := func(ctx Context) error {
+		if err := RequestCancelExternalWorkflow(ctx, "sleeping-id", "").Get(ctx, nil); err != nil {
+			return err
+		}
+		ctx = WithChildWorkflowOptions(ctx, ChildWorkflowOptions{WaitForCancellation: true})
+		return ExecuteChildWorkflow(ctx, childWorkflowFn).Get(ctx, nil)
+	}
+
+	env := s.NewTestWorkflowEnvironment()
+	env.SetExternalWorkflowRouting(true)
+	env.RegisterWorkflow(childWorkflowFn)
+	env.RegisterWorkflow(sleepingWorkflowFn)
+	env.StartWorkflow(StartWorkflowOptions{ID: "sleeping-id"}, sleepingWorkflowFn)
+	env.ExecuteWorkflow(workflowFn)
+
+	s.True(env.IsWorkflowCompleted())
+	s.True(IsCanceledError(env.GetWorkflowError()))
+	s.True(IsCanceledError(env.GetWorkflowErrorByID("sleeping-id")))
+}
+
+func (s *WorkflowTestSuiteUnitTest) Test_ChaosMode() {
+	activityFn := func(ctx context.Context, name string) (string, error) {
+		return "hello " + name, nil
+	}
+	workflowFn := func(ctx Context) (string, error) {
+		ctx = WithActivityOptions(ctx, ActivityOptions{
+			StartToCloseTimeout: time.Minute,
+			HeartbeatTimeout:    time.Second,
+			RetryPolicy:         &RetryPolicy{InitialInterval: time.Second},
+		})
+		var signals []string
+		var result string
+		for i := 0; i < 3; i++ {
+			var greeting string
+			if err := ExecuteActivity(ctx, activityFn, fmt.Sprintf("activity %v", i)).Get(ctx, &greeting); err != nil {
+				return "", err
+			}
+			result += greeting + ";"
+			if err := Sleep(ctx, time.Minute); err != nil {
+				return "", err
+			}
+		}
+		// signals are idempotent per value, so duplicated deliveries do not change the result
+		ch := GetSignalChannel(ctx, "signal")
+		for len(signals) < 2 {
+			var signal string
+			ch.Receive(ctx, &signal)
+			if len(signals) == 0 || signals[len(signals)-1] != signal {
+				signals = append(signals, signal)
+			}
+		}
+		return result + fmt.Sprint(signals), nil
+	}
+	setup := func(env *TestWorkflowEnvironment) {
+		env.RegisterActivity(activityFn)
+		env.RegisterDelayedCallback(func() {
+			env.SignalWorkflow("signal", "a")
+		}, time.Hour)
+		env.RegisterDelayedCallback(func() {
+			env.SignalWorkflow("signal", "b")
+		}, 2*time.Hour)
+	}
+	options := TestChaosOptions{
+		ActivityFailureProbability:  0.5,
+		HeartbeatTimeoutProbability: 0.5,
+		ActivityDelayProbability:    0.5,
+		DuplicateSignalProbability:  0.5,
+		EvictionProbability:         0.5,
+	}
+	for seed := int64(0); seed < 10; seed++ {
+		options.Seed = seed
+		s.True(s.AssertChaosResult(s.T(), options, setup, workflowFn))
+	}
+
+	// same seed injects the same faults
+	var attempts [2]atomic.Int32
+	for i := range attempts {
+		env := s.NewTestWorkflowEnvironment()
+		options.Seed = 42
+		env.SetChaosOptions(options)
+		setup(env)
+		counter := &attempts[i]
+		env.SetOnActivityStartedListener(func(*ActivityInfo, context.Context, converter.EncodedValues) {
+			counter.Inc()
+		})
+		env.ExecuteWorkflow(workflowFn)
+		s.NoError(env.GetWorkflowError())
+	}
+	s.Equal(attempts[0].Load(), attempts[1].Load())
+}
+
+func (s *WorkflowTestSuiteUnitTest) Test_ChaosMode_Eviction() {
+	var executions atomic.Int32
+	workflowFn := func(ctx Context) (string, error) {
+		instance := executions.Inc()
+		err := SetQueryHandler(ctx, "instance", func() (int32, error) {
+			return instance, nil
+		})
+		if err != nil {
+			return "", err
+		}
+		version := GetVersion(ctx, "change", DefaultVersion, 1)
+		var sideEffect int32
+		if err := SideEffect(ctx, func(Context) interface{} { return executions.Load() }).Get(&sideEffect); err != nil {
+			return "", err
+		}
+		ctx = WithActivityOptions(ctx, ActivityOptions{StartToCloseTimeout: time.Minute})
+		var greeting string
+		if err := ExecuteActivity(ctx, testActivityHello, "chaos").Get(ctx, &greeting); err != nil {
+			return "", err
+		}
+		timerCtx, cancel := WithCancel(ctx)
+		timer := NewTimer(timerCtx, time.Hour)
+		var signal string
+		GetSignalChannel(ctx, "signal").Receive(ctx, &signal)
+		cancel()
+		if err := timer.Get(ctx, nil); !IsCanceledError(err) {
+			return "", fmt.Errorf("timer not canceled: %v", err)
+		}
+		if err := Sleep(ctx, time.Minute); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%v %v %v %v %v", version, sideEffect, greeting, signal, instance), nil
+	}
+
+	env := s.NewTestWorkflowEnvironment()
+	env.RegisterActivity(testActivityHello)
+	env.SetChaosOptions(TestChaosOptions{EvictionProbability: 1})
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("signal", "s")
+	}, 30*time.Minute)
+	env.ExecuteWorkflow(workflowFn)
+
+	s.True(env.IsWorkflowCompleted())
+	s.NoError(env.GetWorkflowError())
+	// the workflow was completed by the last instance that replaced an evicted one, side effect, version, activity
+	// and signal were taken over from the first instance
+	last := executions.Load()
+	s.Greater(last, int32(2))
+	var result string
+	s.NoError(env.GetWorkflowResult(&result))
+	s.Equal(fmt.Sprintf("1 1 hello_chaos s %v", last), result)
+	value, err := env.QueryWorkflow("instance")
+	s.NoError(err)
+	var instance int32
+	s.NoError(value.Get(&instance))
+	s.Equal(last, instance)
+}
+
+func (s *WorkflowTestSuiteUnitTest) Test_ChaosMode_Eviction_NonDeterminism() {
+	var executions atomic.Int32
+	workflowFn := func(ctx Context) error {
+		// bad workflow: sleeps in the first execution, executes an activity when replayed
+		if executions.Inc() == 1 {
+			if err := Sleep(ctx, time.Minute); err != nil {
+				return err
+			}
+		} else {
+			ctx = WithActivityOptions(ctx, ActivityOptions{StartToCloseTimeout: time.Minute})
+			if err := ExecuteActivity(ctx, testActivityHello, "chaos").Get(ctx, nil); err != nil {
+				return err
+			}
+		}
+		return Sleep(ctx, time.Hour)
+	}
+
+	env := s.NewTestWorkflowEnvironment()
+	env.RegisterActivity(testActivityHello)
+	env.SetChaosOptions(TestChaosOptions{EvictionProbability: 1})
+	env.ExecuteWorkflow(workflowFn)
+
+	s.True(env.IsWorkflowCompleted())
+	s.Error(env.GetWorkflowError())
+	s.Contains(env.GetWorkflowError().Error(), "nondeterministic")
+}
@@ -0,0 +1,104 @@
+// The MIT License
+//
+// Copyright (c) 2020 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package internal
+
+type (
+	// SagaOptions configures compensation of the steps recorded by Saga.
+	SagaOptions struct {
+		// ParallelCompensation - optional: run all compensations at the same time instead of one at a time
+		// in the reverse order they were added.
+		ParallelCompensation bool
+
+		// ContinueWithError - optional: keep running the remaining compensations when a compensation fails.
+		// By default sequential compensation stops at the first failure. All compensations are always
+		// started when ParallelCompensation is set.
+		ContinueWithError bool
+	}
+
+	// Saga records compensations of successfully completed steps of a workflow and runs them if a later step
+	// fails or the workflow is canceled. Use NewSaga to create a Saga.
+	Saga struct {
+		options       SagaOptions
+		compensations []*sagaCompensation
+	}
+
+	sagaCompensation struct {
+		activity interface{}
+		args     []interface{}
+	}
+)
+
+// NewSaga creates a new Saga.
+func NewSaga(options SagaOptions) *Saga {
+	return &Saga{options: options}
+}
+
+// AddCompensation records the activity that undoes a completed step. Activity is executed with the
+// activity options of the context passed to Compensate.
+func (s *Saga) AddCompensation(activity interface{}, args ...interface{}) {
+	s.compensations = append(s.compensations, &sagaCompensation{activity: activity, args: args})
+}
+
+// Compensate runs the recorded compensations in the reverse order they were added and clears them. The
+// compensations run in a context disconnected from ctx, so they are executed even when ctx is canceled.
+// Returns the first compensation error.
+func (s *Saga) Compensate(ctx Context) error {
+	ctx, _ = NewDisconnectedContext(ctx)
+	compensations := s.compensations
+	s.compensations = nil
+
+	if s.options.ParallelCompensation {
+		var futures []Future
+		for i := len(compensations) - 1; i >= 0; i-- {
+			futures = append(futures, compensations[i].execute(ctx))
+		}
+		var firstErr error
+		for _, future := range futures {
+			if err := future.Get(ctx, nil); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		return firstErr
+	}
+
+	var firstErr error
+	for i := len(compensations) - 1; i >= 0; i-- {
+		err := compensations[i].execute(ctx).Get(ctx, nil)
+		if err == nil {
+			continue
+		}
+		if !s.options.ContinueWithError {
+			return err
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (c *sagaCompensation) execute(ctx Context) Future {
+	return ExecuteActivity(ctx, c.activity, c.args...)
+}
@@ -0,0 +1,141 @@
+// The MIT License
+//
+// Copyright (c) 2020 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package internal
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type sagaTestActivities struct {
+	compensated []string
+	failing     map[string]bool
+}
+
+func (a *sagaTestActivities) Step(_ context.Context, name string) error {
+	if a.failing[name] {
+		return errors.New(name + " failed")
+	}
+	return nil
+}
+
+func (a *sagaTestActivities) Undo(_ context.Context, name string) error {
+	a.compensated = append(a.compensated, name)
+	if a.failing["undo-"+name] {
+		return errors.New("undo " + name + " failed")
+	}
+	return nil
+}
+
+func sagaTestWorkflow(ctx Context, options SagaOptions, steps []string) error {
+	ctx = WithActivityOptions(ctx, ActivityOptions{StartToCloseTimeout: time.Minute, RetryPolicy: &RetryPolicy{MaximumAttempts: 1}})
+	var a *sagaTestActivities
+	saga := NewSaga(options)
+	for _, step := range steps {
+		if err := ExecuteActivity(ctx, a.Step, step).Get(ctx, nil); err != nil {
+			if compensateErr := saga.Compensate(ctx); compensateErr != nil {
+				return compensateErr
+			}
+			return err
+		}
+		saga.AddCompensation(a.Undo, step)
+	}
+	return nil
+}
+
+func runSagaTestWorkflow(t *testing.T, activities *sagaTestActivities, options SagaOptions, steps []string) error {
+	var s WorkflowTestSuite
+	env := s.NewTestWorkflowEnvironment()
+	env.RegisterWorkflow(sagaTestWorkflow)
+	env.RegisterActivity(activities)
+	env.ExecuteWorkflow(sagaTestWorkflow, options, steps)
+	require.True(t, env.IsWorkflowCompleted())
+	return env.GetWorkflowError()
+}
+
+func TestSaga_CompensateInReverseOrder(t *testing.T) {
+	activities := &sagaTestActivities{failing: map[string]bool{"c": true}}
+	err := runSagaTestWorkflow(t, activities, SagaOptions{}, []string{"a", "b", "c"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "c failed")
+	require.Equal(t, []string{"b", "a"}, activities.compensated)
+}
+
+func TestSaga_StopOnCompensationError(t *testing.T) {
+	activities := &sagaTestActivities{failing: map[string]bool{"c": true, "undo-b": true}}
+	err := runSagaTestWorkflow(t, activities, SagaOptions{}, []string{"a", "b", "c"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "undo b failed")
+	require.Equal(t, []string{"b"}, activities.compensated)
+}
+
+func TestSaga_ContinueWithError(t *testing.T) {
+	activities := &sagaTestActivities{failing: map[string]bool{"c": true, "undo-b": true}}
+	err := runSagaTestWorkflow(t, activities, SagaOptions{ContinueWithError: true}, []string{"a", "b", "c"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "undo b failed")
+	require.Equal(t, []string{"b", "a"}, activities.compensated)
+}
+
+func TestSaga_ParallelCompensation(t *testing.T) {
+	activities := &sagaTestActivities{failing: map[string]bool{"d": true, "undo-b": true}}
+	err := runSagaTestWorkflow(t, activities, SagaOptions{ParallelCompensation: true}, []string{"a", "b", "c", "d"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "undo b failed")
+	require.ElementsMatch(t, []string{"a", "b", "c"}, activities.compensated)
+}
+
+func TestSaga_CompensateOnCancellation(t *testing.T) {
+	activities := &sagaTestActivities{}
+	var s WorkflowTestSuite
+	env := s.NewTestWorkflowEnvironment()
+	env.RegisterActivity(activities)
+	wf := func(ctx Context) error {
+		ctx = WithActivityOptions(ctx, ActivityOptions{StartToCloseTimeout: time.Minute})
+		saga := NewSaga(SagaOptions{})
+		if err := ExecuteActivity(ctx, activities.Step, "a").Get(ctx, nil); err != nil {
+			return err
+		}
+		saga.AddCompensation(activities.Undo, "a")
+		if err := Sleep(ctx, time.Hour); err != nil {
+			if compensateErr := saga.Compensate(ctx); compensateErr != nil {
+				return compensateErr
+			}
+			return err
+		}
+		return nil
+	}
+	env.RegisterWorkflow(wf)
+	env.RegisterDelayedCallback(env.CancelWorkflow, time.Minute)
+	env.ExecuteWorkflow(wf)
+	require.True(t, env.IsWorkflowCompleted())
+	var canceledErr *CanceledError
+	require.True(t, errors.As(env.GetWorkflowError(), &canceledErr))
+	require.Equal(t, []string{"a"}, activities.compensated)
+}
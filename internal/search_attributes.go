@@ -0,0 +1,348 @@
+// The MIT License
+//
+// Copyright (c) 2020 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	commonpb "go.temporal.io/api/common/v1"
+	enumspb "go.temporal.io/api/enums/v1"
+
+	"go.temporal.io/sdk/converter"
+)
+
+type (
+	// SearchAttributeKey is implemented by all typed search attribute keys.
+	SearchAttributeKey interface {
+		// GetName returns the name of the search attribute.
+		GetName() string
+		// GetValueType returns the indexed value type of the search attribute.
+		GetValueType() enumspb.IndexedValueType
+	}
+
+	// SearchAttributeKeyString is a key for a text search attribute.
+	SearchAttributeKeyString struct {
+		name string
+	}
+
+	// SearchAttributeKeyKeyword is a key for a keyword search attribute.
+	SearchAttributeKeyKeyword struct {
+		name string
+	}
+
+	// SearchAttributeKeyKeywordList is a key for a keyword search attribute holding a list of values.
+	SearchAttributeKeyKeywordList struct {
+		name string
+	}
+
+	// SearchAttributeKeyInt64 is a key for an int search attribute.
+	SearchAttributeKeyInt64 struct {
+		name string
+	}
+
+	// SearchAttributeKeyFloat64 is a key for a double search attribute.
+	SearchAttributeKeyFloat64 struct {
+		name string
+	}
+
+	// SearchAttributeKeyBool is a key for a bool search attribute.
+	SearchAttributeKeyBool struct {
+		name string
+	}
+
+	// SearchAttributeKeyTime is a key for a datetime search attribute.
+	SearchAttributeKeyTime struct {
+		name string
+	}
+
+	// SearchAttributeUpdate is a typed search attribute value created by one of the typed keys' ValueSet methods.
+	// It is used in StartWorkflowOptions.TypedSearchAttributes, ChildWorkflowOptions.TypedSearchAttributes and
+	// UpsertTypedSearchAttributes.
+	SearchAttributeUpdate struct {
+		key   SearchAttributeKey
+		value interface{}
+	}
+
+	// SearchAttributes is a read-only view of search attributes which decodes values with typed keys.
+	SearchAttributes struct {
+		payloads map[string]*commonpb.Payload
+	}
+)
+
+// NewSearchAttributeKeyString creates a key for a text search attribute.
+func NewSearchAttributeKeyString(name string) SearchAttributeKeyString {
+	return SearchAttributeKeyString{name: name}
+}
+
+// GetName returns the name of the search attribute.
+func (k SearchAttributeKeyString) GetName() string { return k.name }
+
+// GetValueType returns INDEXED_VALUE_TYPE_STRING.
+func (k SearchAttributeKeyString) GetValueType() enumspb.IndexedValueType {
+	return enumspb.INDEXED_VALUE_TYPE_STRING
+}
+
+// ValueSet creates an update which sets the search attribute to value.
+func (k SearchAttributeKeyString) ValueSet(value string) SearchAttributeUpdate {
+	return SearchAttributeUpdate{key: k, value: value}
+}
+
+// NewSearchAttributeKeyKeyword creates a key for a keyword search attribute.
+func NewSearchAttributeKeyKeyword(name string) SearchAttributeKeyKeyword {
+	return SearchAttributeKeyKeyword{name: name}
+}
+
+// GetName returns the name of the search attribute.
+func (k SearchAttributeKeyKeyword) GetName() string { return k.name }
+
+// GetValueType returns INDEXED_VALUE_TYPE_KEYWORD.
+func (k SearchAttributeKeyKeyword) GetValueType() enumspb.IndexedValueType {
+	return enumspb.INDEXED_VALUE_TYPE_KEYWORD
+}
+
+// ValueSet creates an update which sets the search attribute to value.
+func (k SearchAttributeKeyKeyword) ValueSet(value string) SearchAttributeUpdate {
+	return SearchAttributeUpdate{key: k, value: value}
+}
+
+// NewSearchAttributeKeyKeywordList creates a key for a keyword search attribute holding a list of values.
+func NewSearchAttributeKeyKeywordList(name string) SearchAttributeKeyKeywordList {
+	return SearchAttributeKeyKeywordList{name: name}
+}
+
+// GetName returns the name of the search attribute.
+func (k SearchAttributeKeyKeywordList) GetName() string { return k.name }
+
+// GetValueType returns INDEXED_VALUE_TYPE_KEYWORD.
+func (k SearchAttributeKeyKeywordList) GetValueType() enumspb.IndexedValueType {
+	return enumspb.INDEXED_VALUE_TYPE_KEYWORD
+}
+
+// ValueSet creates an update which sets the search attribute to values.
+func (k SearchAttributeKeyKeywordList) ValueSet(values []string) SearchAttributeUpdate {
+	return SearchAttributeUpdate{key: k, value: append([]string(nil), values...)}
+}
+
+// NewSearchAttributeKeyInt64 creates a key for an int search attribute.
+func NewSearchAttributeKeyInt64(name string) SearchAttributeKeyInt64 {
+	return SearchAttributeKeyInt64{name: name}
+}
+
+// GetName returns the name of the search attribute.
+func (k SearchAttributeKeyInt64) GetName() string { return k.name }
+
+// GetValueType returns INDEXED_VALUE_TYPE_INT.
+func (k SearchAttributeKeyInt64) GetValueType() enumspb.IndexedValueType {
+	return enumspb.INDEXED_VALUE_TYPE_INT
+}
+
+// ValueSet creates an update which sets the search attribute to value.
+func (k SearchAttributeKeyInt64) ValueSet(value int64) SearchAttributeUpdate {
+	return SearchAttributeUpdate{key: k, value: value}
+}
+
+// NewSearchAttributeKeyFloat64 creates a key for a double search attribute.
+func NewSearchAttributeKeyFloat64(name string) SearchAttributeKeyFloat64 {
+	return SearchAttributeKeyFloat64{name: name}
+}
+
+// GetName returns the name of the search attribute.
+func (k SearchAttributeKeyFloat64) GetName() string { return k.name }
+
+// GetValueType returns INDEXED_VALUE_TYPE_DOUBLE.
+func (k SearchAttributeKeyFloat64) GetValueType() enumspb.IndexedValueType {
+	return enumspb.INDEXED_VALUE_TYPE_DOUBLE
+}
+
+// ValueSet creates an update which sets the search attribute to value.
+func (k SearchAttributeKeyFloat64) ValueSet(value float64) SearchAttributeUpdate {
+	return SearchAttributeUpdate{key: k, value: value}
+}
+
+// NewSearchAttributeKeyBool creates a key for a bool search attribute.
+func NewSearchAttributeKeyBool(name string) SearchAttributeKeyBool {
+	return SearchAttributeKeyBool{name: name}
+}
+
+// GetName returns the name of the search attribute.
+func (k SearchAttributeKeyBool) GetName() string { return k.name }
+
+// GetValueType returns INDEXED_VALUE_TYPE_BOOL.
+func (k SearchAttributeKeyBool) GetValueType() enumspb.IndexedValueType {
+	return enumspb.INDEXED_VALUE_TYPE_BOOL
+}
+
+// ValueSet creates an update which sets the search attribute to value.
+func (k SearchAttributeKeyBool) ValueSet(value bool) SearchAttributeUpdate {
+	return SearchAttributeUpdate{key: k, value: value}
+}
+
+// NewSearchAttributeKeyTime creates a key for a datetime search attribute.
+func NewSearchAttributeKeyTime(name string) SearchAttributeKeyTime {
+	return SearchAttributeKeyTime{name: name}
+}
+
+// GetName returns the name of the search attribute.
+func (k SearchAttributeKeyTime) GetName() string { return k.name }
+
+// GetValueType returns INDEXED_VALUE_TYPE_DATETIME.
+func (k SearchAttributeKeyTime) GetValueType() enumspb.IndexedValueType {
+	return enumspb.INDEXED_VALUE_TYPE_DATETIME
+}
+
+// ValueSet creates an update which sets the search attribute to value.
+func (k SearchAttributeKeyTime) ValueSet(value time.Time) SearchAttributeUpdate {
+	return SearchAttributeUpdate{key: k, value: value.UTC()}
+}
+
+// GetKey returns the key of the updated search attribute.
+func (u SearchAttributeUpdate) GetKey() SearchAttributeKey {
+	return u.key
+}
+
+// NewSearchAttributesFromProto creates a read-only view of the given search attributes.
+func NewSearchAttributesFromProto(attributes *commonpb.SearchAttributes) SearchAttributes {
+	payloads := make(map[string]*commonpb.Payload, len(attributes.GetIndexedFields()))
+	for k, v := range attributes.GetIndexedFields() {
+		payloads[k] = v
+	}
+	return SearchAttributes{payloads: payloads}
+}
+
+// Size returns the number of search attributes.
+func (s SearchAttributes) Size() int {
+	return len(s.payloads)
+}
+
+// ContainsKey returns whether the search attribute with the key name is set.
+func (s SearchAttributes) ContainsKey(key SearchAttributeKey) bool {
+	_, ok := s.payloads[key.GetName()]
+	return ok
+}
+
+// GetString returns the value of the text search attribute and whether it is set and has the expected type.
+func (s SearchAttributes) GetString(key SearchAttributeKeyString) (string, bool) {
+	var value string
+	return value, s.decode(key, &value)
+}
+
+// GetKeyword returns the value of the keyword search attribute and whether it is set and has the expected type.
+func (s SearchAttributes) GetKeyword(key SearchAttributeKeyKeyword) (string, bool) {
+	var value string
+	return value, s.decode(key, &value)
+}
+
+// GetKeywordList returns the values of the keyword list search attribute and whether it is set and has the expected type.
+func (s SearchAttributes) GetKeywordList(key SearchAttributeKeyKeywordList) ([]string, bool) {
+	var value []string
+	return value, s.decode(key, &value)
+}
+
+// GetInt64 returns the value of the int search attribute and whether it is set and has the expected type.
+func (s SearchAttributes) GetInt64(key SearchAttributeKeyInt64) (int64, bool) {
+	var value int64
+	return value, s.decode(key, &value)
+}
+
+// GetFloat64 returns the value of the double search attribute and whether it is set and has the expected type.
+func (s SearchAttributes) GetFloat64(key SearchAttributeKeyFloat64) (float64, bool) {
+	var value float64
+	return value, s.decode(key, &value)
+}
+
+// GetBool returns the value of the bool search attribute and whether it is set and has the expected type.
+func (s SearchAttributes) GetBool(key SearchAttributeKeyBool) (bool, bool) {
+	var value bool
+	return value, s.decode(key, &value)
+}
+
+// GetTime returns the value of the datetime search attribute and whether it is set and has the expected type.
+func (s SearchAttributes) GetTime(key SearchAttributeKeyTime) (time.Time, bool) {
+	var value time.Time
+	return value, s.decode(key, &value)
+}
+
+func (s SearchAttributes) decode(key SearchAttributeKey, valuePtr interface{}) bool {
+	payload, ok := s.payloads[key.GetName()]
+	if !ok {
+		return false
+	}
+	// Search attributes are always encoded with the default data converter.
+	return converter.GetDefaultDataConverter().FromPayload(payload, valuePtr) == nil
+}
+
+// searchAttributeUpdatesToMap validates typed updates and converts them to untyped search attributes.
+func searchAttributeUpdatesToMap(updates []SearchAttributeUpdate) (map[string]interface{}, error) {
+	result := make(map[string]interface{}, len(updates))
+	valueTypes := make(map[string]enumspb.IndexedValueType, len(updates))
+	for _, u := range updates {
+		if u.key == nil {
+			return nil, errors.New("search attribute update is not created by a typed key")
+		}
+		name := u.key.GetName()
+		if name == "" {
+			return nil, errors.New("search attribute name is empty")
+		}
+		if name == TemporalChangeVersion {
+			return nil, errors.New("TemporalChangeVersion is a reserved key that cannot be set, please use other key")
+		}
+		if valueType, ok := valueTypes[name]; ok && valueType != u.key.GetValueType() {
+			return nil, fmt.Errorf("search attribute %q is set with conflicting types %s and %s",
+				name, valueType, u.key.GetValueType())
+		}
+		if f, ok := u.value.(float64); ok && (math.IsNaN(f) || math.IsInf(f, 0)) {
+			return nil, fmt.Errorf("search attribute %q has invalid double value %v", name, f)
+		}
+		valueTypes[name] = u.key.GetValueType()
+		result[name] = u.value
+	}
+	return result, nil
+}
+
+// mergeTypedSearchAttributes combines untyped and typed search attributes into a new map.
+// It returns nil if neither is set.
+func mergeTypedSearchAttributes(untyped map[string]interface{}, typed []SearchAttributeUpdate) (map[string]interface{}, error) {
+	if len(typed) == 0 {
+		return untyped, nil
+	}
+	typedMap, err := searchAttributeUpdatesToMap(typed)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]interface{}, len(untyped)+len(typedMap))
+	for k, v := range untyped {
+		result[k] = v
+	}
+	for k, v := range typedMap {
+		if _, ok := untyped[k]; ok {
+			return nil, fmt.Errorf("search attribute %q is set in both SearchAttributes and TypedSearchAttributes", k)
+		}
+		result[k] = v
+	}
+	return result, nil
+}
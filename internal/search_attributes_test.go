@@ -0,0 +1,135 @@
+// The MIT License
+//
+// Copyright (c) 2020 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package internal
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchAttributes_TypedRoundTrip(t *testing.T) {
+	stringKey := NewSearchAttributeKeyString("CustomStringField")
+	keywordKey := NewSearchAttributeKeyKeyword("CustomKeywordField")
+	keywordListKey := NewSearchAttributeKeyKeywordList("CustomKeywordListField")
+	intKey := NewSearchAttributeKeyInt64("CustomIntField")
+	floatKey := NewSearchAttributeKeyFloat64("CustomDoubleField")
+	boolKey := NewSearchAttributeKeyBool("CustomBoolField")
+	timeKey := NewSearchAttributeKeyTime("CustomDatetimeField")
+	now := time.Date(2021, 4, 27, 15, 4, 5, 6, time.UTC)
+
+	attributes, err := searchAttributeUpdatesToMap([]SearchAttributeUpdate{
+		stringKey.ValueSet("some text"),
+		keywordKey.ValueSet("keyword"),
+		keywordListKey.ValueSet([]string{"a", "b"}),
+		intKey.ValueSet(42),
+		floatKey.ValueSet(1.5),
+		boolKey.ValueSet(true),
+		timeKey.ValueSet(now),
+	})
+	require.NoError(t, err)
+	payloads, err := serializeSearchAttributes(attributes)
+	require.NoError(t, err)
+
+	searchAttributes := NewSearchAttributesFromProto(payloads)
+	require.Equal(t, 7, searchAttributes.Size())
+	require.True(t, searchAttributes.ContainsKey(intKey))
+
+	stringValue, ok := searchAttributes.GetString(stringKey)
+	require.True(t, ok)
+	require.Equal(t, "some text", stringValue)
+	keywordValue, ok := searchAttributes.GetKeyword(keywordKey)
+	require.True(t, ok)
+	require.Equal(t, "keyword", keywordValue)
+	keywordListValue, ok := searchAttributes.GetKeywordList(keywordListKey)
+	require.True(t, ok)
+	require.Equal(t, []string{"a", "b"}, keywordListValue)
+	intValue, ok := searchAttributes.GetInt64(intKey)
+	require.True(t, ok)
+	require.Equal(t, int64(42), intValue)
+	floatValue, ok := searchAttributes.GetFloat64(floatKey)
+	require.True(t, ok)
+	require.Equal(t, 1.5, floatValue)
+	boolValue, ok := searchAttributes.GetBool(boolKey)
+	require.True(t, ok)
+	require.True(t, boolValue)
+	timeValue, ok := searchAttributes.GetTime(timeKey)
+	require.True(t, ok)
+	require.True(t, now.Equal(timeValue))
+
+	_, ok = searchAttributes.GetKeyword(NewSearchAttributeKeyKeyword("missing"))
+	require.False(t, ok)
+	_, ok = searchAttributes.GetBool(NewSearchAttributeKeyBool("CustomKeywordField"))
+	require.False(t, ok)
+}
+
+func TestSearchAttributes_Validation(t *testing.T) {
+	_, err := searchAttributeUpdatesToMap([]SearchAttributeUpdate{{}})
+	require.Error(t, err)
+
+	_, err = searchAttributeUpdatesToMap([]SearchAttributeUpdate{NewSearchAttributeKeyInt64("").ValueSet(1)})
+	require.Error(t, err)
+
+	_, err = searchAttributeUpdatesToMap([]SearchAttributeUpdate{
+		NewSearchAttributeKeyInt64("CustomField").ValueSet(1),
+		NewSearchAttributeKeyBool("CustomField").ValueSet(true),
+	})
+	require.Error(t, err)
+
+	_, err = searchAttributeUpdatesToMap([]SearchAttributeUpdate{NewSearchAttributeKeyFloat64("CustomDoubleField").ValueSet(math.NaN())})
+	require.Error(t, err)
+
+	// the last update of the same key wins
+	attributes, err := searchAttributeUpdatesToMap([]SearchAttributeUpdate{
+		NewSearchAttributeKeyInt64("CustomIntField").ValueSet(1),
+		NewSearchAttributeKeyInt64("CustomIntField").ValueSet(2),
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"CustomIntField": int64(2)}, attributes)
+}
+
+func TestSearchAttributes_StartOptions(t *testing.T) {
+	untyped := map[string]interface{}{"CustomKeywordField": "keyword"}
+	payloads, err := serializeStartSearchAttributes(StartWorkflowOptions{
+		SearchAttributes:      untyped,
+		TypedSearchAttributes: []SearchAttributeUpdate{NewSearchAttributeKeyInt64("CustomIntField").ValueSet(1)},
+	})
+	require.NoError(t, err)
+	require.Len(t, payloads.IndexedFields, 2)
+	// user map is not modified
+	require.Len(t, untyped, 1)
+
+	_, err = serializeStartSearchAttributes(StartWorkflowOptions{
+		SearchAttributes:      untyped,
+		TypedSearchAttributes: []SearchAttributeUpdate{NewSearchAttributeKeyKeyword("CustomKeywordField").ValueSet("other")},
+	})
+	require.Error(t, err)
+
+	payloads, err = serializeStartSearchAttributes(StartWorkflowOptions{})
+	require.NoError(t, err)
+	require.Nil(t, payloads)
+}
@@ -0,0 +1,337 @@
+// The MIT License
+//
+// Copyright (c) 2020 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	enumspb "go.temporal.io/api/enums/v1"
+)
+
+type (
+	// VisibilityQuery builds a visibility query for the List/Scan/Count workflow APIs.
+	// All conditions added to the query are combined with AND. Use AnyOf to combine sub queries with OR.
+	// Values are quoted and formatted according to their Go type: strings are single quoted,
+	// time.Time values are formatted as RFC3339 with nanoseconds, numbers and booleans are written as is.
+	// Field names are written as is and must only contain letters, digits and underscores.
+	// Example:-
+	//	query, err := NewVisibilityQuery().
+	//		Equal("WorkflowType", "OrderWorkflow").
+	//		In("CustomKeywordField", "a", "b").
+	//		GreaterThan("StartTime", time.Now().Add(-time.Hour)).
+	//		Build()
+	VisibilityQuery struct {
+		clauses []visibilityQueryClause
+		err     error
+	}
+
+	visibilityQueryClause struct {
+		field    string
+		operator string
+		values   []interface{}
+		// subQueries are combined with OR when set, field and operator are ignored
+		subQueries []*VisibilityQuery
+	}
+)
+
+// visibilityQueryFieldPattern matches search attribute names, which are written to the query as is.
+var visibilityQueryFieldPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+const (
+	visibilityQueryOperatorIn      = "IN"
+	visibilityQueryOperatorBetween = "BETWEEN"
+	visibilityQueryOperatorMissing = "= missing"
+)
+
+// NewVisibilityQuery creates an empty visibility query.
+func NewVisibilityQuery() *VisibilityQuery {
+	return &VisibilityQuery{}
+}
+
+// Equal adds "field = value" condition.
+func (q *VisibilityQuery) Equal(field string, value interface{}) *VisibilityQuery {
+	return q.addCondition(field, "=", value)
+}
+
+// NotEqual adds "field != value" condition.
+func (q *VisibilityQuery) NotEqual(field string, value interface{}) *VisibilityQuery {
+	return q.addCondition(field, "!=", value)
+}
+
+// GreaterThan adds "field > value" condition.
+func (q *VisibilityQuery) GreaterThan(field string, value interface{}) *VisibilityQuery {
+	return q.addCondition(field, ">", value)
+}
+
+// GreaterThanOrEqual adds "field >= value" condition.
+func (q *VisibilityQuery) GreaterThanOrEqual(field string, value interface{}) *VisibilityQuery {
+	return q.addCondition(field, ">=", value)
+}
+
+// LessThan adds "field < value" condition.
+func (q *VisibilityQuery) LessThan(field string, value interface{}) *VisibilityQuery {
+	return q.addCondition(field, "<", value)
+}
+
+// LessThanOrEqual adds "field <= value" condition.
+func (q *VisibilityQuery) LessThanOrEqual(field string, value interface{}) *VisibilityQuery {
+	return q.addCondition(field, "<=", value)
+}
+
+// In adds "field IN (values...)" condition. At least one value is required.
+func (q *VisibilityQuery) In(field string, values ...interface{}) *VisibilityQuery {
+	if len(values) == 0 {
+		q.setErr(fmt.Errorf("visibility query: IN condition on %q requires at least one value", field))
+		return q
+	}
+	return q.addCondition(field, visibilityQueryOperatorIn, values...)
+}
+
+// Between adds "field BETWEEN from AND to" condition.
+func (q *VisibilityQuery) Between(field string, from, to interface{}) *VisibilityQuery {
+	return q.addCondition(field, visibilityQueryOperatorBetween, from, to)
+}
+
+// IsMissing adds "field = missing" condition which matches executions without the field set,
+// e.g. IsMissing("CloseTime") matches open workflows.
+func (q *VisibilityQuery) IsMissing(field string) *VisibilityQuery {
+	return q.addCondition(field, visibilityQueryOperatorMissing)
+}
+
+// AnyOf adds a condition which matches if any of the given sub queries matches.
+func (q *VisibilityQuery) AnyOf(queries ...*VisibilityQuery) *VisibilityQuery {
+	if len(queries) == 0 {
+		q.setErr(errors.New("visibility query: AnyOf requires at least one sub query"))
+		return q
+	}
+	for _, sq := range queries {
+		if sq == nil {
+			q.setErr(errors.New("visibility query: AnyOf sub query is nil"))
+			return q
+		}
+		if len(sq.clauses) == 0 {
+			q.setErr(errors.New("visibility query: AnyOf sub query is empty"))
+			return q
+		}
+		q.setErr(sq.err)
+	}
+	q.clauses = append(q.clauses, visibilityQueryClause{subQueries: queries})
+	return q
+}
+
+// Build returns the query string or the first error encountered while building the query.
+func (q *VisibilityQuery) Build() (string, error) {
+	if q.err != nil {
+		return "", q.err
+	}
+	var sb strings.Builder
+	q.write(&sb)
+	return sb.String(), nil
+}
+
+// Validate checks field names and value types of the query against the search attributes
+// returned by Client.GetSearchAttributes.
+func (q *VisibilityQuery) Validate(searchAttributes map[string]enumspb.IndexedValueType) error {
+	if q.err != nil {
+		return q.err
+	}
+	for _, c := range q.clauses {
+		if len(c.subQueries) > 0 {
+			for _, sq := range c.subQueries {
+				if err := sq.Validate(searchAttributes); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		valueType, ok := searchAttributes[c.field]
+		if !ok {
+			return fmt.Errorf("visibility query: unknown search attribute %q", c.field)
+		}
+		for _, v := range c.values {
+			if !isValidSearchAttributeValue(valueType, v) {
+				return fmt.Errorf("visibility query: value %v of type %T is not valid for search attribute %q of type %s",
+					v, v, c.field, valueType)
+			}
+		}
+	}
+	return nil
+}
+
+// BuildValidated validates the query against the search attributes returned by c.GetSearchAttributes
+// and returns the query string.
+func (q *VisibilityQuery) BuildValidated(ctx context.Context, c Client) (string, error) {
+	if q.err != nil {
+		return "", q.err
+	}
+	resp, err := c.GetSearchAttributes(ctx)
+	if err != nil {
+		return "", err
+	}
+	if err := q.Validate(resp.GetKeys()); err != nil {
+		return "", err
+	}
+	return q.Build()
+}
+
+func (q *VisibilityQuery) addCondition(field string, operator string, values ...interface{}) *VisibilityQuery {
+	if field == "" {
+		q.setErr(errors.New("visibility query: field name is empty"))
+		return q
+	}
+	if !visibilityQueryFieldPattern.MatchString(field) {
+		q.setErr(fmt.Errorf("visibility query: invalid field name %q", field))
+		return q
+	}
+	for _, v := range values {
+		if _, err := formatVisibilityQueryValue(v); err != nil {
+			q.setErr(fmt.Errorf("visibility query: field %q: %w", field, err))
+			return q
+		}
+	}
+	q.clauses = append(q.clauses, visibilityQueryClause{field: field, operator: operator, values: values})
+	return q
+}
+
+func (q *VisibilityQuery) setErr(err error) {
+	if q.err == nil {
+		q.err = err
+	}
+}
+
+func (q *VisibilityQuery) write(sb *strings.Builder) {
+	for i, c := range q.clauses {
+		if i > 0 {
+			sb.WriteString(" AND ")
+		}
+		if len(c.subQueries) > 0 {
+			sb.WriteString("(")
+			for j, sq := range c.subQueries {
+				if j > 0 {
+					sb.WriteString(" OR ")
+				}
+				sb.WriteString("(")
+				sq.write(sb)
+				sb.WriteString(")")
+			}
+			sb.WriteString(")")
+			continue
+		}
+		// Values were validated in addCondition so formatting errors can be ignored here.
+		sb.WriteString(c.field)
+		switch c.operator {
+		case visibilityQueryOperatorMissing:
+			sb.WriteString(" " + c.operator)
+		case visibilityQueryOperatorBetween:
+			from, _ := formatVisibilityQueryValue(c.values[0])
+			to, _ := formatVisibilityQueryValue(c.values[1])
+			sb.WriteString(" BETWEEN " + from + " AND " + to)
+		case visibilityQueryOperatorIn:
+			sb.WriteString(" IN (")
+			for j, v := range c.values {
+				if j > 0 {
+					sb.WriteString(", ")
+				}
+				s, _ := formatVisibilityQueryValue(v)
+				sb.WriteString(s)
+			}
+			sb.WriteString(")")
+		default:
+			s, _ := formatVisibilityQueryValue(c.values[0])
+			sb.WriteString(" " + c.operator + " " + s)
+		}
+	}
+}
+
+func formatVisibilityQueryValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return quoteVisibilityQueryString(v), nil
+	case time.Time:
+		return quoteVisibilityQueryString(v.Format(time.RFC3339Nano)), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(rv.Uint(), 10), nil
+	case reflect.Float32:
+		return strconv.FormatFloat(rv.Float(), 'f', -1, 32), nil
+	case reflect.Float64:
+		return strconv.FormatFloat(rv.Float(), 'f', -1, 64), nil
+	case reflect.Bool:
+		return strconv.FormatBool(rv.Bool()), nil
+	case reflect.String:
+		return quoteVisibilityQueryString(rv.String()), nil
+	}
+	return "", fmt.Errorf("unsupported value type %T", value)
+}
+
+func quoteVisibilityQueryString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `'`, `\'`)
+	return "'" + s + "'"
+}
+
+func isValidSearchAttributeValue(valueType enumspb.IndexedValueType, value interface{}) bool {
+	switch valueType {
+	case enumspb.INDEXED_VALUE_TYPE_STRING, enumspb.INDEXED_VALUE_TYPE_KEYWORD:
+		return reflect.ValueOf(value).Kind() == reflect.String
+	case enumspb.INDEXED_VALUE_TYPE_BOOL:
+		return reflect.ValueOf(value).Kind() == reflect.Bool
+	case enumspb.INDEXED_VALUE_TYPE_DATETIME:
+		_, ok := value.(time.Time)
+		return ok
+	case enumspb.INDEXED_VALUE_TYPE_INT:
+		return isIntegerKind(reflect.ValueOf(value).Kind())
+	case enumspb.INDEXED_VALUE_TYPE_DOUBLE:
+		kind := reflect.ValueOf(value).Kind()
+		return kind == reflect.Float32 || kind == reflect.Float64 || isIntegerKind(kind)
+	}
+	return false
+}
+
+func isIntegerKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
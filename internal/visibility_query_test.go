@@ -0,0 +1,160 @@
+// The MIT License
+//
+// Copyright (c) 2020 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package internal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	enumspb "go.temporal.io/api/enums/v1"
+	"go.temporal.io/api/workflowservice/v1"
+	"go.temporal.io/api/workflowservicemock/v1"
+)
+
+func TestVisibilityQuery_Build(t *testing.T) {
+	startTime := time.Date(2021, 4, 27, 15, 4, 5, 0, time.UTC)
+	query, err := NewVisibilityQuery().
+		Equal("WorkflowType", "OrderWorkflow").
+		In("CustomKeywordField", "a", "it's").
+		GreaterThan("StartTime", startTime).
+		Between("CustomIntField", 1, int64(10)).
+		NotEqual("CustomBoolField", true).
+		LessThanOrEqual("CustomDoubleField", 1.5).
+		IsMissing("CloseTime").
+		Build()
+	require.NoError(t, err)
+	require.Equal(t, "WorkflowType = 'OrderWorkflow'"+
+		" AND CustomKeywordField IN ('a', 'it\\'s')"+
+		" AND StartTime > '2021-04-27T15:04:05Z'"+
+		" AND CustomIntField BETWEEN 1 AND 10"+
+		" AND CustomBoolField != true"+
+		" AND CustomDoubleField <= 1.5"+
+		" AND CloseTime = missing", query)
+}
+
+func TestVisibilityQuery_AnyOf(t *testing.T) {
+	query, err := NewVisibilityQuery().
+		Equal("WorkflowType", "type1").
+		AnyOf(
+			NewVisibilityQuery().Equal("WorkflowId", "wid1"),
+			NewVisibilityQuery().Equal("WorkflowId", "wid2").GreaterThanOrEqual("CustomIntField", 3),
+		).
+		Build()
+	require.NoError(t, err)
+	require.Equal(t, "WorkflowType = 'type1' AND ((WorkflowId = 'wid1') OR (WorkflowId = 'wid2' AND CustomIntField >= 3))", query)
+}
+
+func TestVisibilityQuery_BuildErrors(t *testing.T) {
+	_, err := NewVisibilityQuery().Equal("", "value").Build()
+	require.Error(t, err)
+
+	_, err = NewVisibilityQuery().In("CustomKeywordField").Build()
+	require.Error(t, err)
+
+	_, err = NewVisibilityQuery().Equal("CustomKeywordField", struct{}{}).Build()
+	require.Error(t, err)
+
+	_, err = NewVisibilityQuery().AnyOf(NewVisibilityQuery()).Build()
+	require.Error(t, err)
+
+	_, err = NewVisibilityQuery().AnyOf(NewVisibilityQuery().LessThan("", 1)).Build()
+	require.Error(t, err)
+
+	_, err = NewVisibilityQuery().Equal("A = 1 OR B", "value").Build()
+	require.Error(t, err)
+
+	_, err = NewVisibilityQuery().IsMissing("CloseTime OR true").Build()
+	require.Error(t, err)
+}
+
+type testVisibilityQueryStatus string
+
+func TestVisibilityQuery_NamedTypes(t *testing.T) {
+	type flag bool
+	type ratio float64
+	query, err := NewVisibilityQuery().
+		Equal("CustomKeywordField", testVisibilityQueryStatus("it's")).
+		Equal("CustomBoolField", flag(true)).
+		Equal("CustomDoubleField", ratio(0.5)).
+		Build()
+	require.NoError(t, err)
+	require.Equal(t, "CustomKeywordField = 'it\\'s' AND CustomBoolField = true AND CustomDoubleField = 0.5", query)
+
+	require.NoError(t, NewVisibilityQuery().
+		Equal("CustomKeywordField", testVisibilityQueryStatus("a")).
+		Equal("CustomBoolField", flag(false)).
+		Validate(map[string]enumspb.IndexedValueType{
+			"CustomKeywordField": enumspb.INDEXED_VALUE_TYPE_KEYWORD,
+			"CustomBoolField":    enumspb.INDEXED_VALUE_TYPE_BOOL,
+		}))
+}
+
+func TestVisibilityQuery_Validate(t *testing.T) {
+	searchAttributes := map[string]enumspb.IndexedValueType{
+		"WorkflowType":       enumspb.INDEXED_VALUE_TYPE_KEYWORD,
+		"StartTime":          enumspb.INDEXED_VALUE_TYPE_DATETIME,
+		"CloseTime":          enumspb.INDEXED_VALUE_TYPE_DATETIME,
+		"CustomIntField":     enumspb.INDEXED_VALUE_TYPE_INT,
+		"CustomDoubleField":  enumspb.INDEXED_VALUE_TYPE_DOUBLE,
+		"CustomBoolField":    enumspb.INDEXED_VALUE_TYPE_BOOL,
+		"CustomKeywordField": enumspb.INDEXED_VALUE_TYPE_KEYWORD,
+	}
+
+	require.NoError(t, NewVisibilityQuery().
+		Equal("WorkflowType", "type1").
+		GreaterThan("StartTime", time.Now()).
+		Equal("CustomIntField", 1).
+		Equal("CustomDoubleField", 1).
+		Equal("CustomDoubleField", 1.5).
+		Equal("CustomBoolField", false).
+		IsMissing("CloseTime").
+		Validate(searchAttributes))
+
+	require.Error(t, NewVisibilityQuery().Equal("CustomKeywrodField", "typo").Validate(searchAttributes))
+	require.Error(t, NewVisibilityQuery().Equal("CustomIntField", "1").Validate(searchAttributes))
+	require.Error(t, NewVisibilityQuery().Equal("CustomIntField", 1.5).Validate(searchAttributes))
+	require.Error(t, NewVisibilityQuery().GreaterThan("StartTime", "2021-04-27").Validate(searchAttributes))
+	require.Error(t, NewVisibilityQuery().AnyOf(NewVisibilityQuery().Equal("CustomBoolField", 1)).Validate(searchAttributes))
+}
+
+func TestVisibilityQuery_BuildValidated(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	service := workflowservicemock.NewMockWorkflowServiceClient(mockCtrl)
+	client := &WorkflowClient{workflowService: service, namespace: DefaultNamespace}
+	service.EXPECT().GetSearchAttributes(gomock.Any(), gomock.Any(), gomock.Any()).Return(&workflowservice.GetSearchAttributesResponse{
+		Keys: map[string]enumspb.IndexedValueType{"CustomKeywordField": enumspb.INDEXED_VALUE_TYPE_KEYWORD},
+	}, nil).Times(2)
+
+	query, err := NewVisibilityQuery().Equal("CustomKeywordField", "value").BuildValidated(context.Background(), client)
+	require.NoError(t, err)
+	require.Equal(t, "CustomKeywordField = 'value'", query)
+
+	_, err = NewVisibilityQuery().Equal("CustomTextField", "value").BuildValidated(context.Background(), client)
+	require.Error(t, err)
+}
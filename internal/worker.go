@@ -159,6 +159,27 @@ type (
 
 		// Optional: If set defines maximum amount of time that workflow task will be allowed to run. Defaults to 1 sec.
 		DeadlockDetectionTimeout time.Duration
+
+		// Optional: Number of history events after which WorkflowInfo.GetContinueAsNewSuggested starts returning true.
+		// default: 10240
+		ContinueAsNewSuggestedHistoryLength int
+
+		// Optional: Approximate history size in bytes after which WorkflowInfo.GetContinueAsNewSuggested starts
+		// returning true.
+		// default: 10MB
+		ContinueAsNewSuggestedHistorySize int
+
+		// Optional: Enables detection of native goroutines and blocking calls in workflow code. A workflow task that
+		// starts a goroutine with the go statement or blocks on a native channel, mutex or sleep fails with an error
+		// that includes the offending stack trace. It makes workflow execution considerably slower, so it is intended
+		// for debugging only.
+		// A coroutine is reported as blocked when it is seen in the same blocked state in two checks 50ms apart, so
+		// legitimate short waits that take longer than that, like I/O or a contended mutex in a logger or metrics
+		// handler, can be reported as well. The goroutine of a reported coroutine exits on its next call to the SDK
+		// after the native call returns, but workflow code between the two keeps running concurrently with the
+		// workflow, so the workflow must not be used after an error is reported.
+		// default: false
+		EnableCoroutineDebugMode bool
 	}
 )
 
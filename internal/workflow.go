@@ -27,6 +27,7 @@ package internal
 import (
 	"errors"
 	"fmt"
+	"math/rand"
 	"reflect"
 	"strings"
 	"time"
@@ -44,6 +45,7 @@ var (
 	errWorkflowIDNotSet              = errors.New("workflowId is not set")
 	errLocalActivityParamsBadRequest = errors.New("missing local activity parameters through context, check LocalActivityOptions")
 	errSearchAttributesNotSet        = errors.New("search attributes is empty")
+	errMemoNotSet                    = errors.New("memo is empty")
 )
 
 type (
@@ -124,6 +126,49 @@ type (
 		Wait(ctx Context)
 	}
 
+	// Mutex must be used instead of native go sync.Mutex by workflow code.
+	// Use workflow.NewMutex(ctx) method to create a new Mutex instance.
+	Mutex interface {
+		// Lock blocks until the mutex is acquired. Coroutines acquire the mutex in the order they called Lock.
+		// Returns CanceledError if ctx is canceled before the mutex is acquired.
+		Lock(ctx Context) error
+		// TryLock tries to acquire the mutex without blocking. Returns true if the mutex is acquired.
+		TryLock(ctx Context) bool
+		// Unlock releases the mutex. Panics if the mutex is not locked.
+		Unlock()
+		// IsLocked returns true if the mutex is currently held.
+		IsLocked() bool
+	}
+
+	// Semaphore must be used instead of native go semaphore by workflow code.
+	// Use workflow.NewSemaphore(ctx, n) method to create a new Semaphore instance.
+	Semaphore interface {
+		// Acquire blocks until n permits are acquired. Coroutines acquire permits in the order they called Acquire.
+		// Returns CanceledError if ctx is canceled before the permits are acquired, or an error without blocking if
+		// n is not positive or exceeds the size of the semaphore.
+		Acquire(ctx Context, n int64) error
+		// TryAcquire tries to acquire n permits without blocking. Returns true if the permits are acquired, false
+		// if they are not available or n is not positive.
+		TryAcquire(ctx Context, n int64) bool
+		// Release releases n permits. Panics if n is not positive or more permits are released than are held.
+		Release(n int64)
+	}
+
+	// ErrGroup is a collection of coroutines working on subtasks of a common task, like errgroup.Group from
+	// golang.org/x/sync. Use workflow.NewErrGroup(ctx) method to create a new ErrGroup instance.
+	ErrGroup interface {
+		// Go starts f in a new coroutine. The context passed to f is canceled when any function started by
+		// the group returns an error or Wait returns. If the limit of running coroutines is reached, f is
+		// started when one of the running functions returns.
+		Go(f func(ctx Context) error)
+		// Wait blocks until all functions started by Go have returned, then returns the first non-nil error
+		// returned by them.
+		Wait(ctx Context) error
+		// SetLimit limits the number of functions running at the same time to n. Zero or negative n means
+		// no limit. The limit must not be changed while functions are running.
+		SetLimit(n int)
+	}
+
 	// Future represents the result of an asynchronous computation.
 	Future interface {
 		// Get blocks until the future is ready. When ready it either returns non nil error or assigns result value to
@@ -259,6 +304,11 @@ type (
 		// Use GetSearchAttributes API to get valid key and corresponding value type.
 		SearchAttributes map[string]interface{}
 
+		// TypedSearchAttributes - Optional typed search attributes created with typed search attribute keys,
+		// e.g. NewSearchAttributeKeyKeyword("CustomKeywordField").ValueSet("value"). They are combined with
+		// SearchAttributes, a key must not be set in both.
+		TypedSearchAttributes []SearchAttributeUpdate
+
 		// ParentClosePolicy - Optional policy to decide what to do for the child.
 		// Default is Terminate (if onboarded to this feature)
 		ParentClosePolicy enumspb.ParentClosePolicy
@@ -363,6 +413,38 @@ func NewWaitGroup(ctx Context) WaitGroup {
 	return &waitGroupImpl{future: f, settable: s}
 }
 
+// NewMutex creates a new Mutex instance.
+func NewMutex(ctx Context) Mutex {
+	return &mutexImpl{semaphore: newSemaphore(1)}
+}
+
+// NewSemaphore creates a new Semaphore instance with n permits.
+func NewSemaphore(ctx Context, n int64) Semaphore {
+	return newSemaphore(n)
+}
+
+// NewRandom returns a new random generator which can be used in workflow code. The generator is seeded
+// deterministically, so it returns the same sequence when the workflow is replayed. The seed is recorded into the
+// workflow history as a side effect marker by the first NewRandom or NewUUID call of the run, and again by the first
+// call after the reset point of a reset run, so the sequence differs for the runs created by continue-as-new and
+// after reset. Each NewRandom call returns a generator with a different sequence.
+// The generator must not be shared with other workflows.
+func NewRandom(ctx Context) *rand.Rand {
+	return getWorkflowEnvOptions(ctx).randomness.newRandom(getWorkflowEnvironment(ctx).GetRandomSeed())
+}
+
+// NewUUID returns a new random (version 4) UUID generated deterministically, see NewRandom.
+func NewUUID(ctx Context) string {
+	return getWorkflowEnvOptions(ctx).randomness.newUUID(getWorkflowEnvironment(ctx).GetRandomSeed())
+}
+
+// NewErrGroup creates a new ErrGroup instance. Context passed to the functions started by the group is derived
+// from ctx.
+func NewErrGroup(ctx Context) ErrGroup {
+	groupCtx, cancel := WithCancel(ctx)
+	return &errGroupImpl{ctx: groupCtx, cancel: cancel, wg: NewWaitGroup(ctx)}
+}
+
 // Go creates a new coroutine. It has similar semantic to goroutine in a context of the workflow.
 func Go(ctx Context, f func(ctx Context)) {
 	state := getState(ctx)
@@ -758,6 +840,13 @@ func (wc *workflowEnvironmentInterceptor) ExecuteChildWorkflow(ctx Context, chil
 	options.Memo = workflowOptionsFromCtx.Memo
 	options.SearchAttributes = workflowOptionsFromCtx.SearchAttributes
 
+	searchAttributes, err := mergeTypedSearchAttributes(options.SearchAttributes, options.TypedSearchAttributes)
+	if err != nil {
+		executionSettable.Set(nil, err)
+		mainSettable.Set(nil, err)
+		return result
+	}
+
 	params := ExecuteWorkflowParams{
 		WorkflowOptions: *options,
 		Input:           input,
@@ -766,6 +855,8 @@ func (wc *workflowEnvironmentInterceptor) ExecuteChildWorkflow(ctx Context, chil
 		scheduledTime:   Now(ctx), /* this is needed for test framework, and is not send to server */
 		attempt:         1,
 	}
+	params.SearchAttributes = searchAttributes
+	params.TypedSearchAttributes = nil
 
 	ctxDone, cancellable := ctx.Done().(*channelImpl)
 	cancellationCallback := &receiveCallback{}
@@ -834,6 +925,45 @@ type WorkflowInfo struct {
 	Memo                    *commonpb.Memo             // Value can be decoded using data converter (defaultDataConverter, or custom one if set).
 	SearchAttributes        *commonpb.SearchAttributes // Value can be decoded using defaultDataConverter.
 	BinaryChecksum          string
+
+	currentHistoryLength   int
+	currentHistorySize     int
+	continueAsNewSuggested bool
+	dataConverter          converter.DataConverter // decodes Memo, set by the workflow environment
+}
+
+// GetCurrentHistoryLength returns the number of events in workflow history at the time of the current workflow task.
+func (wInfo *WorkflowInfo) GetCurrentHistoryLength() int {
+	return wInfo.currentHistoryLength
+}
+
+// GetCurrentHistorySize returns the approximate size in bytes of workflow history at the time of the current
+// workflow task.
+func (wInfo *WorkflowInfo) GetCurrentHistorySize() int {
+	return wInfo.currentHistorySize
+}
+
+// GetContinueAsNewSuggested returns true when history length or size reached the thresholds configured by
+// WorkerOptions.ContinueAsNewSuggestedHistoryLength and WorkerOptions.ContinueAsNewSuggestedHistorySize.
+// Long running workflows should check it periodically and continue-as-new to keep history small.
+func (wInfo *WorkflowInfo) GetContinueAsNewSuggested() bool {
+	return wInfo.continueAsNewSuggested
+}
+
+// GetTypedSearchAttributes returns the current search attributes of the workflow, including the ones
+// upserted by the workflow so far, which can be decoded with typed search attribute keys.
+func (wInfo *WorkflowInfo) GetTypedSearchAttributes() SearchAttributes {
+	return NewSearchAttributesFromProto(wInfo.SearchAttributes)
+}
+
+// GetDecodedMemo returns the current memo of the workflow, including the fields upserted by the workflow so far.
+// Each value can be decoded with EncodedValue.Get.
+func (wInfo *WorkflowInfo) GetDecodedMemo() map[string]converter.EncodedValue {
+	dc := wInfo.dataConverter
+	if dc == nil {
+		dc = converter.GetDefaultDataConverter()
+	}
+	return decodePayloadMap(wInfo.Memo.GetFields(), dc)
 }
 
 // GetBinaryChecksum return binary checksum.
@@ -1074,6 +1204,49 @@ func (wc *workflowEnvironmentInterceptor) UpsertSearchAttributes(ctx Context, at
 	return wc.env.UpsertSearchAttributes(attributes)
 }
 
+// UpsertMemo is used to add or update workflow memo.
+// The value has to deterministic when replay;
+// The value has to be Json serializable.
+// UpsertMemo will merge memo to existing map in workflow, for example workflow code:
+//   func MyWorkflow(ctx workflow.Context, input string) error {
+//	   memo := map[string]interface{}{
+//		   "Description": "processing",
+//	   }
+//	   workflow.UpsertMemo(ctx, memo)
+//	   ...
+//	   var description string
+//	   _ = workflow.GetInfo(ctx).GetDecodedMemo()["Description"].Get(&description)
+//   }
+// The change is recorded in workflow history as a marker and is visible to the workflow through GetInfo.
+// Memo returned by List/Scan/Describe workflow APIs is not updated, because server doesn't support
+// modifying memo of a running workflow.
+func UpsertMemo(ctx Context, memo map[string]interface{}) error {
+	i := getWorkflowOutboundCallsInterceptor(ctx)
+	return i.UpsertMemo(ctx, memo)
+}
+
+func (wc *workflowEnvironmentInterceptor) UpsertMemo(ctx Context, memo map[string]interface{}) error {
+	return wc.env.UpsertMemo(memo)
+}
+
+// UpsertTypedSearchAttributes is used to add or update workflow search attributes with typed keys.
+// It behaves like UpsertSearchAttributes, but value types are checked at compile time, for example:
+//   var customIntKey = NewSearchAttributeKeyInt64("CustomIntField")
+//
+//   func MyWorkflow(ctx workflow.Context, input string) error {
+//	   err := workflow.UpsertTypedSearchAttributes(ctx, customIntKey.ValueSet(2))
+//	   ...
+//	   value, ok := workflow.GetInfo(ctx).GetTypedSearchAttributes().GetInt64(customIntKey)
+//   }
+// This is only supported when using ElasticSearch.
+func UpsertTypedSearchAttributes(ctx Context, updates ...SearchAttributeUpdate) error {
+	attributes, err := searchAttributeUpdatesToMap(updates)
+	if err != nil {
+		return err
+	}
+	return UpsertSearchAttributes(ctx, attributes)
+}
+
 // WithChildWorkflowOptions adds all workflow options to the context.
 // The current timeout resolution implementation is in seconds and uses math.Ceil(d.Seconds()) as the duration. But is
 // subjected to change in the future.
@@ -1096,6 +1269,7 @@ func WithChildWorkflowOptions(ctx Context, cwo ChildWorkflowOptions) Context {
 	wfOptions.CronSchedule = cwo.CronSchedule
 	wfOptions.Memo = cwo.Memo
 	wfOptions.SearchAttributes = cwo.SearchAttributes
+	wfOptions.TypedSearchAttributes = cwo.TypedSearchAttributes
 	wfOptions.ParentClosePolicy = cwo.ParentClosePolicy
 
 	return ctx1
@@ -1120,6 +1294,7 @@ func GetChildWorkflowOptions(ctx Context) ChildWorkflowOptions {
 		CronSchedule:             opts.CronSchedule,
 		Memo:                     opts.Memo,
 		SearchAttributes:         opts.SearchAttributes,
+		TypedSearchAttributes:    opts.TypedSearchAttributes,
 		ParentClosePolicy:        opts.ParentClosePolicy,
 	}
 }
@@ -1371,6 +1546,38 @@ func (wc *workflowEnvironmentInterceptor) GetVersion(ctx Context, changeID strin
 	return wc.env.GetVersion(changeID, minSupported, maxSupported)
 }
 
+// patchedVersion is a version recorded by Patched for the new code path.
+const patchedVersion Version = 1
+
+// Patched is a simpler alternative to GetVersion for a change that has only the old and the new code path.
+// Patched returns true when is executed for the first time and records it into the workflow history as a version
+// marker with patchID as its changeID. On replay it returns true only if the marker is present in the history,
+// so executions started before the change keep taking the old code path:
+//  if workflow.Patched(ctx, "fooChange") {
+//      err = workflow.ExecuteActivity(ctx, bar).Get(ctx, nil)
+//  } else {
+//      err = workflow.ExecuteActivity(ctx, foo).Get(ctx, nil)
+//  }
+//
+// When there are no executions running the old code path anymore, replace the call with DeprecatePatch:
+//  workflow.DeprecatePatch(ctx, "fooChange")
+//  err = workflow.ExecuteActivity(ctx, bar).Get(ctx, nil)
+//
+// patchID must not be used with GetVersion. Patched is mocked in TestWorkflowEnvironment with
+// OnGetVersion(patchID, DefaultVersion, 1), returning DefaultVersion from the mock selects the old code path.
+func Patched(ctx Context, patchID string) bool {
+	return GetVersion(ctx, patchID, DefaultVersion, patchedVersion) == patchedVersion
+}
+
+// DeprecatePatch marks the patch as applied to all running executions after the old code path has been removed.
+// Like Patched, it records the marker for patchID when is executed for the first time, so a rolled back build that
+// still calls Patched takes the new code path for executions started by the build with DeprecatePatch. On replay it
+// accepts histories both with and without the marker, so the executions that took the new code path still replay.
+// Once all executions without the marker are closed DeprecatePatch call can be removed too.
+func DeprecatePatch(ctx Context, patchID string) {
+	_ = Patched(ctx, patchID)
+}
+
 // SetQueryHandler sets the query handler to handle workflow query. The queryType specify which query type this handler
 // should handle. The handler must be a function that returns 2 values. The first return value must be a serializable
 // result. The second return value must be an error. The handler function could receive any number of input parameters.
@@ -1421,6 +1628,39 @@ func (wc *workflowEnvironmentInterceptor) SetQueryHandler(ctx Context, queryType
 	return setQueryHandler(ctx, queryType, handler)
 }
 
+// SetSignalHandler sets the handler for the signal with the given name. The handler must be a function which
+// takes workflow.Context as the first argument, followed by the arguments of the signal, and returns nothing.
+// Every delivered signal is processed by the handler in its own coroutine, so the handler can block, for example
+// to execute an activity, without delaying other signals.
+// Ordering guarantees:
+//  - handlers of signals with the same name are started in the order the signals are delivered to the workflow.
+//    Signals with different names are dispatched independently, so their handlers may start in any order;
+//  - handler of a signal starts in the workflow task the signal is delivered in, after the main workflow coroutine
+//    and other running coroutines are blocked. So the main workflow coroutine observes changes made by handlers
+//    when it is unblocked, for example by workflow.Await;
+//  - signals delivered before the handler is set are buffered and processed as soon as it is set.
+// Calling SetSignalHandler again for the same signal name replaces the handler for subsequent signals.
+// Signal channel returned by GetSignalChannel for the same signal name must not be used together with the handler.
+// Example:
+//  func MyWorkflow(ctx workflow.Context) error {
+//    var total int
+//    err := workflow.SetSignalHandler(ctx, "add", func(ctx workflow.Context, value int) {
+//      total += value
+//    })
+//    if err != nil {
+//      return err
+//    }
+//    return workflow.Await(ctx, func() bool { return total > 100 })
+//  }
+func SetSignalHandler(ctx Context, signalName string, handler interface{}) error {
+	i := getWorkflowOutboundCallsInterceptor(ctx)
+	return i.SetSignalHandler(ctx, signalName, handler)
+}
+
+func (wc *workflowEnvironmentInterceptor) SetSignalHandler(ctx Context, signalName string, handler interface{}) error {
+	return setSignalHandler(ctx, signalName, handler)
+}
+
 // IsReplaying returns whether the current workflow code is replaying.
 //
 // Warning! Never make commands, like schedule activity/childWorkflow/timer or send/wait on future/channel, based on
@@ -55,6 +55,9 @@ func TestGetChildWorkflowOptions(t *testing.T) {
 		SearchAttributes: map[string]interface{}{
 			"foo": "bar",
 		},
+		TypedSearchAttributes: []SearchAttributeUpdate{
+			NewSearchAttributeKeyKeyword("baz").ValueSet("qux"),
+		},
 		ParentClosePolicy: enums.PARENT_CLOSE_POLICY_REQUEST_CANCEL,
 	}
 
@@ -137,7 +140,15 @@ func _assertNonZero(t *testing.T, i interface{}, prefix string) {
 	switch v.Kind() {
 	case reflect.Struct:
 		for i := 0; i < v.NumField(); i++ {
-			_assertNonZero(t, v.Field(i).Interface(), fmt.Sprintf("%s.%s", prefix, v.Type().Field(i).Name))
+			name := fmt.Sprintf("%s.%s", prefix, v.Type().Field(i).Name)
+			if !v.Field(i).CanInterface() {
+				// unexported fields cannot be inspected further
+				if v.Field(i).IsZero() {
+					t.Errorf("%s: unexported value must be non-zero", name)
+				}
+				continue
+			}
+			_assertNonZero(t, v.Field(i).Interface(), name)
 		}
 	case reflect.Slice:
 		if v.Len() == 0 {
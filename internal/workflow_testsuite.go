@@ -26,6 +26,7 @@ package internal
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"reflect"
 	"strings"
@@ -36,6 +37,7 @@ import (
 	"github.com/uber-go/tally"
 	commonpb "go.temporal.io/api/common/v1"
 	enumspb "go.temporal.io/api/enums/v1"
+	historypb "go.temporal.io/api/history/v1"
 
 	"go.temporal.io/api/serviceerror"
 	"go.temporal.io/sdk/converter"
@@ -66,6 +68,44 @@ type (
 		impl *testWorkflowEnvironmentImpl
 	}
 
+	// TestWorkflowRun is a run of the workflow executed by TestWorkflowEnvironment. A workflow has more than one run
+	// when it continues as new and continue-as-new chaining is enabled, see SetContinueAsNewChaining().
+	TestWorkflowRun struct {
+		runID  string
+		result converter.EncodedValue
+		err    error
+	}
+
+	// TestChaosOptions configures the faults injected by TestWorkflowEnvironment in chaos mode, see SetChaosOptions().
+	// Probabilities are in the range [0, 1], a zero probability disables the fault.
+	TestChaosOptions struct {
+		// Seed of the injected faults. Executions of the same workflow with the same seed inject the same faults.
+		Seed int64
+
+		// ActivityFailureProbability is the probability that an activity attempt fails with a retryable error
+		// instead of running.
+		ActivityFailureProbability float64
+
+		// HeartbeatTimeoutProbability is the probability that an attempt of an activity with a heartbeat timeout
+		// times out on heartbeat instead of running.
+		HeartbeatTimeoutProbability float64
+
+		// ActivityDelayProbability is the probability that the result of an activity is delivered to the workflow
+		// after a random delay of up to MaxActivityDelay on the workflow clock.
+		ActivityDelayProbability float64
+
+		// MaxActivityDelay is the maximum delay of activity results. Default: 1 minute.
+		MaxActivityDelay time.Duration
+
+		// DuplicateSignalProbability is the probability that a signal is delivered to the workflow twice.
+		DuplicateSignalProbability float64
+
+		// EvictionProbability is the probability that the workflow is evicted after a workflow task, in which case
+		// a new workflow instance replays its history from scratch, the same way a worker does after eviction, and
+		// continues the execution in place of the evicted one.
+		EvictionProbability float64
+	}
+
 	// TestActivityEnvironment is the environment that you use to test activity
 	TestActivityEnvironment struct {
 		impl *testWorkflowEnvironmentImpl
@@ -161,6 +201,28 @@ func (s *WorkflowTestSuite) SetHeader(header *commonpb.Header) {
 	s.header = header
 }
 
+// AssertChaosResult executes the workflow in two new TestWorkflowEnvironment, one as is and one in chaos mode with
+// the given options (see TestWorkflowEnvironment.SetChaosOptions()), and fails the test if the workflow does not reach
+// the same result in both. setup is called with each environment before the workflow is executed, to register
+// workflows and activities and to set up mocks and callbacks.
+func (s *WorkflowTestSuite) AssertChaosResult(t mock.TestingT, options TestChaosOptions, setup func(env *TestWorkflowEnvironment),
+	workflowFn interface{}, args ...interface{}) bool {
+	expected := s.NewTestWorkflowEnvironment()
+	setup(expected)
+	expected.ExecuteWorkflow(workflowFn, args...)
+
+	actual := s.NewTestWorkflowEnvironment()
+	actual.SetChaosOptions(options)
+	setup(actual)
+	actual.ExecuteWorkflow(workflowFn, args...)
+
+	if err := compareTestResults(expected.impl, actual.impl); err != nil {
+		t.Errorf("Workflow result in chaos mode (seed %v) differs: %v", options.Seed, err)
+		return false
+	}
+	return true
+}
+
 // RegisterActivity registers activity implementation with TestWorkflowEnvironment
 func (t *TestActivityEnvironment) RegisterActivity(a interface{}) {
 	t.impl.RegisterActivity(a)
@@ -360,6 +422,7 @@ const mockMethodForSignalExternalWorkflow = "workflow.SignalExternalWorkflow"
 const mockMethodForRequestCancelExternalWorkflow = "workflow.RequestCancelExternalWorkflow"
 const mockMethodForGetVersion = "workflow.GetVersion"
 const mockMethodForUpsertSearchAttributes = "workflow.UpsertSearchAttributes"
+const mockMethodForUpsertMemo = "workflow.UpsertMemo"
 
 // OnSignalExternalWorkflow setup a mock for sending signal to external workflow.
 // This TestWorkflowEnvironment handles sending signals between the workflows that are started from the root workflow.
@@ -428,6 +491,14 @@ func (e *TestWorkflowEnvironment) OnUpsertSearchAttributes(attributes map[string
 	return e.wrapCall(call)
 }
 
+// OnUpsertMemo setup a mock for workflow.UpsertMemo call.
+// If mock is not setup, the UpsertMemo call will only validate input memo.
+// If mock is setup, all UpsertMemo calls in workflow have to be mocked.
+func (e *TestWorkflowEnvironment) OnUpsertMemo(memo map[string]interface{}) *MockCallWrapper {
+	call := e.mock.On(mockMethodForUpsertMemo, memo)
+	return e.wrapCall(call)
+}
+
 func (e *TestWorkflowEnvironment) wrapCall(call *mock.Call) *MockCallWrapper {
 	callWrapper := &MockCallWrapper{call: call, env: e}
 	call.Run(e.impl.getMockRunFn(callWrapper))
@@ -500,6 +571,25 @@ func (c *MockCallWrapper) Panic(msg string) *MockCallWrapper {
 func (e *TestWorkflowEnvironment) ExecuteWorkflow(workflowFn interface{}, args ...interface{}) {
 	e.impl.mock = &e.mock
 	e.impl.executeWorkflow(workflowFn, args...)
+	for {
+		env, continueAsNewErr := e.impl.newTestWorkflowEnvironmentForContinueAsNew()
+		if env == nil {
+			break
+		}
+		e.impl = env
+		env.executeWorkflowInternal(0, continueAsNewErr.WorkflowType.Name, continueAsNewErr.Input)
+	}
+}
+
+// StartWorkflow starts a workflow that runs alongside the workflow executed by ExecuteWorkflow() in the same
+// TestWorkflowEnvironment, for example to test coordination between workflows with SetExternalWorkflowRouting().
+// The workflow ID must be set in the options. StartWorkflow must be called before ExecuteWorkflow() or from a
+// delayed callback, and ExecuteWorkflow() does not return until the started workflows are completed. Use
+// GetWorkflowResultByID(), GetWorkflowErrorByID() and SignalWorkflowByID() to interact with the started workflow.
+// Note that StartWorkflowOptions is defined in an internal package, use client.StartWorkflowOptions instead.
+func (e *TestWorkflowEnvironment) StartWorkflow(options StartWorkflowOptions, workflowFn interface{}, args ...interface{}) {
+	e.impl.mock = &e.mock
+	e.impl.startWorkflow(options, workflowFn, args...)
 }
 
 // Now returns the current workflow time (a.k.a workflow.Now() time) of this TestWorkflowEnvironment.
@@ -577,6 +667,58 @@ func (e *TestWorkflowEnvironment) SetWorkflowRunTimeout(runTimeout time.Duration
 	return e
 }
 
+// SetChaosOptions enables chaos mode, in which the test framework randomly injects faults that a workflow can
+// experience in production, to verify that the workflow still reaches the same result (see also
+// WorkflowTestSuite.AssertChaosResult()). Faults are chosen pseudo-randomly from options.Seed:
+//  - activity attempts fail with retryable errors or time out on heartbeat. An attempt is only failed if the retry
+//    policy allows another attempt, so the last attempt always runs the activity.
+//  - activity results are delivered to the workflow with a delay.
+//  - signals are delivered twice.
+//  - the workflow is evicted and a new workflow instance replays its history from scratch and continues the
+//    execution. If the replay fails, GetWorkflowError() returns the replay error (like NonDeterminismError) instead
+//    of the result of the test execution.
+func (e *TestWorkflowEnvironment) SetChaosOptions(options TestChaosOptions) *TestWorkflowEnvironment {
+	e.impl.chaos = newChaosPressurePoints(options, e.impl)
+	return e
+}
+
+// SetExternalWorkflowRouting enables delivery of SignalExternalWorkflow and RequestCancelExternalWorkflow to the
+// workflows running in this TestWorkflowEnvironment: the tested workflow, its child workflows and the workflows started
+// by StartWorkflow(). When enabled, OnSignalExternalWorkflow and OnRequestCancelExternalWorkflow mocks are not used,
+// and a request to a workflow that is not running in the environment fails the same way as with the server.
+func (e *TestWorkflowEnvironment) SetExternalWorkflowRouting(enabled bool) *TestWorkflowEnvironment {
+	e.impl.routeExternalWorkflows = enabled
+	return e
+}
+
+// SetContinueAsNewChaining enables continue-as-new chaining. When the tested workflow returns ContinueAsNewError, the
+// test framework starts the next run of the workflow with the new arguments in the same environment, until a run
+// completes without continuing as new or maxRuns runs have been executed. The mock clock, mocks and delayed callbacks
+// carry over to the next run, while timers and activities still pending in the previous run are dropped.
+// After ExecuteWorkflow() the environment reflects the last run, use GetWorkflowRuns() to get the result of every run.
+// A maxRuns of zero (the default) disables chaining, ExecuteWorkflow() then returns after the first run.
+func (e *TestWorkflowEnvironment) SetContinueAsNewChaining(maxRuns int) *TestWorkflowEnvironment {
+	e.impl.maxContinueAsNewRuns = maxRuns
+	return e
+}
+
+// SetHistoryRecording enables recording of the event history of the tested workflow and its child workflows, see
+// GetHistory(). Recording is also enabled by SetReplayVerification() and SetChaosOptions().
+func (e *TestWorkflowEnvironment) SetHistoryRecording(enabled bool) *TestWorkflowEnvironment {
+	e.impl.recordHistory = enabled
+	return e
+}
+
+// SetReplayVerification enables replay of the tested workflow. When enabled, at the end of ExecuteWorkflow() the test
+// framework records and replays the histories of the tested workflow and its child workflows (see GetHistory()) with
+// the same replayer as WorkflowReplayer. If the workflow code does not replay deterministically, GetWorkflowError() returns
+// the NonDeterminismError (or other replay error) instead of the result of the test execution.
+// Histories of mocked workflows are not replayed.
+func (e *TestWorkflowEnvironment) SetReplayVerification(enabled bool) *TestWorkflowEnvironment {
+	e.impl.verifyReplay = enabled
+	return e
+}
+
 // SetOnActivityStartedListener sets a listener that will be called before activity starts execution.
 // Note: ActivityInfo is defined in internal package, use public type activity.Info instead.
 func (e *TestWorkflowEnvironment) SetOnActivityStartedListener(
@@ -699,9 +841,9 @@ func (e *TestWorkflowEnvironment) GetWorkflowResultByID(workflowID string, value
 			panic("workflow is not completed")
 		}
 		if workflowHandle.env.testError != nil || workflowHandle.env.testResult == nil || valuePtr == nil {
-			return e.impl.testError
+			return workflowHandle.env.testError
 		}
-		return e.impl.testResult.Get(valuePtr)
+		return workflowHandle.env.testResult.Get(valuePtr)
 	}
 	return serviceerror.NewNotFound(fmt.Sprintf("Workflow %v not exists", workflowID))
 }
@@ -711,6 +853,27 @@ func (e *TestWorkflowEnvironment) GetWorkflowError() error {
 	return e.impl.testError
 }
 
+// GetHistory returns the event history of the test workflow, as the server would have recorded it for a real worker
+// running the same workflow: activities, timers, signals, markers, child workflows and so on. The history can be saved
+// as a golden file or replayed with WorkflowReplayer. History is only recorded when enabled with
+// SetHistoryRecording(), SetReplayVerification() or SetChaosOptions() before ExecuteWorkflow(), otherwise an error is
+// returned. Returns nil history if ExecuteWorkflow() has not been called.
+func (e *TestWorkflowEnvironment) GetHistory() (*historypb.History, error) {
+	if !e.impl.isHistoryRecorded() {
+		return nil, errors.New("history recording is not enabled, see SetHistoryRecording()")
+	}
+	if e.impl.historyRecorder == nil {
+		return nil, nil
+	}
+	return e.impl.historyRecorder.history()
+}
+
+// GetWorkflowRuns returns the runs of the test workflow in the order they were executed. There is one run per
+// ExecuteWorkflow() unless continue-as-new chaining is enabled, see SetContinueAsNewChaining().
+func (e *TestWorkflowEnvironment) GetWorkflowRuns() []*TestWorkflowRun {
+	return e.impl.workflowRuns
+}
+
 // GetWorkflowErrorByID return the error from test workflow
 func (e *TestWorkflowEnvironment) GetWorkflowErrorByID(workflowID string) error {
 	if workflowHandle, ok := e.impl.runningWorkflows[workflowID]; ok {
@@ -784,6 +947,31 @@ func (e *TestWorkflowEnvironment) SetLastError(err error) {
 	e.impl.setLastError(err)
 }
 
+// SetCurrentHistoryLength sets the value returned by workflow.GetInfo(ctx).GetCurrentHistoryLength().
+// GetContinueAsNewSuggested is updated according to thresholds set by SetWorkerOptions, so worker options
+// have to be set before this call.
+// When the history of the workflow is recorded (see SetHistoryRecording), history length and size are counted from the
+// recorded events at every workflow task the same way as by the worker, and override the values set here. Otherwise
+// they stay 0 unless they are set with SetCurrentHistoryLength and SetCurrentHistorySize.
+func (e *TestWorkflowEnvironment) SetCurrentHistoryLength(length int) {
+	e.impl.setCurrentHistoryStats(length, e.impl.workflowInfo.currentHistorySize)
+}
+
+// SetCurrentHistorySize sets the value returned by workflow.GetInfo(ctx).GetCurrentHistorySize().
+// GetContinueAsNewSuggested is updated according to thresholds set by SetWorkerOptions, so worker options
+// have to be set before this call.
+// Like history length, history size is only tracked when the history of the workflow is recorded.
+func (e *TestWorkflowEnvironment) SetCurrentHistorySize(size int) {
+	e.impl.setCurrentHistoryStats(e.impl.workflowInfo.currentHistoryLength, size)
+}
+
+// SetContinueAsNewSuggested sets the value returned by workflow.GetInfo(ctx).GetContinueAsNewSuggested()
+// regardless of history length and size. When the history of the workflow is recorded, the value is updated from the
+// recorded history length and size at every workflow task.
+func (e *TestWorkflowEnvironment) SetContinueAsNewSuggested(suggest bool) {
+	e.impl.workflowInfo.continueAsNewSuggested = suggest
+}
+
 // SetMemoOnStart sets the memo when start workflow.
 func (e *TestWorkflowEnvironment) SetMemoOnStart(memo map[string]interface{}) error {
 	memoStruct, err := getWorkflowMemo(memo, e.impl.GetDataConverter())
@@ -804,8 +992,43 @@ func (e *TestWorkflowEnvironment) SetSearchAttributesOnStart(searchAttributes ma
 	return nil
 }
 
+// SetTypedSearchAttributesOnStart sets the search attributes when start workflow using typed search attribute keys.
+// It can be combined with SetSearchAttributesOnStart.
+func (e *TestWorkflowEnvironment) SetTypedSearchAttributesOnStart(updates ...SearchAttributeUpdate) error {
+	searchAttributes, err := searchAttributeUpdatesToMap(updates)
+	if err != nil {
+		return err
+	}
+	attr, err := serializeSearchAttributes(searchAttributes)
+	if err != nil {
+		return err
+	}
+	e.impl.workflowInfo.SearchAttributes = mergeSearchAttributes(e.impl.workflowInfo.SearchAttributes, attr)
+	return nil
+}
+
 // AssertExpectations  asserts that everything specified with OnActivity
 // in fact called as expected.  Calls may have occurred in any order.
 func (e *TestWorkflowEnvironment) AssertExpectations(t mock.TestingT) bool {
 	return e.mock.AssertExpectations(t)
 }
+
+// GetRunID returns the run ID of the workflow run.
+func (r *TestWorkflowRun) GetRunID() string {
+	return r.runID
+}
+
+// GetWorkflowResult extracts the encoded result of the workflow run, it returns error if the run failed or the
+// extraction failed.
+func (r *TestWorkflowRun) GetWorkflowResult(valuePtr interface{}) error {
+	if r.err != nil || r.result == nil || valuePtr == nil {
+		return r.err
+	}
+	return r.result.Get(valuePtr)
+}
+
+// GetWorkflowError returns the error of the workflow run. The error of a run that continued as new wraps the
+// ContinueAsNewError.
+func (r *TestWorkflowRun) GetWorkflowError() error {
+	return r.err
+}
@@ -259,6 +259,22 @@ func (_m *Client) ListClosedWorkflow(ctx context.Context, request *workflowservi
 	return r0, r1
 }
 
+// ListClosedWorkflowIterator provides a mock function with given fields: ctx, request
+func (_m *Client) ListClosedWorkflowIterator(ctx context.Context, request *workflowservice.ListClosedWorkflowExecutionsRequest) client.WorkflowExecutionIterator {
+	ret := _m.Called(ctx, request)
+
+	var r0 internal.WorkflowExecutionIterator
+	if rf, ok := ret.Get(0).(func(context.Context, *workflowservice.ListClosedWorkflowExecutionsRequest) internal.WorkflowExecutionIterator); ok {
+		r0 = rf(ctx, request)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(internal.WorkflowExecutionIterator)
+		}
+	}
+
+	return r0
+}
+
 // ListOpenWorkflow provides a mock function with given fields: ctx, request
 func (_m *Client) ListOpenWorkflow(ctx context.Context, request *workflowservice.ListOpenWorkflowExecutionsRequest) (*workflowservice.ListOpenWorkflowExecutionsResponse, error) {
 	ret := _m.Called(ctx, request)
@@ -282,6 +298,22 @@ func (_m *Client) ListOpenWorkflow(ctx context.Context, request *workflowservice
 	return r0, r1
 }
 
+// ListOpenWorkflowIterator provides a mock function with given fields: ctx, request
+func (_m *Client) ListOpenWorkflowIterator(ctx context.Context, request *workflowservice.ListOpenWorkflowExecutionsRequest) client.WorkflowExecutionIterator {
+	ret := _m.Called(ctx, request)
+
+	var r0 internal.WorkflowExecutionIterator
+	if rf, ok := ret.Get(0).(func(context.Context, *workflowservice.ListOpenWorkflowExecutionsRequest) internal.WorkflowExecutionIterator); ok {
+		r0 = rf(ctx, request)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(internal.WorkflowExecutionIterator)
+		}
+	}
+
+	return r0
+}
+
 // ListWorkflow provides a mock function with given fields: ctx, request
 func (_m *Client) ListWorkflow(ctx context.Context, request *workflowservice.ListWorkflowExecutionsRequest) (*workflowservice.ListWorkflowExecutionsResponse, error) {
 	ret := _m.Called(ctx, request)
@@ -305,6 +337,22 @@ func (_m *Client) ListWorkflow(ctx context.Context, request *workflowservice.Lis
 	return r0, r1
 }
 
+// ListWorkflowIterator provides a mock function with given fields: ctx, request
+func (_m *Client) ListWorkflowIterator(ctx context.Context, request *workflowservice.ListWorkflowExecutionsRequest) client.WorkflowExecutionIterator {
+	ret := _m.Called(ctx, request)
+
+	var r0 internal.WorkflowExecutionIterator
+	if rf, ok := ret.Get(0).(func(context.Context, *workflowservice.ListWorkflowExecutionsRequest) internal.WorkflowExecutionIterator); ok {
+		r0 = rf(ctx, request)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(internal.WorkflowExecutionIterator)
+		}
+	}
+
+	return r0
+}
+
 // ListArchivedWorkflow provides a mock function with given fields: ctx, request
 func (_m *Client) ListArchivedWorkflow(ctx context.Context, request *workflowservice.ListArchivedWorkflowExecutionsRequest) (*workflowservice.ListArchivedWorkflowExecutionsResponse, error) {
 	ret := _m.Called(ctx, request)
@@ -328,6 +376,22 @@ func (_m *Client) ListArchivedWorkflow(ctx context.Context, request *workflowser
 	return r0, r1
 }
 
+// ListArchivedWorkflowIterator provides a mock function with given fields: ctx, request
+func (_m *Client) ListArchivedWorkflowIterator(ctx context.Context, request *workflowservice.ListArchivedWorkflowExecutionsRequest) client.WorkflowExecutionIterator {
+	ret := _m.Called(ctx, request)
+
+	var r0 internal.WorkflowExecutionIterator
+	if rf, ok := ret.Get(0).(func(context.Context, *workflowservice.ListArchivedWorkflowExecutionsRequest) internal.WorkflowExecutionIterator); ok {
+		r0 = rf(ctx, request)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(internal.WorkflowExecutionIterator)
+		}
+	}
+
+	return r0
+}
+
 // QueryWorkflow provides a mock function with given fields: ctx, workflowID, runID, queryType, args
 func (_m *Client) QueryWorkflow(ctx context.Context, workflowID string, runID string, queryType string, args ...interface{}) (converter.EncodedValue, error) {
 	var _ca []interface{}
@@ -436,6 +500,22 @@ func (_m *Client) ScanWorkflow(ctx context.Context, request *workflowservice.Sca
 	return r0, r1
 }
 
+// ScanWorkflowIterator provides a mock function with given fields: ctx, request
+func (_m *Client) ScanWorkflowIterator(ctx context.Context, request *workflowservice.ScanWorkflowExecutionsRequest) client.WorkflowExecutionIterator {
+	ret := _m.Called(ctx, request)
+
+	var r0 internal.WorkflowExecutionIterator
+	if rf, ok := ret.Get(0).(func(context.Context, *workflowservice.ScanWorkflowExecutionsRequest) internal.WorkflowExecutionIterator); ok {
+		r0 = rf(ctx, request)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(internal.WorkflowExecutionIterator)
+		}
+	}
+
+	return r0
+}
+
 // SignalWithStartWorkflow provides a mock function with given fields: ctx, workflowID, signalName, signalArg, options, workflow, workflowArgs
 func (_m *Client) SignalWithStartWorkflow(ctx context.Context, workflowID string, signalName string, signalArg interface{}, options client.StartWorkflowOptions, workflow interface{}, workflowArgs ...interface{}) (client.WorkflowRun, error) {
 	var _ca []interface{}
@@ -31,9 +31,10 @@ import (
 
 // make sure mocks are in sync with interfaces
 var (
-	_ client.Client               = (*Client)(nil)
-	_ client.HistoryEventIterator = (*HistoryEventIterator)(nil)
-	_ client.NamespaceClient      = (*NamespaceClient)(nil)
-	_ converter.EncodedValue      = (*Value)(nil)
-	_ client.WorkflowRun          = (*WorkflowRun)(nil)
+	_ client.Client                    = (*Client)(nil)
+	_ client.HistoryEventIterator      = (*HistoryEventIterator)(nil)
+	_ client.NamespaceClient           = (*NamespaceClient)(nil)
+	_ converter.EncodedValue           = (*Value)(nil)
+	_ client.WorkflowRun               = (*WorkflowRun)(nil)
+	_ client.WorkflowExecutionIterator = (*WorkflowExecutionIterator)(nil)
 )
@@ -143,6 +143,10 @@ type (
 
 	// UnknownExternalWorkflowExecutionError can be returned when external workflow doesn't exist
 	UnknownExternalWorkflowExecutionError = internal.UnknownExternalWorkflowExecutionError
+
+	// NonDeterminismError is returned by workflow replay when commands produced by the workflow code don't match
+	// the history events. It contains the mismatching history event and command and the workflow stack trace.
+	NonDeterminismError = internal.NonDeterminismError
 )
 
 var (
@@ -0,0 +1,94 @@
+// The MIT License
+//
+// Copyright (c) 2020 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package temporal
+
+import "go.temporal.io/sdk/internal"
+
+type (
+	// SearchAttributeKey is implemented by all typed search attribute keys.
+	SearchAttributeKey = internal.SearchAttributeKey
+
+	// SearchAttributeKeyString is a key for a text search attribute.
+	SearchAttributeKeyString = internal.SearchAttributeKeyString
+
+	// SearchAttributeKeyKeyword is a key for a keyword search attribute.
+	SearchAttributeKeyKeyword = internal.SearchAttributeKeyKeyword
+
+	// SearchAttributeKeyKeywordList is a key for a keyword search attribute holding a list of values.
+	SearchAttributeKeyKeywordList = internal.SearchAttributeKeyKeywordList
+
+	// SearchAttributeKeyInt64 is a key for an int search attribute.
+	SearchAttributeKeyInt64 = internal.SearchAttributeKeyInt64
+
+	// SearchAttributeKeyFloat64 is a key for a double search attribute.
+	SearchAttributeKeyFloat64 = internal.SearchAttributeKeyFloat64
+
+	// SearchAttributeKeyBool is a key for a bool search attribute.
+	SearchAttributeKeyBool = internal.SearchAttributeKeyBool
+
+	// SearchAttributeKeyTime is a key for a datetime search attribute.
+	SearchAttributeKeyTime = internal.SearchAttributeKeyTime
+
+	// SearchAttributeUpdate is a typed search attribute value created by the ValueSet method of a typed key.
+	SearchAttributeUpdate = internal.SearchAttributeUpdate
+
+	// SearchAttributes is a read-only view of search attributes which decodes values with typed keys.
+	SearchAttributes = internal.SearchAttributes
+)
+
+// NewSearchAttributeKeyString creates a key for a text search attribute.
+func NewSearchAttributeKeyString(name string) SearchAttributeKeyString {
+	return internal.NewSearchAttributeKeyString(name)
+}
+
+// NewSearchAttributeKeyKeyword creates a key for a keyword search attribute.
+func NewSearchAttributeKeyKeyword(name string) SearchAttributeKeyKeyword {
+	return internal.NewSearchAttributeKeyKeyword(name)
+}
+
+// NewSearchAttributeKeyKeywordList creates a key for a keyword search attribute holding a list of values.
+func NewSearchAttributeKeyKeywordList(name string) SearchAttributeKeyKeywordList {
+	return internal.NewSearchAttributeKeyKeywordList(name)
+}
+
+// NewSearchAttributeKeyInt64 creates a key for an int search attribute.
+func NewSearchAttributeKeyInt64(name string) SearchAttributeKeyInt64 {
+	return internal.NewSearchAttributeKeyInt64(name)
+}
+
+// NewSearchAttributeKeyFloat64 creates a key for a double search attribute.
+func NewSearchAttributeKeyFloat64(name string) SearchAttributeKeyFloat64 {
+	return internal.NewSearchAttributeKeyFloat64(name)
+}
+
+// NewSearchAttributeKeyBool creates a key for a bool search attribute.
+func NewSearchAttributeKeyBool(name string) SearchAttributeKeyBool {
+	return internal.NewSearchAttributeKeyBool(name)
+}
+
+// NewSearchAttributeKeyTime creates a key for a datetime search attribute.
+func NewSearchAttributeKeyTime(name string) SearchAttributeKeyTime {
+	return internal.NewSearchAttributeKeyTime(name)
+}
@@ -26,16 +26,22 @@ package replaytests
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
+	enumspb "go.temporal.io/api/enums/v1"
 	"go.temporal.io/api/workflowservicemock/v1"
 
 	"go.temporal.io/sdk/client"
 	ilog "go.temporal.io/sdk/internal/log"
+	"go.temporal.io/sdk/temporal"
 	"go.temporal.io/sdk/worker"
 )
 
@@ -117,4 +123,57 @@ func (s *replayTestSuite) TestReplayBadWorkflowHistoryFromFile() {
 	err := replayer.ReplayWorkflowHistoryFromJSONFile(ilog.NewDefaultLogger(), "bad-history.json")
 	require.Error(s.T(), err)
 	require.True(s.T(), strings.Contains(err.Error(), "nondeterministic workflow definition"))
+	var ndErr *temporal.NonDeterminismError
+	require.True(s.T(), errors.As(err, &ndErr))
+	require.EqualValues(s.T(), 7, ndErr.EventID())
+	require.Equal(s.T(), enumspb.EVENT_TYPE_ACTIVITY_TASK_SCHEDULED, ndErr.HistoryEvent().GetEventType())
+}
+
+func (s *replayTestSuite) TestReplayWorkflowHistoriesFromDirectory() {
+	replayer := worker.NewWorkflowReplayer()
+	replayer.RegisterWorkflow(Workflow1)
+	replayer.RegisterWorkflow(Workflow2)
+
+	report, err := replayer.ReplayWorkflowHistoriesFromDirectory(ilog.NewDefaultLogger(), ".", worker.ReplayBatchOptions{MaxConcurrentReplays: 3})
+	require.NoError(s.T(), err)
+	require.Len(s.T(), report.Results, 7)
+	require.Error(s.T(), report.Err())
+
+	var passed []string
+	for _, result := range report.Passed() {
+		passed = append(passed, result.Source)
+	}
+	require.Equal(s.T(), []string{"workflow1.json", "workflow2.json"}, passed)
+
+	results := map[string]*worker.ReplayResult{}
+	for _, result := range report.Failed() {
+		results[result.Source] = result
+	}
+	bad := results["bad-history.json"]
+	require.NotNil(s.T(), bad)
+	require.Equal(s.T(), "Workflow1", bad.WorkflowType)
+	require.True(s.T(), strings.Contains(bad.Error.Error(), "nondeterministic workflow definition"))
+	require.NotZero(s.T(), bad.FailedEventID)
+
+	unregistered := results["parallel-side-effect.json"]
+	require.NotNil(s.T(), unregistered)
+	require.Equal(s.T(), "WorkflowWithParallelSideEffects", unregistered.WorkflowType)
+	require.Zero(s.T(), unregistered.FailedEventID)
+}
+
+func (s *replayTestSuite) TestReplayWorkflowHistoriesFromDirectory_SameRunID() {
+	history, err := ioutil.ReadFile("workflow1.json")
+	require.NoError(s.T(), err)
+	dir := s.T().TempDir()
+	for i := 0; i < 8; i++ {
+		require.NoError(s.T(), ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("workflow1-%v.json", i)), history, 0644))
+	}
+
+	replayer := worker.NewWorkflowReplayer()
+	replayer.RegisterWorkflow(Workflow1)
+
+	report, err := replayer.ReplayWorkflowHistoriesFromDirectory(ilog.NewDefaultLogger(), dir, worker.ReplayBatchOptions{MaxConcurrentReplays: 8})
+	require.NoError(s.T(), err)
+	require.Len(s.T(), report.Results, 8)
+	require.NoError(s.T(), report.Err())
 }
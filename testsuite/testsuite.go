@@ -36,6 +36,12 @@ type (
 	// TestWorkflowEnvironment is the environment that you use to test workflow
 	TestWorkflowEnvironment = internal.TestWorkflowEnvironment
 
+	// TestWorkflowRun is a run of the workflow executed by TestWorkflowEnvironment
+	TestWorkflowRun = internal.TestWorkflowRun
+
+	// TestChaosOptions configures the faults injected by TestWorkflowEnvironment in chaos mode
+	TestChaosOptions = internal.TestChaosOptions
+
 	// TestActivityEnvironment is the environment that you use to test activity
 	TestActivityEnvironment = internal.TestActivityEnvironment
 
@@ -173,15 +173,66 @@ type (
 		// The logger is an optional parameter. Defaults to the noop logger.
 		ReplayPartialWorkflowHistoryFromJSONFile(logger log.Logger, jsonfileName string, lastEventID int64) error
 
+		// ReplayWorkflowHistoryFromFile executes a single workflow task for the history file.
+		// The file format is chosen by the file name extension: .ndjson and .jsonl for one json encoded event per line,
+		// .pb and .binpb for binary protobuf, and json otherwise. Files ending with .gz are gzip decompressed.
+		// Use client.ExportWorkflowHistoryToFile to download the history file.
+		// Use for testing the backwards compatibility of code changes and troubleshooting workflows in a debugger.
+		// The logger is an optional parameter. Defaults to the noop logger.
+		ReplayWorkflowHistoryFromFile(logger log.Logger, fileName string) error
+
+		// ReplayPartialWorkflowHistoryFromFile executes a single workflow task for the history file upto provided
+		// lastEventID(inclusive). See ReplayWorkflowHistoryFromFile for supported file formats.
+		// Use for testing the backwards compatibility of code changes and troubleshooting workflows in a debugger.
+		// The logger is an optional parameter. Defaults to the noop logger.
+		ReplayPartialWorkflowHistoryFromFile(logger log.Logger, fileName string, lastEventID int64) error
+
 		// ReplayWorkflowExecution loads a workflow execution history from the Temporal service and executes a single workflow task for it.
 		// Use for testing the backwards compatibility of code changes and troubleshooting workflows in a debugger.
 		// The logger is the only optional parameter. Defaults to the noop logger.
 		ReplayWorkflowExecution(ctx context.Context, service workflowservice.WorkflowServiceClient, logger log.Logger, namespace string, execution workflow.Execution) error
+
+		// ReplayWorkflowHistoriesFromDirectory replays every history file in the given directory concurrently
+		// and returns a report with the workflow type, failing event ID and error of each replay.
+		// See ReplayWorkflowHistoryFromFile for supported file formats.
+		// Use for checking in CI that new workflow code is compatible with a set of captured histories.
+		// The logger is an optional parameter. Defaults to the noop logger.
+		ReplayWorkflowHistoriesFromDirectory(logger log.Logger, dirName string, options ReplayBatchOptions) (*ReplayReport, error)
+
+		// ReplayWorkflowExecutionsFromQuery replays every workflow execution returned by the given list workflow query
+		// concurrently, loading histories from the Temporal service, and returns a report with the workflow type,
+		// failing event ID and error of each replay. Executions are replayed while the query result is being listed,
+		// and listing stops with the context error once ctx is done.
+		// The logger is an optional parameter. Defaults to the noop logger.
+		ReplayWorkflowExecutionsFromQuery(ctx context.Context, service workflowservice.WorkflowServiceClient, logger log.Logger, namespace string, query string, options ReplayBatchOptions) (*ReplayReport, error)
 	}
 
+	// ReplayDebugCallbacks are invoked by WorkflowReplayer before and after each history event and workflow task
+	// during replay. Set them with WorkflowReplayerOptions to step through a replay in a debugger or to assert
+	// intermediate workflow state in tests.
+	ReplayDebugCallbacks = internal.ReplayDebugCallbacks
+
+	// ReplayDebugState gives access to the commands, coroutine stack traces and query handlers of the replayed
+	// workflow at the point a ReplayDebugCallbacks callback is invoked.
+	ReplayDebugState = internal.ReplayDebugState
+
+	// ReplayBatchOptions are options for replaying a batch of workflow histories.
+	ReplayBatchOptions = internal.ReplayBatchOptions
+
+	// ReplayResult is the outcome of replaying a single workflow history.
+	ReplayResult = internal.ReplayResult
+
+	// ReplayReport is the result of replaying a batch of workflow histories.
+	ReplayReport = internal.ReplayReport
+
 	// Options is used to configure a worker instance.
 	Options = internal.WorkerOptions
 
+	// WorkflowReplayerOptions are options for creating a WorkflowReplayer. They mirror the Options and
+	// client.Options fields that affect how workflow code is executed, so that histories produced by a worker
+	// configured with them can be replayed the same way.
+	WorkflowReplayerOptions = internal.WorkflowReplayerOptions
+
 	// WorkflowPanicPolicy is used for configuring how worker deals with workflow
 	// code panicking which includes non backwards compatible changes to the workflow code without appropriate
 	// versioning (see workflow.GetVersion).
@@ -220,6 +271,12 @@ func NewWorkflowReplayer() WorkflowReplayer {
 	return internal.NewWorkflowReplayer()
 }
 
+// NewWorkflowReplayerWithOptions creates a WorkflowReplayer instance with the given DataConverter,
+// ContextPropagators and WorkflowInterceptorChainFactories.
+func NewWorkflowReplayerWithOptions(options WorkflowReplayerOptions) WorkflowReplayer {
+	return internal.NewWorkflowReplayerWithOptions(options)
+}
+
 // EnableVerboseLogging enable or disable verbose logging of internal Temporal library components.
 // Most customers don't need this feature, unless advised by the Temporal team member.
 // Also there is no guarantee that this API is not going to change.
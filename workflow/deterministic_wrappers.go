@@ -25,6 +25,7 @@
 package workflow
 
 import (
+	"math/rand"
 	"time"
 
 	"go.temporal.io/sdk/internal"
@@ -58,6 +59,19 @@ type (
 	// WaitGroup is used to wait for a collection of
 	// coroutines to finish
 	WaitGroup = internal.WaitGroup
+
+	// Mutex is used to protect state shared between coroutines.
+	// Use workflow.NewMutex(ctx) method to create a Mutex instance.
+	Mutex = internal.Mutex
+
+	// Semaphore is used to bound the number of coroutines accessing a resource, for example
+	// the number of activities executed concurrently by the workflow.
+	// Use workflow.NewSemaphore(ctx, n) method to create a Semaphore instance.
+	Semaphore = internal.Semaphore
+
+	// ErrGroup is a collection of coroutines working on subtasks of a common task, like errgroup.Group from
+	// golang.org/x/sync. Use workflow.NewErrGroup(ctx) method to create an ErrGroup instance.
+	ErrGroup = internal.ErrGroup
 )
 
 // Await blocks the calling thread until condition() returns true.
@@ -133,6 +147,45 @@ func NewWaitGroup(ctx Context) WaitGroup {
 	return internal.NewWaitGroup(ctx)
 }
 
+// NewMutex creates a new Mutex instance.
+func NewMutex(ctx Context) Mutex {
+	return internal.NewMutex(ctx)
+}
+
+// NewSemaphore creates a new Semaphore instance with n permits, for example to execute at most 5 activities
+// at the same time:
+//   sem := workflow.NewSemaphore(ctx, 5)
+//   for _, item := range items {
+//       item := item
+//       if err := sem.Acquire(ctx, 1); err != nil {
+//           return err
+//       }
+//       workflow.Go(ctx, func(ctx workflow.Context) {
+//           defer sem.Release(1)
+//           _ = workflow.ExecuteActivity(ctx, ProcessItem, item).Get(ctx, nil)
+//       })
+//   }
+func NewSemaphore(ctx Context, n int64) Semaphore {
+	return internal.NewSemaphore(ctx, n)
+}
+
+// NewErrGroup creates a new ErrGroup instance. The first function started by the group that returns an error
+// cancels the context passed to the other functions of the group, for example:
+//   group := workflow.NewErrGroup(ctx)
+//   group.SetLimit(5)
+//   for _, item := range items {
+//       item := item
+//       group.Go(func(ctx workflow.Context) error {
+//           return workflow.ExecuteActivity(ctx, ProcessItem, item).Get(ctx, nil)
+//       })
+//   }
+//   if err := group.Wait(ctx); err != nil {
+//       return err
+//   }
+func NewErrGroup(ctx Context) ErrGroup {
+	return internal.NewErrGroup(ctx)
+}
+
 // Go creates a new coroutine. It has similar semantic to goroutine in a context of the workflow.
 func Go(ctx Context, f func(ctx Context)) {
 	internal.Go(ctx, f)
@@ -156,6 +209,22 @@ func Now(ctx Context) time.Time {
 	return internal.Now(ctx)
 }
 
+// NewRandom returns a new random generator. The workflow needs to use this NewRandom() instead of the Go lang library
+// math/rand functions, or SideEffect which records a marker for every value. The generator is seeded with a seed
+// recorded as a side effect marker by the first NewRandom or NewUUID call of the run, so it returns the same sequence
+// when the workflow is replayed, and a different one for a run created by continue-as-new or after the reset point
+// of a reset run. Each call returns a generator with a different sequence. The generator must not be shared with
+// other workflows.
+func NewRandom(ctx Context) *rand.Rand {
+	return internal.NewRandom(ctx)
+}
+
+// NewUUID returns a new random (version 4) UUID. The workflow needs to use this NewUUID() instead of the Go lang
+// library ones. The UUID is generated deterministically in the same way as NewRandom() values.
+func NewUUID(ctx Context) string {
+	return internal.NewUUID(ctx)
+}
+
 // NewTimer returns immediately and the future becomes ready after the specified duration d. The workflow needs to use
 // this NewTimer() to get the timer instead of the Go lang library one(timer.NewTimer()). You can cancel the pending
 // timer by cancel the Context (using context from workflow.WithCancel(ctx)) and that will cancel the timer. After timer
@@ -0,0 +1,72 @@
+// The MIT License
+//
+// Copyright (c) 2020 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package workflow
+
+import (
+	"go.temporal.io/sdk/internal"
+)
+
+type (
+	// EntityWorkflowOptions configures entity workflow run by RunEntityWorkflow.
+	// SignalNames: required, no default
+	//     Lists the signals processed by the entity
+	// MaxSignalsPerRun: optional, no limit by default
+	//     Number of processed signals after which the workflow continues as new
+	// MaxHistoryLength: optional, no limit by default
+	//     Number of history events after which the workflow continues as new
+	// MaxHistorySize: optional, no limit by default
+	//     Approximate history size in bytes after which the workflow continues as new
+	EntityWorkflowOptions = internal.EntityWorkflowOptions
+
+	// EntitySignalHandler processes a signal received by entity workflow. Handler updates the entity state
+	// in place. It can block, for example to execute activities. Returning an error fails the workflow.
+	EntitySignalHandler = internal.EntitySignalHandler
+)
+
+// RunEntityWorkflow runs a loop which processes the signals listed in options with handler until the
+// workflow is canceled or history has to be truncated, which happens when one of the limits in options
+// is reached or Info.GetContinueAsNewSuggested returns true. In the latter case all signals already delivered
+// to the workflow are processed first and then the workflow continues as new with state as its only argument,
+// so the entity workflow function has to accept it, for example:
+//   func AccountWorkflow(ctx workflow.Context, state *AccountState) error {
+//	   if state == nil {
+//		   state = &AccountState{}
+//	   }
+//	   return workflow.RunEntityWorkflow(ctx, options, state, func(ctx workflow.Context, signalName string, arg converter.EncodedValue) error {
+//		   var amount int
+//		   if err := arg.Get(&amount); err != nil {
+//			   return err
+//		   }
+//		   state.Balance += amount
+//		   return nil
+//	   })
+//   }
+// Signals are processed one at a time, handler of the next signal is not started until the previous one returns.
+// Signals with the same name are processed in the order they are received, but the order of signals with different
+// names is not preserved: signals delivered to the workflow in the same workflow task are processed in the order of
+// options.SignalNames.
+func RunEntityWorkflow(ctx Context, options EntityWorkflowOptions, state interface{}, handler EntitySignalHandler) error {
+	return internal.RunEntityWorkflow(ctx, options, state, handler)
+}
@@ -0,0 +1,57 @@
+// The MIT License
+//
+// Copyright (c) 2020 Temporal Technologies Inc.  All rights reserved.
+//
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package workflow
+
+import (
+	"go.temporal.io/sdk/internal"
+)
+
+type (
+	// SagaOptions configures compensation of the steps recorded by Saga.
+	// ParallelCompensation: optional, default false
+	//     Run all compensations at the same time instead of one at a time in the reverse order they were added
+	// ContinueWithError: optional, default false
+	//     Keep running the remaining compensations when a compensation fails. Sequential compensation stops at
+	//     the first failure by default. All compensations are always started when ParallelCompensation is set.
+	SagaOptions = internal.SagaOptions
+
+	// Saga records compensations of successfully completed steps of a workflow and runs them if a later step
+	// fails or the workflow is canceled, for example:
+	//   saga := workflow.NewSaga(workflow.SagaOptions{})
+	//   if err := workflow.ExecuteActivity(ctx, Withdraw, amount).Get(ctx, nil); err != nil {
+	//       return err
+	//   }
+	//   saga.AddCompensation(Deposit, amount)
+	//   if err := workflow.ExecuteActivity(ctx, Transfer, amount).Get(ctx, nil); err != nil {
+	//       _ = saga.Compensate(ctx)
+	//       return err
+	//   }
+	Saga = internal.Saga
+)
+
+// NewSaga creates a new Saga.
+func NewSaga(options SagaOptions) *Saga {
+	return internal.NewSaga(options)
+}
@@ -32,6 +32,7 @@ import (
 	"go.temporal.io/sdk/converter"
 	"go.temporal.io/sdk/internal"
 	"go.temporal.io/sdk/log"
+	"go.temporal.io/sdk/temporal"
 )
 
 type (
@@ -60,6 +61,9 @@ type (
 	// ContinueAsNewError can be returned by a workflow implementation function and indicates that
 	// the workflow should continue as new with the same WorkflowID, but new RunID and new history.
 	ContinueAsNewError = internal.ContinueAsNewError
+
+	// ContinueAsNewErrorOptions specifies options of the new run created by NewContinueAsNewErrorWithOptions.
+	ContinueAsNewErrorOptions = internal.ContinueAsNewErrorOptions
 )
 
 // ExecuteActivity requests activity execution in the context of a workflow.
@@ -347,6 +351,36 @@ func GetVersion(ctx Context, changeID string, minSupported, maxSupported Version
 	return internal.GetVersion(ctx, changeID, minSupported, maxSupported)
 }
 
+// Patched is a simpler alternative to GetVersion for a change that has only the old and the new code path.
+// Patched returns true when is executed for the first time and records it into the workflow history as a version
+// marker with patchID as its changeID. On replay it returns true only if the marker is present in the history,
+// so executions started before the change keep taking the old code path:
+//  if workflow.Patched(ctx, "fooChange") {
+//      err = workflow.ExecuteActivity(ctx, bar).Get(ctx, nil)
+//  } else {
+//      err = workflow.ExecuteActivity(ctx, foo).Get(ctx, nil)
+//  }
+//
+// When there are no executions running the old code path anymore, replace the call with DeprecatePatch:
+//  workflow.DeprecatePatch(ctx, "fooChange")
+//  err = workflow.ExecuteActivity(ctx, bar).Get(ctx, nil)
+//
+// patchID must not be used with GetVersion. Patched is mocked in TestWorkflowEnvironment with
+// OnGetVersion(patchID, workflow.DefaultVersion, 1), returning workflow.DefaultVersion from the mock selects
+// the old code path.
+func Patched(ctx Context, patchID string) bool {
+	return internal.Patched(ctx, patchID)
+}
+
+// DeprecatePatch marks the patch as applied to all running executions after the old code path has been removed.
+// Like Patched, it records the marker for patchID when is executed for the first time, so a rolled back build that
+// still calls Patched takes the new code path for executions started by the build with DeprecatePatch. On replay it
+// accepts histories both with and without the marker, so the executions that took the new code path still replay.
+// Once all executions without the marker are closed DeprecatePatch call can be removed too.
+func DeprecatePatch(ctx Context, patchID string) {
+	internal.DeprecatePatch(ctx, patchID)
+}
+
 // SetQueryHandler sets the query handler to handle workflow query. The queryType specify which query type this handler
 // should handle. The handler must be a function that returns 2 values. The first return value must be a serializable
 // result. The second return value must be an error. The handler function could receive any number of input parameters.
@@ -389,6 +423,34 @@ func SetQueryHandler(ctx Context, queryType string, handler interface{}) error {
 	return internal.SetQueryHandler(ctx, queryType, handler)
 }
 
+// SetSignalHandler sets the handler for the signal with the given name. The handler must be a function which
+// takes workflow.Context as the first argument, followed by the arguments of the signal, and returns nothing.
+// Every delivered signal is processed by the handler in its own coroutine, so the handler can block, for example
+// to execute an activity, without delaying other signals.
+// Ordering guarantees:
+//  - handlers of signals with the same name are started in the order the signals are delivered to the workflow.
+//    Signals with different names are dispatched independently, so their handlers may start in any order;
+//  - handler of a signal starts in the workflow task the signal is delivered in, after the main workflow coroutine
+//    and other running coroutines are blocked. So the main workflow coroutine observes changes made by handlers
+//    when it is unblocked, for example by workflow.Await;
+//  - signals delivered before the handler is set are buffered and processed as soon as it is set.
+// Calling SetSignalHandler again for the same signal name replaces the handler for subsequent signals.
+// Signal channel returned by GetSignalChannel for the same signal name must not be used together with the handler.
+// Example:
+//  func MyWorkflow(ctx workflow.Context) error {
+//    var total int
+//    err := workflow.SetSignalHandler(ctx, "add", func(ctx workflow.Context, value int) {
+//      total += value
+//    })
+//    if err != nil {
+//      return err
+//    }
+//    return workflow.Await(ctx, func() bool { return total > 100 })
+//  }
+func SetSignalHandler(ctx Context, signalName string, handler interface{}) error {
+	return internal.SetSignalHandler(ctx, signalName, handler)
+}
+
 // IsReplaying returns whether the current workflow code is replaying.
 //
 // Warning! Never make commands, like schedule activity/childWorkflow/timer or send/wait on future/channel, based on
@@ -463,6 +525,41 @@ func UpsertSearchAttributes(ctx Context, attributes map[string]interface{}) erro
 	return internal.UpsertSearchAttributes(ctx, attributes)
 }
 
+// UpsertMemo is used to add or update workflow memo.
+// The value has to deterministic when replay;
+// The value has to be Json serializable.
+// UpsertMemo will merge memo to existing map in workflow, for example workflow code:
+//   func MyWorkflow(ctx workflow.Context, input string) error {
+//	   memo := map[string]interface{}{
+//		   "Description": "processing",
+//	   }
+//	   workflow.UpsertMemo(ctx, memo)
+//	   ...
+//	   var description string
+//	   _ = workflow.GetInfo(ctx).GetDecodedMemo()["Description"].Get(&description)
+//   }
+// The change is recorded in workflow history as a marker and is visible to the workflow through GetInfo.
+// Memo returned by List/Scan/Describe workflow APIs is not updated, because server doesn't support
+// modifying memo of a running workflow.
+func UpsertMemo(ctx Context, memo map[string]interface{}) error {
+	return internal.UpsertMemo(ctx, memo)
+}
+
+// UpsertTypedSearchAttributes is used to add or update workflow search attributes using typed keys created with
+// temporal.NewSearchAttributeKey* functions. Value types are checked at compile time, for example:
+//   var customIntKey = temporal.NewSearchAttributeKeyInt64("CustomIntField")
+//
+//   func MyWorkflow(ctx workflow.Context, input string) error {
+//	   err := workflow.UpsertTypedSearchAttributes(ctx, customIntKey.ValueSet(2))
+//	   ...
+//	   value, ok := workflow.GetInfo(ctx).GetTypedSearchAttributes().GetInt64(customIntKey)
+//   }
+// The current search attributes, including upserted ones, are available via GetInfo(ctx).GetTypedSearchAttributes().
+// This is only supported when using ElasticSearch.
+func UpsertTypedSearchAttributes(ctx Context, updates ...temporal.SearchAttributeUpdate) error {
+	return internal.UpsertTypedSearchAttributes(ctx, updates...)
+}
+
 // NewContinueAsNewError creates ContinueAsNewError instance
 // If the workflow main function returns this error then the current execution is ended and
 // the new execution with same workflow ID is started automatically with options
@@ -479,6 +576,20 @@ func NewContinueAsNewError(ctx Context, wfn interface{}, args ...interface{}) er
 	return internal.NewContinueAsNewError(ctx, wfn, args...)
 }
 
+// NewContinueAsNewErrorWithOptions creates ContinueAsNewError instance like NewContinueAsNewError,
+// with options of the new run overridden by the options argument. It allows to move the new run to
+// another task queue, change its timeouts, memo, search attributes and retry policy.
+// If memo or search attributes in options cannot be encoded, the returned error is not a ContinueAsNewError,
+// so returning it fails the workflow.
+//  options - options of the new run, zero values keep the options of the current run or the ones set on ctx
+//	  (except for RetryPolicy, see ContinueAsNewErrorOptions).
+//  wfn - workflow function. for new execution it can be different from the currently running.
+//  args - arguments for the new workflow.
+//
+func NewContinueAsNewErrorWithOptions(ctx Context, options ContinueAsNewErrorOptions, wfn interface{}, args ...interface{}) error {
+	return internal.NewContinueAsNewErrorWithOptions(ctx, options, wfn, args...)
+}
+
 // IsContinueAsNewError return if the err is a ContinueAsNewError
 func IsContinueAsNewError(err error) bool {
 	var continueAsNewErr *ContinueAsNewError